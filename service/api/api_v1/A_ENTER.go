@@ -1,6 +1,7 @@
 package api_v1
 
 import (
+	"sun-panel/api/api_v1/admin"
 	"sun-panel/api/api_v1/openness"
 	"sun-panel/api/api_v1/panel"
 	"sun-panel/api/api_v1/system"
@@ -10,6 +11,7 @@ type ApiGroup struct {
 	ApiSystem system.ApiSystem // 系统功能api
 	ApiOpen   openness.ApiPpenness
 	ApiPanel  panel.ApiPanel
+	ApiAdmin  admin.ApiAdmin
 }
 
 var ApiGroupApp = new(ApiGroup)
@@ -0,0 +1,9 @@
+package admin
+
+type ApiAdmin struct {
+	SystemSettingApi SystemSettingApi
+	LdapApi          LdapApi
+	ForwardAuthApi   ForwardAuthApi
+	RoleManageApi    RoleManageApi
+	AuditLogApi      AuditLogApi
+}
@@ -0,0 +1,151 @@
+package admin
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/auditLog"
+	"sun-panel/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// 审计日志查询与导出
+type AuditLogApi struct{}
+
+const auditLogExportMaxRows = 100000 // 单次导出最大条数
+
+type auditLogFilterReq struct {
+	ActorId    uint       `json:"actorId"`
+	ActorName  string     `json:"actorName" validate:"max=255"`
+	Action     string     `json:"action" validate:"max=50"`
+	TargetType string     `json:"targetType" validate:"max=50"`
+	TargetId   string     `json:"targetId" validate:"max=100"`
+	Ip         string     `json:"ip" validate:"max=50"`
+	StartTime  *time.Time `json:"startTime"` // RFC3339
+	EndTime    *time.Time `json:"endTime"`
+}
+
+// 按条件过滤
+func (f auditLogFilterReq) apply(db *gorm.DB) *gorm.DB {
+	if f.ActorId != 0 {
+		db = db.Where("actor_id=?", f.ActorId)
+	}
+	if f.ActorName != "" {
+		db = db.Where("actor_name LIKE ?", "%"+f.ActorName+"%")
+	}
+	if f.Action != "" {
+		db = db.Where("action=?", f.Action)
+	}
+	if f.TargetType != "" {
+		db = db.Where("target_type=?", f.TargetType)
+	}
+	if f.TargetId != "" {
+		db = db.Where("target_id=?", f.TargetId)
+	}
+	if f.Ip != "" {
+		db = db.Where("ip=?", f.Ip)
+	}
+	if f.StartTime != nil {
+		db = db.Where("created_at >= ?", *f.StartTime)
+	}
+	if f.EndTime != nil {
+		db = db.Where("created_at <= ?", *f.EndTime)
+	}
+	return db
+}
+
+func (a *AuditLogApi) GetList(c *gin.Context) {
+	type Req struct {
+		auditLogFilterReq
+		Page  int `json:"page"`
+		Limit int `json:"limit" validate:"max=1000"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 {
+		req.Limit = 20
+	}
+
+	var (
+		list  []models.AuditLog
+		count int64
+	)
+	db := req.apply(global.Db.Model(&models.AuditLog{}))
+	if err := db.Order("id desc").Limit(req.Limit).Offset((req.Page - 1) * req.Limit).Find(&list).Limit(-1).Offset(-1).Count(&count).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessListData(c, list, count)
+}
+
+// 导出，format: csv（默认）或 json
+func (a *AuditLogApi) Export(c *gin.Context) {
+	type Req struct {
+		auditLogFilterReq
+		Format string `json:"format" validate:"omitempty,oneof=csv json"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	list := []models.AuditLog{}
+	if err := req.apply(global.Db).Order("id desc").Limit(auditLogExportMaxRows).Find(&list).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, userInfo, auditLog.ACTION_AUDIT_LOG_EXPORT, "", nil, nil, req)
+
+	filename := "audit_log_" + time.Now().Format("20060102150405")
+	if req.Format == "json" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", filename))
+		c.Header("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(c.Writer).Encode(list)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", filename))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "time", "actorId", "actorName", "action", "targetType", "targetId", "ip", "userAgent", "diff"})
+	for _, v := range list {
+		w.Write([]string{
+			strconv.Itoa(int(v.ID)),
+			v.CreatedAt.Format(time.RFC3339),
+			strconv.Itoa(int(v.ActorId)),
+			v.ActorName,
+			v.Action,
+			v.TargetType,
+			v.TargetId,
+			v.Ip,
+			v.UserAgent,
+			v.Diff,
+		})
+	}
+	w.Flush()
+}
@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"net"
+	"strings"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// 反向代理认证配置（仅管理员）
+type ForwardAuthApi struct{}
+
+func (a *ForwardAuthApi) GetConfig(c *gin.Context) {
+	cfg := systemSetting.ForwardAuth{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_FORWARD_AUTH, &cfg)
+	apiReturn.SuccessData(c, cfg)
+}
+
+// 保存配置，启用时必须配置可信代理
+func (a *ForwardAuthApi) SetConfig(c *gin.Context) {
+	type Req struct {
+		Enabled        bool     `json:"enabled"`
+		TrustedProxies []string `json:"trustedProxies" validate:"max=50"`
+		HeaderUser     string   `json:"headerUser" validate:"max=100"`
+		HeaderEmail    string   `json:"headerEmail" validate:"max=100"`
+		HeaderName     string   `json:"headerName" validate:"max=100"`
+		HeaderGroups   string   `json:"headerGroups" validate:"max=100"`
+		AutoRegister   bool     `json:"autoRegister"`
+		LinkLocalUser  bool     `json:"linkLocalUser"`
+		AdminGroups    []string `json:"adminGroups" validate:"max=50"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	cfg := systemSetting.ForwardAuth{
+		Enabled:        req.Enabled,
+		TrustedProxies: []string{},
+		HeaderUser:     strings.TrimSpace(req.HeaderUser),
+		HeaderEmail:    strings.TrimSpace(req.HeaderEmail),
+		HeaderName:     strings.TrimSpace(req.HeaderName),
+		HeaderGroups:   strings.TrimSpace(req.HeaderGroups),
+		AutoRegister:   req.AutoRegister,
+		LinkLocalUser:  req.LinkLocalUser,
+		AdminGroups:    []string{},
+	}
+	for _, v := range req.TrustedProxies {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(v); err != nil && net.ParseIP(v) == nil {
+			apiReturn.ErrorParamFomat(c, "invalid trusted proxy: "+v)
+			return
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, v)
+	}
+	if cfg.Enabled && len(cfg.TrustedProxies) == 0 {
+		apiReturn.ErrorParamFomat(c, "trustedProxies is required when enabled")
+		return
+	}
+	for _, v := range req.AdminGroups {
+		if v = strings.TrimSpace(v); v != "" {
+			cfg.AdminGroups = append(cfg.AdminGroups, v)
+		}
+	}
+
+	before := systemSetting.ForwardAuth{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_FORWARD_AUTH, &before)
+	if err := global.SystemSetting.Set(systemSetting.SYSTEM_FORWARD_AUTH, cfg); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	systemSettingAudit(c, systemSetting.SYSTEM_FORWARD_AUTH, before, cfg)
+	apiReturn.Success(c)
+}
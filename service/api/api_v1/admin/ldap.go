@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"errors"
+	"strings"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/ldapAuth"
+	"sun-panel/lib/secret"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// LDAP登录配置（仅管理员）
+type LdapApi struct{}
+
+const ldapPasswordMask = "******" // 返回给前端的查询账号密码掩码
+
+type ldapConfigReq struct {
+	Enabled            bool   `json:"enabled"`
+	Url                string `json:"url" validate:"required,max=255"`
+	StartTls           bool   `json:"startTls"`
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"`
+	BindDn             string `json:"bindDn" validate:"max=255"`
+	BindPassword       string `json:"bindPassword" validate:"max=255"`
+	BaseDn             string `json:"baseDn" validate:"required,max=255"`
+	UserFilter         string `json:"userFilter" validate:"max=500"`
+	AttrUsername       string `json:"attrUsername" validate:"max=50"`
+	AttrName           string `json:"attrName" validate:"max=50"`
+	AttrEmail          string `json:"attrEmail" validate:"max=50"`
+	AdminGroupFilter   string `json:"adminGroupFilter" validate:"max=500"`
+	GroupBaseDn        string `json:"groupBaseDn" validate:"max=255"`
+}
+
+// 获取配置，查询账号密码只返回掩码
+func (a *LdapApi) GetConfig(c *gin.Context) {
+	ldapSetting := systemSetting.Ldap{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_LDAP, &ldapSetting)
+	if ldapSetting.BindPassword != "" {
+		ldapSetting.BindPassword = ldapPasswordMask
+	}
+	apiReturn.SuccessData(c, ldapSetting)
+}
+
+// 保存配置，查询账号密码为空或掩码时保留原密码
+func (a *LdapApi) SetConfig(c *gin.Context) {
+	ldapSetting, ok := ldapBindConfig(c)
+	if !ok {
+		return
+	}
+	before := systemSetting.Ldap{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_LDAP, &before)
+	if err := global.SystemSetting.Set(systemSetting.SYSTEM_LDAP, ldapSetting); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	systemSettingAudit(c, systemSetting.SYSTEM_LDAP, before, ldapSetting)
+	apiReturn.Success(c)
+}
+
+// 测试配置（不保存）：连接、查询账号绑定、BaseDn
+// 提供 username 和 password 时同时测试用户登录
+func (a *LdapApi) Test(c *gin.Context) {
+	type Req struct {
+		Username string `json:"username" validate:"max=100"`
+		Password string `json:"password" validate:"max=100"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	ldapSetting, ok := ldapBindConfig(c)
+	if !ok {
+		return
+	}
+
+	if err := ldapAuth.Test(ldapSetting); err != nil {
+		apiReturn.Error(c, "LDAP test failed: "+err.Error())
+		return
+	}
+	if req.Username == "" {
+		apiReturn.SuccessData(c, gin.H{"connected": true})
+		return
+	}
+
+	ldapSetting.Enabled = true
+	user, err := ldapAuth.Authenticate(ldapSetting, strings.TrimSpace(req.Username), req.Password)
+	if errors.Is(err, ldapAuth.ErrInvalidCredentials) {
+		apiReturn.Error(c, "LDAP user test failed: user not found or wrong password")
+		return
+	} else if err != nil {
+		apiReturn.Error(c, "LDAP user test failed: "+err.Error())
+		return
+	}
+	apiReturn.SuccessData(c, gin.H{
+		"connected": true,
+		"dn":        user.Dn,
+		"username":  user.Username,
+		"name":      user.Name,
+		"email":     user.Email,
+		"isAdmin":   user.IsAdmin,
+	})
+}
+
+// 解析请求中的配置，查询账号密码加密，为空或掩码时使用已保存的密码
+func ldapBindConfig(c *gin.Context) (systemSetting.Ldap, bool) {
+	req := ldapConfigReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return systemSetting.Ldap{}, false
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return systemSetting.Ldap{}, false
+	}
+	req.Url = strings.TrimSpace(req.Url)
+	if !strings.HasPrefix(req.Url, "ldap://") && !strings.HasPrefix(req.Url, "ldaps://") {
+		apiReturn.ErrorParamFomat(c, "url must start with ldap:// or ldaps://")
+		return systemSetting.Ldap{}, false
+	}
+	for _, filter := range []string{req.UserFilter, req.AdminGroupFilter} {
+		if filter != "" && (!strings.HasPrefix(filter, "(") || !strings.HasSuffix(filter, ")")) {
+			apiReturn.ErrorParamFomat(c, "filter must be enclosed in parentheses")
+			return systemSetting.Ldap{}, false
+		}
+	}
+
+	saved := systemSetting.Ldap{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_LDAP, &saved)
+
+	ldapSetting := systemSetting.Ldap{
+		Enabled:            req.Enabled,
+		Url:                req.Url,
+		StartTls:           req.StartTls,
+		InsecureSkipVerify: req.InsecureSkipVerify,
+		BindDn:             strings.TrimSpace(req.BindDn),
+		BindPassword:       saved.BindPassword,
+		BaseDn:             strings.TrimSpace(req.BaseDn),
+		UserFilter:         strings.TrimSpace(req.UserFilter),
+		AttrUsername:       strings.TrimSpace(req.AttrUsername),
+		AttrName:           strings.TrimSpace(req.AttrName),
+		AttrEmail:          strings.TrimSpace(req.AttrEmail),
+		AdminGroupFilter:   strings.TrimSpace(req.AdminGroupFilter),
+		GroupBaseDn:        strings.TrimSpace(req.GroupBaseDn),
+	}
+	if req.BindPassword != "" && req.BindPassword != ldapPasswordMask {
+		encrypted, err := secret.Encrypt(req.BindPassword)
+		if err != nil {
+			apiReturn.Error(c, err.Error())
+			return ldapSetting, false
+		}
+		ldapSetting.BindPassword = encrypted
+	}
+	return ldapSetting, true
+}
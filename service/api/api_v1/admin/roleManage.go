@@ -0,0 +1,235 @@
+package admin
+
+import (
+	"errors"
+	"strings"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/auditLog"
+	"sun-panel/lib/permission"
+	"sun-panel/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// 角色管理
+type RoleManageApi struct{}
+
+var (
+	ErrRoleManageIsSystem = errors.New("system role can not be deleted")
+	ErrRoleManageInUse    = errors.New("role is in use")
+)
+
+type roleManageInfo struct {
+	models.Role
+	Permissions []string `json:"permissions"`
+	UserCount   int64    `json:"userCount"`
+}
+
+func roleManageToInfo(role models.Role) roleManageInfo {
+	mRole := models.Role{}
+	count, _ := mRole.CountUsers(role.ID)
+	return roleManageInfo{
+		Role:        role,
+		Permissions: permission.GetByRoleId(int(role.ID)),
+		UserCount:   count,
+	}
+}
+
+// 获取全部可用权限
+func (a *RoleManageApi) GetPermissionList(c *gin.Context) {
+	apiReturn.SuccessData(c, permission.Permissions)
+}
+
+func (a *RoleManageApi) GetSystemList(c *gin.Context) {
+	type Req struct {
+		Page    int    `json:"page"`
+		Limit   int    `json:"limit"`
+		Keyword string `json:"keyword"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 1 {
+		req.Limit = 20
+	}
+
+	var (
+		list  []models.Role
+		count int64
+	)
+	db := global.Db.Model(&models.Role{})
+	if req.Keyword != "" {
+		db = db.Where("name LIKE ? OR description LIKE ?", "%"+req.Keyword+"%", "%"+req.Keyword+"%")
+	}
+	if err := db.Order("id").Limit(req.Limit).Offset((req.Page - 1) * req.Limit).Find(&list).Limit(-1).Offset(-1).Count(&count).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	res := []roleManageInfo{}
+	for _, v := range list {
+		res = append(res, roleManageToInfo(v))
+	}
+	apiReturn.SuccessListData(c, res, count)
+}
+
+func (a *RoleManageApi) GetInfo(c *gin.Context) {
+	type Req struct {
+		AiRoleId uint `json:"aiRoleId" validate:"required"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	mRole := models.Role{}
+	role, err := mRole.GetInfo(req.AiRoleId)
+	if err == gorm.ErrRecordNotFound {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	} else if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessData(c, roleManageToInfo(role))
+}
+
+// 新增或修改角色，ID为0时新增
+// 系统管理员角色的权限不可修改
+func (a *RoleManageApi) Edit(c *gin.Context) {
+	type Req struct {
+		ID          uint     `json:"id"`
+		Name        string   `json:"name" validate:"required,max=50"`
+		Description string   `json:"description" validate:"max=255"`
+		Permissions []string `json:"permissions"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	permissions, err := permission.Normalize(req.Permissions)
+	if err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	role := models.Role{
+		Name:        req.Name,
+		Description: strings.TrimSpace(req.Description),
+		Permissions: strings.Join(permissions, ","),
+	}
+	var before interface{}
+	if req.ID == 0 {
+		if err := global.Db.Create(&role).Error; err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+	} else {
+		mRole := models.Role{}
+		oldRole, err := mRole.GetInfo(req.ID)
+		if err == gorm.ErrRecordNotFound {
+			apiReturn.ErrorDataNotFound(c)
+			return
+		} else if err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+		before = roleManageToInfo(oldRole)
+
+		fields := []string{"Name", "Description", "Permissions"}
+		if req.ID == models.ROLE_ADMIN {
+			fields = []string{"Name", "Description"}
+		}
+		if err := global.Db.Model(&models.Role{}).Select(fields).Where("id=?", req.ID).Updates(&role).Error; err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+		role.ID = req.ID
+	}
+
+	permission.ClearCache()
+	after := roleManageToInfo(role)
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, userInfo, auditLog.ACTION_ROLE_SAVE, auditLog.TARGET_ROLE, role.ID, before, after)
+	apiReturn.SuccessData(c, after)
+}
+
+// 删除角色，内置角色和仍有用户使用的角色不可删除
+func (a *RoleManageApi) Deletes(c *gin.Context) {
+	type Req struct {
+		AiRoleIds []uint `json:"aiRoleIds" validate:"required,min=1"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	deleted := []models.Role{}
+	txErr := global.Db.Transaction(func(tx *gorm.DB) error {
+		mItemIconGroupShare := models.ItemIconGroupShare{}
+		for _, id := range req.AiRoleIds {
+			role := models.Role{}
+			if err := tx.First(&role, "id=?", id).Error; err == gorm.ErrRecordNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if role.IsSystem == 1 {
+				return ErrRoleManageIsSystem
+			}
+			var count int64
+			if err := tx.Model(&models.User{}).Where("role=?", id).Count(&count).Error; err != nil {
+				return err
+			} else if count > 0 {
+				return ErrRoleManageInUse
+			}
+			if err := tx.Delete(&role).Error; err != nil {
+				return err
+			}
+			if err := mItemIconGroupShare.DeleteByTarget(tx, models.SHARE_TYPE_ROLE, role.ID); err != nil {
+				return err
+			}
+			deleted = append(deleted, role)
+		}
+		return nil
+	})
+	if txErr == ErrRoleManageIsSystem || txErr == ErrRoleManageInUse {
+		apiReturn.Error(c, txErr.Error())
+		return
+	} else if txErr != nil {
+		apiReturn.ErrorDatabase(c, txErr.Error())
+		return
+	}
+
+	permission.ClearCache()
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	for _, v := range deleted {
+		auditLog.Record(c, userInfo, auditLog.ACTION_ROLE_DELETE, auditLog.TARGET_ROLE, v.ID, v, nil)
+	}
+	apiReturn.Success(c)
+}
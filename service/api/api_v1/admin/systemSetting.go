@@ -0,0 +1,235 @@
+package admin
+
+import (
+	"net/url"
+	"strings"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/auditLog"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/mail"
+	"sun-panel/lib/secret"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// 系统设置（仅管理员）
+type SystemSettingApi struct{}
+
+const emailPasswordMask = "******" // 返回给前端的邮箱密码掩码
+
+type systemSettingTextReq struct {
+	Content string `json:"content" validate:"max=20000"`
+}
+
+func (a *SystemSettingApi) GetApplicationSetting(c *gin.Context) {
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	apiReturn.SuccessData(c, settings)
+}
+
+// 部分更新应用设置，未传的字段保持不变
+// 两步验证策略和登录锁定策略只能通过 /panel/users 下的接口设置
+func (a *SystemSettingApi) SetApplicationSetting(c *gin.Context) {
+	type Req struct {
+		WebSiteUrl             *string `json:"webSiteUrl" validate:"omitempty,max=200"`
+		EmailSuffix            *string `json:"emailSuffix" validate:"omitempty,max=100"`
+		OpenRegister           *bool   `json:"openRegister"`
+		LoginCaptcha           *bool   `json:"loginCaptcha"`
+		LoginCaptchaAfterFails *int    `json:"loginCaptchaAfterFails" validate:"omitempty,min=0"`
+		AuditLogRetentionDays  *int    `json:"auditLogRetentionDays" validate:"omitempty,min=0"`
+		HealthHistoryRawHours  *int    `json:"healthHistoryRawHours" validate:"omitempty,min=0"`
+		HealthHistory5mDays    *int    `json:"healthHistory5mDays" validate:"omitempty,min=0"`
+		HealthHistory1hDays    *int    `json:"healthHistory1hDays" validate:"omitempty,min=0"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	before := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &before)
+	settings := before
+
+	// 站点地址只允许http(s)，不以/结尾
+	if req.WebSiteUrl != nil {
+		settings.WebSiteUrl = strings.TrimRight(strings.TrimSpace(*req.WebSiteUrl), "/")
+		if settings.WebSiteUrl != "" {
+			u, err := url.Parse(settings.WebSiteUrl)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				apiReturn.ErrorParamFomat(c, "webSiteUrl must be a http(s) url")
+				return
+			}
+		}
+	}
+	if req.EmailSuffix != nil {
+		settings.EmailSuffix = strings.TrimSpace(*req.EmailSuffix)
+	}
+	if req.OpenRegister != nil {
+		settings.OpenRegister = *req.OpenRegister
+	}
+	if req.LoginCaptcha != nil {
+		settings.LoginCaptcha = *req.LoginCaptcha
+	}
+	if req.LoginCaptchaAfterFails != nil {
+		settings.LoginCaptchaAfterFails = *req.LoginCaptchaAfterFails
+	}
+	if req.AuditLogRetentionDays != nil {
+		settings.AuditLogRetentionDays = *req.AuditLogRetentionDays
+	}
+	if req.HealthHistoryRawHours != nil {
+		settings.HealthHistoryRawHours = *req.HealthHistoryRawHours
+	}
+	if req.HealthHistory5mDays != nil {
+		settings.HealthHistory5mDays = *req.HealthHistory5mDays
+	}
+	if req.HealthHistory1hDays != nil {
+		settings.HealthHistory1hDays = *req.HealthHistory1hDays
+	}
+
+	if err := global.SystemSetting.Set(systemSetting.SYSTEM_APPLICATION, settings); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	systemSettingAudit(c, systemSetting.SYSTEM_APPLICATION, before, settings)
+	apiReturn.Success(c)
+}
+
+// 获取邮箱配置，密码不返回明文
+func (a *SystemSettingApi) GetEmail(c *gin.Context) {
+	emailSetting := systemSetting.Email{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_EMAIL, &emailSetting)
+	if emailSetting.Password != "" {
+		emailSetting.Password = emailPasswordMask
+	}
+	apiReturn.SuccessData(c, emailSetting)
+}
+
+// 设置邮箱配置，密码加密存储，为空或掩码时保留原密码
+func (a *SystemSettingApi) SetEmail(c *gin.Context) {
+	type Req struct {
+		Host     string `json:"host" validate:"required,max=100"`
+		Port     int    `json:"port" validate:"required,min=1,max=65535"`
+		Mail     string `json:"mail" validate:"required,email,max=100"`
+		Password string `json:"password" validate:"max=200"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	emailSetting := systemSetting.Email{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_EMAIL, &emailSetting)
+	before := emailSetting
+	emailSetting.Host = strings.TrimSpace(req.Host)
+	emailSetting.Port = req.Port
+	emailSetting.Mail = strings.TrimSpace(req.Mail)
+	if req.Password != "" && req.Password != emailPasswordMask {
+		encrypted, err := secret.Encrypt(req.Password)
+		if err != nil {
+			apiReturn.Error(c, err.Error())
+			return
+		}
+		emailSetting.Password = encrypted
+	}
+
+	if err := global.SystemSetting.Set(systemSetting.SYSTEM_EMAIL, emailSetting); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	// 审计日志中不记录密码
+	after := emailSetting
+	if before.Password != "" {
+		before.Password = emailPasswordMask
+	}
+	if after.Password != "" {
+		after.Password = emailPasswordMask
+	}
+	systemSettingAudit(c, systemSetting.SYSTEM_EMAIL, before, after)
+	apiReturn.Success(c)
+}
+
+// 使用当前保存的邮箱配置发送测试邮件
+func (a *SystemSettingApi) SendTestEmail(c *gin.Context) {
+	type Req struct {
+		MailTo string `json:"mailTo" validate:"required,email,max=100"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	emailer, err := mail.NewSystemEmailer()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	appName := global.Lang.Get("common.app_name")
+	if err := emailer.SendMail(req.MailTo, appName+" test email", "This is a test email, the email configuration is working."); err != nil {
+		apiReturn.Error(c, "Failed to send email: "+err.Error())
+		return
+	}
+	apiReturn.Success(c)
+}
+
+func (a *SystemSettingApi) GetDisclaimer(c *gin.Context) {
+	content, _ := global.SystemSetting.GetValueString(systemSetting.DISCLAIMER)
+	apiReturn.SuccessData(c, content)
+}
+
+func (a *SystemSettingApi) SetDisclaimer(c *gin.Context) {
+	systemSettingSetText(c, systemSetting.DISCLAIMER)
+}
+
+func (a *SystemSettingApi) GetAboutDescription(c *gin.Context) {
+	content, _ := global.SystemSetting.GetValueString(systemSetting.WEB_ABOUT_DESCRIPTION)
+	apiReturn.SuccessData(c, content)
+}
+
+func (a *SystemSettingApi) SetAboutDescription(c *gin.Context) {
+	systemSettingSetText(c, systemSetting.WEB_ABOUT_DESCRIPTION)
+}
+
+// 保存文本类型的配置
+func systemSettingSetText(c *gin.Context, configName string) {
+	req := systemSettingTextReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	before, _ := global.SystemSetting.GetValueString(configName)
+	if err := global.SystemSetting.Set(configName, req.Content); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	systemSettingAudit(c, configName, before, req.Content)
+	apiReturn.Success(c)
+}
+
+// 记录设置变更的审计日志
+func systemSettingAudit(c *gin.Context, configName string, before, after interface{}) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, userInfo, auditLog.ACTION_SETTING_UPDATE, auditLog.TARGET_SETTING, configName, before, after)
+}
@@ -10,6 +10,14 @@ var ErrorCodeMap = map[int]string{
 	1005: "No current permission for operation", // 当前无权限操作
 	1006: "Account does not exist",              // 账号不存在
 	1007: "Old password error",                  // 旧密码不正确
+	1008: "Two-factor authentication required",  // 需要两步验证
+	1009: "Verification code error",             // 动态验证码错误
+	1010: "Two-factor authentication expired",   // 两步验证已过期，请重新登录
+	1011: "Too many login attempts",             // 登录失败次数过多，已临时锁定
+
+	// 验证器类
+	1101: "Captcha required", // 需要图形验证码
+	1102: "Captcha error",    // 图形验证码错误
 
 	// 数据类
 	1200: "Database error",           // 数据库错误
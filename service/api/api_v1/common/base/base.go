@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sun-panel/api/api_v1/common/apiData/commonApiStructs"
 	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/global"
 	"sun-panel/lib/captcha"
 	"sun-panel/lib/cmn"
+	"sun-panel/lib/cmn/systemSetting"
 	"sun-panel/models"
 
 	"github.com/gin-gonic/gin"
@@ -27,7 +30,9 @@ const (
 )
 
 const (
-	GIN_GET_VISIT_MODE = "VISIT_MODE"
+	GIN_GET_VISIT_MODE           = "VISIT_MODE"
+	GIN_API_TOKEN_REQUIRED_SCOPE = "API_TOKEN_REQUIRED_SCOPE" // 接口允许的API令牌权限
+	GIN_API_TOKEN_SCOPES         = "API_TOKEN_SCOPES"         // 使用API令牌访问时，令牌的权限列表
 )
 
 // 验证输入是否有效并返回错误
@@ -88,6 +93,16 @@ func GetCurrentUserInfo(c *gin.Context) (userInfo models.User, exist bool) {
 	return
 }
 
+// 是否使用API令牌访问，返回令牌的权限列表
+func GetCurrentApiTokenScopes(c *gin.Context) ([]string, bool) {
+	if value, exist := c.Get(GIN_API_TOKEN_SCOPES); exist {
+		if v, ok := value.([]string); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
 // 获取当前访问模式
 func GetCurrentVisitMode(c *gin.Context) (visitMode int) {
 	if value, exist := c.Get(GIN_GET_VISIT_MODE); exist {
@@ -103,7 +118,7 @@ func VerificationCheck(verificationId, vCode string) (errCode int, verificationI
 
 	// 需要进一步验证并返回验证信息
 	if verificationId == "" || vCode == "" {
-		verificationIdRes = cmn.BuildRandCode(16, cmn.RAND_CODE_MODE1)
+		verificationIdRes = cmn.BuildSecureRandCode(16, cmn.RAND_CODE_MODE1)
 		errCode = apiReturn.ERROR_CODE_VERIFICATION_MUST
 		return
 	}
@@ -116,3 +131,39 @@ func VerificationCheck(verificationId, vCode string) (errCode int, verificationI
 	errCode = apiReturn.ERROR_CODE_SUCCESS
 	return
 }
+
+// 验证器验证，未通过时返回错误码和新的验证码ID（前端使用该ID获取验证码图片）
+func VerificationCheckReturn(c *gin.Context, verification commonApiStructs.VerificationRequest) bool {
+	errCode, codeId := VerificationCheck(verification.CodeID, verification.VCode)
+	if errCode == apiReturn.ERROR_CODE_SUCCESS {
+		return true
+	}
+	if codeId == "" {
+		// 验证失败后验证码已作废，需重新获取
+		codeId = cmn.BuildSecureRandCode(16, cmn.RAND_CODE_MODE1)
+	}
+	msg, _ := apiReturn.GetErrorMsgByCode(errCode)
+	apiReturn.ErrorCode(c, errCode, msg, gin.H{
+		"verification": commonApiStructs.VerificationResponse{
+			CodeID:  codeId,
+			Result:  false,
+			Message: msg,
+		},
+	})
+	return false
+}
+
+// 获取站点的外部访问地址（不以/结尾）
+// 优先使用系统设置中的站点地址，未设置时根据当前请求生成
+func GetSiteUrl(c *gin.Context) string {
+	settings := systemSetting.ApplicationSetting{}
+	if err := global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings); err == nil && settings.WebSiteUrl != "" {
+		return strings.TrimRight(settings.WebSiteUrl, "/")
+	}
+
+	scheme := "http://"
+	if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https://"
+	}
+	return scheme + c.Request.Host
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"strings"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/apiToken"
+	"sun-panel/lib/auditLog"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/loginGuard"
+	"sun-panel/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 声明接口允许的API令牌权限，需放在 LoginInterceptor/PublicModeInterceptor 之前
+// 未声明权限的接口只允许拥有admin权限的令牌访问
+func ApiTokenScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(base.GIN_API_TOKEN_REQUIRED_SCOPE, scope)
+	}
+}
+
+// API令牌登录（Authorization: Bearer），返回true表示已处理（已设置用户或已终止请求）
+func apiTokenLogin(c *gin.Context) bool {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || strings.TrimSpace(token) == "" {
+		return false
+	}
+
+	info, err := apiToken.Authenticate(strings.TrimSpace(token))
+	if err != nil {
+		// 无效令牌按IP计入登录防爆破，IP锁定后不再记录审计日志
+		ip := c.ClientIP()
+		if locked, remaining := global.LoginGuard.Check(ip, ""); locked {
+			apiReturn.ErrorCode(c, 1011, apiReturn.ErrorCodeMap[1011], gin.H{"retryAfter": int(remaining.Seconds())})
+			c.Abort()
+			return true
+		}
+		settings := systemSetting.ApplicationSetting{}
+		global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+		auditLog.Record(c, models.User{}, auditLog.ACTION_LOGIN_FAIL, "", nil, nil, gin.H{"method": "api_token", "error": err.Error()})
+		global.LoginGuard.Fail(ip, "", loginGuard.GetPolicy(settings))
+		apiReturn.ErrorCode(c, 1001, err.Error(), nil)
+		c.Abort()
+		return true
+	}
+
+	scopes := apiToken.GetScopes(info)
+	if !apiToken.HasScope(scopes, c.GetString(base.GIN_API_TOKEN_REQUIRED_SCOPE)) {
+		apiReturn.ErrorNoAccess(c)
+		c.Abort()
+		return true
+	}
+
+	mUser := models.User{}
+	userInfo, err := mUser.GetUserInfoByUid(info.UserId)
+	if err != nil || userInfo.Status != 1 {
+		apiReturn.ErrorByCode(c, 1004)
+		c.Abort()
+		return true
+	}
+	userInfo.Password = ""
+	if apiToken.ShouldAuditLogin(info.ID) {
+		auditLog.Record(c, userInfo, auditLog.ACTION_LOGIN, auditLog.TARGET_USER, userInfo.ID, nil, gin.H{"method": "api_token", "tokenId": info.ID})
+	}
+	c.Set("userInfo", userInfo)
+	c.Set(base.GIN_API_TOKEN_SCOPES, scopes)
+	return true
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"errors"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/global"
+	"sun-panel/lib/forwardAuth"
+	"sun-panel/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 反向代理认证，返回true表示已处理（已设置用户或已终止请求）
+// 未启用、请求不是来自可信代理或没有用户头时返回false，继续使用token验证
+func forwardAuthLogin(c *gin.Context) bool {
+	cfg, ok := forwardAuth.GetConfig()
+	if !ok {
+		return false
+	}
+	// 必须使用直接连接的地址判断，X-Forwarded-For 可以伪造
+	identity, ok := forwardAuth.GetIdentity(cfg, c.Request.Header, c.RemoteIP())
+	if !ok {
+		return false
+	}
+
+	_, bToken, err := forwardAuth.GetSession(c, cfg, identity)
+	if err != nil {
+		if errors.Is(err, forwardAuth.ErrUserNotFound) {
+			apiReturn.ErrorByCode(c, 1006)
+		} else if errors.Is(err, forwardAuth.ErrUserDisabled) {
+			apiReturn.ErrorByCode(c, 1004)
+		} else {
+			apiReturn.ErrorDatabase(c, err.Error())
+		}
+		c.Abort()
+		return true
+	}
+
+	if userInfo, success := global.UserToken.Get(bToken); success {
+		c.Set("userInfo", userInfo)
+		return true
+	}
+	mUser := models.User{}
+	info, err := mUser.GetUserInfoByToken(bToken)
+	if err != nil || info.ID == 0 {
+		apiReturn.ErrorCode(c, 1001, global.Lang.Get("login.err_token_expire"), nil)
+		c.Abort()
+		return true
+	}
+	global.UserToken.SetDefault(info.Token, info)
+	c.Set("userInfo", info)
+	return true
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"sun-panel/api/api_v1/common/apiReturn"
 	"sun-panel/global"
+	"sun-panel/lib/session"
 	"sun-panel/models"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +14,16 @@ func LoginInterceptor(c *gin.Context) {
 	// 继续执行后续的操作，再回来
 	// c.Next()
 
+	// API令牌
+	if apiTokenLogin(c) {
+		return
+	}
+
+	// 反向代理认证
+	if forwardAuthLogin(c) {
+		return
+	}
+
 	// 获得token
 	cToken := c.GetHeader("token")
 
@@ -26,7 +37,7 @@ func LoginInterceptor(c *gin.Context) {
 	token := ""
 	{
 		var ok bool
-		token, ok = global.CUserToken.Get(cToken)
+		token, ok = session.Get(cToken)
 		// 可能已经安全退出或者很久没有使用已过期
 		if !ok || token == "" {
 			apiReturn.ErrorByCode(c, 1001)
@@ -52,7 +63,6 @@ func LoginInterceptor(c *gin.Context) {
 	} else {
 		// 通过 设置当前用户信息
 		global.UserToken.SetDefault(info.Token, info)
-		global.CUserToken.SetDefault(cToken, token)
 		c.Set("userInfo", info)
 	}
 
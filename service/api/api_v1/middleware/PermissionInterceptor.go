@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/lib/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 权限验证，需放在 LoginInterceptor/PublicModeInterceptor 之后
+func PermissionInterceptor(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser, _ := base.GetCurrentUserInfo(c)
+		if !permission.Has(currentUser.Role, perm) {
+			apiReturn.ErrorNoAccess(c)
+			c.Abort()
+			return
+		}
+	}
+}
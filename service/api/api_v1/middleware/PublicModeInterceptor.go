@@ -5,6 +5,7 @@ import (
 	"sun-panel/api/api_v1/common/base"
 	"sun-panel/global"
 	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/session"
 	"sun-panel/models"
 
 	"github.com/gin-gonic/gin"
@@ -14,6 +15,16 @@ import (
 // [有token将自动登录，无token/过期将使用公开账号，不可以与LoginInterceptor一起使用]
 func PublicModeInterceptor(c *gin.Context) {
 
+	// API令牌
+	if apiTokenLogin(c) {
+		return
+	}
+
+	// 反向代理认证
+	if forwardAuthLogin(c) {
+		return
+	}
+
 	// 获得token
 	cToken := c.GetHeader("token")
 	token := ""
@@ -21,7 +32,7 @@ func PublicModeInterceptor(c *gin.Context) {
 	// 没有token信息视为未登录
 	if cToken != "" {
 		var ok bool
-		token, ok = global.CUserToken.Get(cToken)
+		token, ok = session.Get(cToken)
 		if ok && token != "" {
 			// 直接返回缓存的用户信息
 			if userInfo, success := global.UserToken.Get(token); success {
@@ -36,7 +47,6 @@ func PublicModeInterceptor(c *gin.Context) {
 					global.Logger.Debug("数据库查询用户:", info.ID)
 					// 通过 设置当前用户信息
 					global.UserToken.SetDefault(info.Token, info)
-					global.CUserToken.SetDefault(cToken, token)
 					c.Set("userInfo", info)
 					return
 				} else {
@@ -7,6 +7,7 @@ import (
 	"sun-panel/api/api_v1/common/apiReturn"
 	"sun-panel/global"
 	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/forwardAuth"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,9 +22,12 @@ func (a *Openness) LoginConfig(c *gin.Context) {
 		apiReturn.Error(c, "配置查询失败："+err.Error())
 		return
 	}
+	_, forwardAuthEnabled := forwardAuth.GetConfig()
 	apiReturn.SuccessData(c, gin.H{
-		"loginCaptcha": cfg.LoginCaptcha,
-		"register":     cfg.Register,
+		"forwardAuth":            forwardAuthEnabled,
+		"loginCaptcha":           cfg.LoginCaptcha,
+		"loginCaptchaAfterFails": cfg.LoginCaptchaAfterFails,
+		"register":               cfg.Register,
 	})
 }
 
@@ -5,4 +5,6 @@ type ApiPanel struct {
 	UserConfig    UserConfig
 	UsersApi      UsersApi
 	ItemIconGroup ItemIconGroup
+	ArchiveApi    ArchiveApi
+	BookmarkApi   BookmarkApi
 }
@@ -28,6 +28,11 @@ func (a *ItemIconGroup) Edit(c *gin.Context) {
 	req.UserId = userInfo.ID
 
 	if req.ID != 0 {
+		// 共享的分组只有所有者可以修改
+		if _, permission := itemIconGroupGetPermission(userInfo, req.ID); permission != models.SHARE_PERMISSION_OWNER {
+			apiReturn.ErrorNoAccess(c)
+			return
+		}
 		// 修改
 		updateField := []string{"IconJson", "Icon", "Title", "Url", "LanUrl", "Description", "OpenMethod", "GroupId", "UserId"}
 		if req.Sort != 0 {
@@ -35,8 +40,9 @@ func (a *ItemIconGroup) Edit(c *gin.Context) {
 		}
 		global.Db.Model(&models.ItemIconGroup{}).
 			Select(updateField).
-			Where("id=?", req.ID).Updates(&req)
+			Where("id=? AND user_id=?", req.ID, userInfo.ID).Updates(&req)
 	} else {
+		req.ConfigKey = "" // 声明式配置的标识只能由配置文件生成
 		// 创建
 		global.Db.Create(&req)
 	}
@@ -83,9 +89,15 @@ func (a *ItemIconGroup) GetList(c *gin.Context) {
 	if err != nil {
 		apiReturn.ErrorDatabase(c, err.Error())
 		return
-	} else {
-		apiReturn.SuccessListData(c, groups, 0)
 	}
+
+	// 共享给当前用户的分组排在自己的分组之后
+	sharedGroups, err := itemIconGroupGetShared(userInfo)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessListData(c, append(groups, sharedGroups...), 0)
 }
 
 func (a *ItemIconGroup) Deletes(c *gin.Context) {
@@ -111,6 +123,16 @@ func (a *ItemIconGroup) Deletes(c *gin.Context) {
 
 	txErr := global.Db.Transaction(func(tx *gorm.DB) error {
 		mitemIcon := models.ItemIcon{}
+		mShare := models.ItemIconGroupShare{}
+
+		// 只能删除自己的分组
+		groupIds := []uint{}
+		if err := tx.Model(&models.ItemIconGroup{}).Where("id in ? AND user_id=?", req.Ids, userInfo.ID).Pluck("id", &groupIds).Error; err != nil {
+			return err
+		}
+		if err := mShare.DeleteByGroupIds(tx, groupIds); err != nil {
+			return err
+		}
 		if err := tx.Delete(&models.ItemIconGroup{}, "id in ? AND user_id=?", req.Ids, userInfo.ID).Error; err != nil {
 			return err
 		}
@@ -0,0 +1,87 @@
+package panel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/apiToken"
+	"sun-panel/lib/cmn"
+	"sun-panel/lib/panelArchive"
+	"sun-panel/lib/panelData"
+	"sun-panel/lib/permission"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 面板导出导入
+type ArchiveApi struct{}
+
+const archiveMaxSize = 200 << 20 // 导入文件最大200M
+
+// 导出当前用户的面板为zip
+func (a *ArchiveApi) Export(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	sourcePath := global.Config.GetValueString("base", "source_path")
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=sun-panel-%s.zip", time.Now().Format("20060102150405")))
+	if err := panelArchive.Export(global.Db, userInfo.ID, sourcePath, c.Writer); err != nil {
+		global.Logger.Errorln("Failed to export panel:", userInfo.ID, err)
+		c.AbortWithStatus(500)
+	}
+}
+
+// 导入zip到当前用户的面板
+// 表单参数：file 文件；mode merge（默认）或 replace；dryRun 为 true 时只返回导入结果不保存
+// 没有上传文件的权限时跳过归档中的文件
+func (a *ArchiveApi) Import(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	mode := c.DefaultPostForm("mode", panelData.MODE_MERGE)
+	if !cmn.InArray([]string{panelData.MODE_MERGE, panelData.MODE_REPLACE}, mode) {
+		apiReturn.ErrorParamFomat(c, "mode must be merge or replace")
+		return
+	}
+	dryRun := c.PostForm("dryRun") == "true"
+
+	f, err := c.FormFile("file")
+	if err != nil {
+		apiReturn.ErrorByCode(c, 1300)
+		return
+	}
+	if f.Size > archiveMaxSize {
+		apiReturn.ErrorParamFomat(c, "the file is too large")
+		return
+	}
+	src, err := f.Open()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, archiveMaxSize))
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	// 保存归档中的文件需要与上传文件相同的权限
+	saveFiles := permission.Has(userInfo.Role, permission.UPLOAD_FILES)
+	if scopes, ok := base.GetCurrentApiTokenScopes(c); ok && !apiToken.HasScope(scopes, apiToken.SCOPE_FILES_WRITE) {
+		saveFiles = false
+	}
+
+	sourcePath := global.Config.GetValueString("base", "source_path")
+	report, err := panelArchive.Import(global.Db, userInfo.ID, data, mode, dryRun, sourcePath, saveFiles)
+	if errors.Is(err, panelArchive.ErrFormat) || errors.Is(err, panelArchive.ErrSchemaVersion) {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	} else if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessData(c, report)
+}
@@ -0,0 +1,287 @@
+package panel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/bookmark"
+	"sun-panel/models"
+	"sun-panel/models/datatype"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 书签导入导出
+type BookmarkApi struct{}
+
+const (
+	bookmarkMaxSize        = 10 << 20         // 导入文件最大10M
+	bookmarkFaviconWorkers = 8                // 同时获取网站图标的数量
+	bookmarkFaviconTimeout = 60 * time.Second // 获取网站图标的总时长，超时后未获取的使用默认图标
+	bookmarkBatchSize      = 100
+)
+
+type bookmarkImportReport struct {
+	Format        string `json:"format"`
+	GroupsCreated int    `json:"groupsCreated"`
+	GroupsMerged  int    `json:"groupsMerged"`
+	ItemsCreated  int    `json:"itemsCreated"`
+	ItemsSkipped  int    `json:"itemsSkipped"`  // 分组内已存在相同地址
+	FaviconFailed int    `json:"faviconFailed"` // 包括超时未获取的
+}
+
+// 待导入的分组，ID为0时需要创建
+type bookmarkImportGroup struct {
+	group models.ItemIconGroup
+	items []models.ItemIcon
+	links []bookmark.Link
+}
+
+// 导入书签到当前用户的面板，同名分组合并，分组内相同地址的链接跳过
+// 表单参数：file 文件；format 格式，默认 auto 自动识别；fetchFavicon 为 true 时获取网站图标（总时长有限制）
+func (a *BookmarkApi) Import(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	format := c.DefaultPostForm("format", bookmark.FORMAT_AUTO)
+	if !slices.Contains(bookmark.Formats, format) {
+		apiReturn.ErrorParamFomat(c, "format must be one of "+strings.Join(bookmark.Formats, ", "))
+		return
+	}
+	fetchFavicon := c.PostForm("fetchFavicon") == "true"
+
+	f, err := c.FormFile("file")
+	if err != nil {
+		apiReturn.ErrorByCode(c, 1300)
+		return
+	}
+	if f.Size > bookmarkMaxSize {
+		apiReturn.ErrorParamFomat(c, "the file is too large")
+		return
+	}
+	src, err := f.Open()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, bookmarkMaxSize))
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	folders, format, err := bookmark.Parse(data, format)
+	if errors.Is(err, bookmark.ErrUnknownFormat) {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	} else if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	report := bookmarkImportReport{Format: format}
+	groups := []models.ItemIconGroup{}
+	if err := global.Db.Order("sort ,created_at").Where("user_id=?", userInfo.ID).Find(&groups).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	groupMap := map[string]models.ItemIconGroup{}
+	for _, v := range groups {
+		if _, ok := groupMap[v.Title]; !ok {
+			groupMap[v.Title] = v
+		}
+	}
+
+	// 分组标题 => 待导入的分组，分组标题 => 已存在的地址
+	imports := map[string]*bookmarkImportGroup{}
+	importTitles := []string{}
+	existUrls := map[string]map[string]bool{}
+	links := []bookmark.Link{}
+	for _, folder := range folders {
+		title := bookmarkTruncate(folder.Title, 50)
+		importGroup, ok := imports[title]
+		if !ok {
+			importGroup = &bookmarkImportGroup{}
+			existUrls[title] = map[string]bool{}
+			if group, ok := groupMap[title]; ok {
+				report.GroupsMerged++
+				importGroup.group = group
+				existItems := []models.ItemIcon{}
+				if err := global.Db.Select("url").Find(&existItems, "item_icon_group_id=? AND user_id=?", group.ID, userInfo.ID).Error; err != nil {
+					apiReturn.ErrorDatabase(c, err.Error())
+					return
+				}
+				for _, v := range existItems {
+					existUrls[title][v.Url] = true
+				}
+			} else {
+				report.GroupsCreated++
+				importGroup.group = models.ItemIconGroup{
+					Title:  title,
+					UserId: userInfo.ID,
+					Icon:   "material-symbols:bookmark-outline",
+				}
+			}
+			imports[title] = importGroup
+			importTitles = append(importTitles, title)
+		}
+
+		for _, link := range folder.Links {
+			link.Url = bookmarkTruncate(link.Url, 1000)
+			if existUrls[title][link.Url] {
+				report.ItemsSkipped++
+				continue
+			}
+			existUrls[title][link.Url] = true
+			importGroup.items = append(importGroup.items, models.ItemIcon{
+				Title:       bookmarkTruncate(link.Title, 50),
+				Url:         link.Url,
+				Description: bookmarkTruncate(link.Description, 1000),
+				OpenMethod:  2,
+				Sort:        9999,
+				UserId:      userInfo.ID,
+			})
+			importGroup.links = append(importGroup.links, link)
+			links = append(links, link)
+		}
+	}
+
+	// 获取网站图标，在写入数据库之前完成
+	icons := make([]string, len(links))
+	if fetchFavicon {
+		report.FaviconFailed = bookmarkFetchFavicons(userInfo.ID, links, icons)
+	}
+	n := 0
+	for _, title := range importTitles {
+		importGroup := imports[title]
+		for i, link := range importGroup.links {
+			item := &importGroup.items[i]
+			switch {
+			case icons[n] != "":
+				item.Icon = datatype.ItemIconIconInfo{ItemType: 2, Src: icons[n]}
+			case link.Icon != "":
+				item.Icon = datatype.ItemIconIconInfo{ItemType: 2, Src: link.Icon}
+			default:
+				// 使用标题首字
+				r, _ := utf8.DecodeRuneInString(link.Title)
+				item.Icon = datatype.ItemIconIconInfo{ItemType: 1, Text: string(r), BackgroundColor: link.Color}
+			}
+			if j, err := json.Marshal(item.Icon); err == nil {
+				item.IconJson = string(j)
+			}
+			n++
+		}
+	}
+
+	// 分组和图标在同一个事务中写入
+	err = global.Db.Transaction(func(tx *gorm.DB) error {
+		items := []models.ItemIcon{}
+		for _, title := range importTitles {
+			importGroup := imports[title]
+			if importGroup.group.ID == 0 {
+				if err := tx.Create(&importGroup.group).Error; err != nil {
+					return err
+				}
+			}
+			for _, item := range importGroup.items {
+				item.ItemIconGroupId = int(importGroup.group.ID)
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(&items, bookmarkBatchSize).Error
+	})
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	report.ItemsCreated = len(links)
+	apiReturn.SuccessData(c, report)
+}
+
+// 并发获取网站图标，结果写入 icons，返回失败的数量
+// 超过 bookmarkFaviconTimeout 后不再获取，未获取的计为失败
+func bookmarkFetchFavicons(userId uint, links []bookmark.Link, icons []string) int {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed int
+	)
+	deadline := time.Now().Add(bookmarkFaviconTimeout)
+	jobs := make(chan int)
+	for w := 0; w < bookmarkFaviconWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				iconUrl, err := "", errors.New("timeout")
+				if time.Now().Before(deadline) {
+					iconUrl, err = itemIconFetchFavicon(userId, links[i].Url)
+				}
+				if err != nil {
+					global.Logger.Debug("Failed to fetch favicon:", links[i].Url, err)
+					mu.Lock()
+					failed++
+					mu.Unlock()
+					continue
+				}
+				icons[i] = iconUrl
+			}
+		}()
+	}
+	for i := range links {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return failed
+}
+
+func bookmarkTruncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
+
+// 导出当前用户的面板为 Netscape 书签 HTML，可导入到浏览器
+func (a *BookmarkApi) Export(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+
+	groups := []models.ItemIconGroup{}
+	if err := global.Db.Order("sort ,created_at").Where("user_id=?", userInfo.ID).Find(&groups).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	folders := []bookmark.Folder{}
+	for _, group := range groups {
+		itemIcons := []models.ItemIcon{}
+		if err := global.Db.Order("sort ,created_at").Find(&itemIcons, "item_icon_group_id = ? AND user_id=?", group.ID, userInfo.ID).Error; err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+		folder := bookmark.Folder{Title: group.Title}
+		for _, v := range itemIcons {
+			folder.Links = append(folder.Links, bookmark.Link{
+				Title:       v.Title,
+				Url:         v.Url,
+				Description: v.Description,
+			})
+		}
+		folders = append(folders, folder)
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=sun-panel-bookmarks-%s.html", time.Now().Format("20060102150405")))
+	c.Data(200, "text/html; charset=utf-8", bookmark.ExportNetscape(folders))
+}
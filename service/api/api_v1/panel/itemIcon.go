@@ -2,6 +2,7 @@ package panel
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
@@ -40,7 +41,13 @@ func (a *ItemIcon) Edit(c *gin.Context) {
 		return
 	}
 
-	req.UserId = userInfo.ID
+	// 需要目标分组的写权限，图标归属于分组的所有者
+	group, permission := itemIconGroupGetPermission(userInfo, uint(req.ItemIconGroupId))
+	if permission < models.SHARE_PERMISSION_WRITE {
+		apiReturn.ErrorNoAccess(c)
+		return
+	}
+	req.UserId = group.UserId
 
 	// json转字符串
 	if j, err := json.Marshal(req.Icon); err == nil {
@@ -48,6 +55,18 @@ func (a *ItemIcon) Edit(c *gin.Context) {
 	}
 
 	if req.ID != 0 {
+		// 修改时同时需要原分组的写权限
+		oldItemIcon := models.ItemIcon{}
+		if err := global.Db.First(&oldItemIcon, "id=?", req.ID).Error; err != nil {
+			apiReturn.ErrorDataNotFound(c)
+			return
+		}
+		if oldItemIcon.ItemIconGroupId != req.ItemIconGroupId {
+			if _, permission := itemIconGroupGetPermission(userInfo, uint(oldItemIcon.ItemIconGroupId)); permission < models.SHARE_PERMISSION_WRITE {
+				apiReturn.ErrorNoAccess(c)
+				return
+			}
+		}
 		// 修改
 		updateField := []string{"IconJson", "Icon", "Title", "Url", "LanUrl", "Description", "OpenMethod", "GroupId", "UserId", "ItemIconGroupId"}
 		if req.Sort != 0 {
@@ -56,8 +75,11 @@ func (a *ItemIcon) Edit(c *gin.Context) {
 		global.Db.Model(&models.ItemIcon{}).
 			Select(updateField).
 			Where("id=?", req.ID).Updates(&req)
+		// 图标地址可能已被修改，健康检查按修改者的角色限制可检查的地址
+		global.Db.Model(&models.ItemIconHealthCheck{}).Where("item_icon_id=?", req.ID).Update("config_user_id", userInfo.ID)
 	} else {
 		req.Sort = 9999
+		req.ConfigKey = "" // 声明式配置的标识只能由配置文件生成
 		// 创建
 		global.Db.Create(&req)
 	}
@@ -65,6 +87,11 @@ func (a *ItemIcon) Edit(c *gin.Context) {
 	apiReturn.SuccessData(c, req)
 }
 
+var (
+	errItemIconGroupMandatory = errors.New("Group is mandatory")
+	errItemIconNoAccess       = errors.New("no access to the group")
+)
+
 // 添加多个图标
 func (a *ItemIcon) AddMultiple(c *gin.Context) {
 	userInfo, _ := base.GetCurrentUserInfo(c)
@@ -76,21 +103,46 @@ func (a *ItemIcon) AddMultiple(c *gin.Context) {
 		return
 	}
 
-	for i := 0; i < len(req); i++ {
-		if req[i].ItemIconGroupId == 0 {
-			apiReturn.ErrorParamFomat(c, "Group is mandatory")
-			return
+	if err := itemIconAddMultiple(global.Db, userInfo, req); err == errItemIconGroupMandatory {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	} else if err == errItemIconNoAccess {
+		apiReturn.ErrorNoAccess(c)
+		return
+	} else if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	apiReturn.SuccessData(c, req)
+}
+
+// 批量添加图标，需要目标分组的写权限，图标归属于分组的所有者
+func itemIconAddMultiple(db *gorm.DB, userInfo models.User, items []models.ItemIcon) error {
+	if len(items) == 0 {
+		return nil
+	}
+	groupOwners := map[int]uint{} // 分组ID => 所有者
+	for i := 0; i < len(items); i++ {
+		if items[i].ItemIconGroupId == 0 {
+			return errItemIconGroupMandatory
+		}
+		if _, ok := groupOwners[items[i].ItemIconGroupId]; !ok {
+			group, permission := itemIconGroupGetPermission(userInfo, uint(items[i].ItemIconGroupId))
+			if permission < models.SHARE_PERMISSION_WRITE {
+				return errItemIconNoAccess
+			}
+			groupOwners[items[i].ItemIconGroupId] = group.UserId
 		}
-		req[i].UserId = userInfo.ID
+		items[i].UserId = groupOwners[items[i].ItemIconGroupId]
+		items[i].ConfigKey = ""
 		// json转字符串
-		if j, err := json.Marshal(req[i].Icon); err == nil {
-			req[i].IconJson = string(j)
+		if j, err := json.Marshal(items[i].Icon); err == nil {
+			items[i].IconJson = string(j)
 		}
 	}
 
-	global.Db.Create(&req)
-
-	apiReturn.SuccessData(c, req)
+	return db.Create(&items).Error
 }
 
 // // 获取详情
@@ -134,13 +186,34 @@ func (a *ItemIcon) GetListByGroupId(c *gin.Context) {
 	userInfo, _ := base.GetCurrentUserInfo(c)
 	itemIcons := []models.ItemIcon{}
 
-	if err := global.Db.Order("sort ,created_at").Find(&itemIcons, "item_icon_group_id = ? AND user_id=?", req.ItemIconGroupId, userInfo.ID).Error; err != nil {
+	group, permission := itemIconGroupGetPermission(userInfo, uint(req.ItemIconGroupId))
+	if permission < models.SHARE_PERMISSION_READ {
+		apiReturn.ErrorNoAccess(c)
+		return
+	}
+
+	if err := global.Db.Order("sort ,created_at").Find(&itemIcons, "item_icon_group_id = ? AND user_id=?", req.ItemIconGroupId, group.UserId).Error; err != nil {
 		apiReturn.ErrorDatabase(c, err.Error())
 		return
 	}
 
+	itemIconIds := []uint{}
 	for k, v := range itemIcons {
 		json.Unmarshal([]byte(v.IconJson), &itemIcons[k].Icon)
+		itemIconIds = append(itemIconIds, v.ID)
+	}
+
+	// 健康检查
+	mItemIconHealthCheck := models.ItemIconHealthCheck{}
+	checks, err := mItemIconHealthCheck.GetMapByItemIconIds(global.Db, itemIconIds)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	for k, v := range itemIcons {
+		if check, ok := checks[v.ID]; ok {
+			itemIcons[k].HealthCheck = &check
+		}
 	}
 
 	apiReturn.SuccessListData(c, itemIcons, 0)
@@ -155,7 +228,36 @@ func (a *ItemIcon) Deletes(c *gin.Context) {
 	}
 
 	userInfo, _ := base.GetCurrentUserInfo(c)
-	if err := global.Db.Delete(&models.ItemIcon{}, "id in ? AND user_id=?", req.Ids, userInfo.ID).Error; err != nil {
+
+	// 需要图标所在分组的写权限
+	itemIcons := []models.ItemIcon{}
+	if err := global.Db.Find(&itemIcons, "id in ?", req.Ids).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	checked := map[int]bool{}
+	for _, v := range itemIcons {
+		if checked[v.ItemIconGroupId] {
+			continue
+		}
+		if _, permission := itemIconGroupGetPermission(userInfo, uint(v.ItemIconGroupId)); permission < models.SHARE_PERMISSION_WRITE {
+			apiReturn.ErrorNoAccess(c)
+			return
+		}
+		checked[v.ItemIconGroupId] = true
+	}
+
+	if err := global.Db.Delete(&models.ItemIcon{}, "id in ?", req.Ids).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	mItemIconHealthCheck := models.ItemIconHealthCheck{}
+	if err := mItemIconHealthCheck.DeleteByItemIconIds(global.Db, req.Ids); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	mItemIconHealthHistory := models.ItemIconHealthHistory{}
+	if err := mItemIconHealthHistory.DeleteByItemIconIds(global.Db, req.Ids); err != nil {
 		apiReturn.ErrorDatabase(c, err.Error())
 		return
 	}
@@ -173,11 +275,16 @@ func (a *ItemIcon) SaveSort(c *gin.Context) {
 	}
 
 	userInfo, _ := base.GetCurrentUserInfo(c)
+	group, permission := itemIconGroupGetPermission(userInfo, req.ItemIconGroupId)
+	if permission < models.SHARE_PERMISSION_WRITE {
+		apiReturn.ErrorNoAccess(c)
+		return
+	}
 
 	transactionErr := global.Db.Transaction(func(tx *gorm.DB) error {
 		// 在事务中执行一些 db 操作（从这里开始，您应该使用 'tx' 而不是 'db'）
 		for _, v := range req.SortItems {
-			if err := tx.Model(&models.ItemIcon{}).Where("user_id=? AND id=? AND item_icon_group_id=?", userInfo.ID, v.Id, req.ItemIconGroupId).Update("sort", v.Sort).Error; err != nil {
+			if err := tx.Model(&models.ItemIcon{}).Where("user_id=? AND id=? AND item_icon_group_id=?", group.UserId, v.Id, req.ItemIconGroupId).Update("sort", v.Sort).Error; err != nil {
 				// 返回任何错误都会回滚事务
 				return err
 			}
@@ -205,18 +312,32 @@ func (a *ItemIcon) GetSiteFavicon(c *gin.Context) {
 		return
 	}
 	resp := panelApiStructs.ItemIconGetSiteFaviconResp{}
-	fullUrl := ""
-	if iconUrl, err := siteFavicon.GetOneFaviconURL(req.Url); err != nil {
-		apiReturn.Error(c, "acquisition failed: get ico error:"+err.Error())
+	iconUrl, err := itemIconFetchFavicon(userInfo.ID, req.Url)
+	if err == errItemIconDatabase {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	} else if err != nil {
+		apiReturn.Error(c, "acquisition failed: "+err.Error())
 		return
+	}
+	resp.IconUrl = iconUrl
+	apiReturn.SuccessData(c, resp)
+}
+
+var errItemIconDatabase = errors.New("failed to save the icon file")
+
+// 获取网站图标并下载到服务器，返回图标的访问地址
+func itemIconFetchFavicon(userId uint, siteUrl string) (string, error) {
+	fullUrl := ""
+	if iconUrl, err := siteFavicon.GetOneFaviconURL(siteUrl); err != nil {
+		return "", errors.New("get ico error:" + err.Error())
 	} else {
 		fullUrl = iconUrl
 	}
 
-	parsedURL, err := url.Parse(req.Url)
+	parsedURL, err := url.Parse(siteUrl)
 	if err != nil {
-		apiReturn.Error(c, "acquisition failed:"+err.Error())
-		return
+		return "", err
 	}
 
 	protocol := parsedURL.Scheme
@@ -235,8 +356,7 @@ func (a *ItemIcon) GetSiteFavicon(c *gin.Context) {
 	{
 		parsedIcoURL, err := url.Parse(fullUrl)
 		if err != nil {
-			apiReturn.Error(c, "acquisition failed: parsed ico URL :"+err.Error())
-			return
+			return "", errors.New("parsed ico URL :" + err.Error())
 		}
 		fullUrl = parsedIcoURL.Scheme + "://" + parsedIcoURL.Host + parsedIcoURL.Path
 	}
@@ -251,22 +371,17 @@ func (a *ItemIcon) GetSiteFavicon(c *gin.Context) {
 	}
 
 	// 下载
-	var imgInfo *os.File
-	{
-		var err error
-		if imgInfo, err = siteFavicon.DownloadImage(fullUrl, savePath, 1024*1024); err != nil {
-			apiReturn.Error(c, "acquisition failed: download"+err.Error())
-			return
-		}
+	imgInfo, err := siteFavicon.DownloadImage(fullUrl, savePath, 1024*1024)
+	if err != nil {
+		return "", errors.New("download" + err.Error())
 	}
 
 	// 保存到数据库
 	ext := path.Ext(fullUrl)
 	mFile := models.File{}
-	if _, err := mFile.AddFile(userInfo.ID, parsedURL.Host, ext, imgInfo.Name()); err != nil {
-		apiReturn.ErrorDatabase(c, err.Error())
-		return
+	if _, err := mFile.AddFile(userId, parsedURL.Host, ext, imgInfo.Name()); err != nil {
+		global.Logger.Errorln("Failed to save the icon file:", err)
+		return "", errItemIconDatabase
 	}
-	resp.IconUrl = imgInfo.Name()[1:]
-	apiReturn.SuccessData(c, resp)
+	return imgInfo.Name()[1:], nil
 }
@@ -0,0 +1,151 @@
+package panel
+
+import (
+	"fmt"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// 获取用户对分组的访问权限，分组不存在时返回 SHARE_PERMISSION_NONE
+func itemIconGroupGetPermission(userInfo models.User, groupId uint) (models.ItemIconGroup, int) {
+	group := models.ItemIconGroup{}
+	if groupId == 0 || global.Db.First(&group, "id=?", groupId).Error != nil {
+		return group, models.SHARE_PERMISSION_NONE
+	}
+	if group.UserId == userInfo.ID {
+		return group, models.SHARE_PERMISSION_OWNER
+	}
+	mShare := models.ItemIconGroupShare{}
+	return group, mShare.GetPermission(groupId, userInfo.ID, userInfo.Role)
+}
+
+// 获取共享给当前用户的分组
+func itemIconGroupGetShared(userInfo models.User) ([]models.ItemIconGroup, error) {
+	mShare := models.ItemIconGroupShare{}
+	permissionMap, err := mShare.GetPermissionMap(userInfo.ID, userInfo.Role)
+	if err != nil || len(permissionMap) == 0 {
+		return []models.ItemIconGroup{}, err
+	}
+	groupIds := []uint{}
+	for id := range permissionMap {
+		groupIds = append(groupIds, id)
+	}
+
+	groups := []models.ItemIconGroup{}
+	if err := global.Db.Preload("User").Order("sort ,created_at").Where("id in ? AND user_id<>?", groupIds, userInfo.ID).Find(&groups).Error; err != nil {
+		return groups, err
+	}
+	for i := range groups {
+		groups[i].Shared = true
+		groups[i].SharePermission = permissionMap[groups[i].ID]
+		groups[i].OwnerName = groups[i].User.Name
+		groups[i].User = models.User{}
+	}
+	return groups, nil
+}
+
+// 获取分组的共享列表（仅所有者）
+func (a *ItemIconGroup) GetShareList(c *gin.Context) {
+	type Req struct {
+		ItemIconGroupId uint `json:"itemIconGroupId" validate:"required"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	if _, permission := itemIconGroupGetPermission(userInfo, req.ItemIconGroupId); permission != models.SHARE_PERMISSION_OWNER {
+		apiReturn.ErrorNoAccess(c)
+		return
+	}
+
+	mShare := models.ItemIconGroupShare{}
+	list, err := mShare.GetListByGroupId(req.ItemIconGroupId)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessListData(c, list, int64(len(list)))
+}
+
+// 保存分组的共享设置（全量覆盖，仅所有者）
+func (a *ItemIconGroup) SaveShare(c *gin.Context) {
+	type ShareItem struct {
+		ShareType  string `json:"shareType" validate:"oneof=user role"`
+		TargetId   uint   `json:"targetId" validate:"required"`
+		Permission int    `json:"permission" validate:"oneof=1 2"`
+	}
+	type Req struct {
+		ItemIconGroupId uint        `json:"itemIconGroupId" validate:"required"`
+		Shares          []ShareItem `json:"shares" validate:"max=200,dive"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	if _, permission := itemIconGroupGetPermission(userInfo, req.ItemIconGroupId); permission != models.SHARE_PERMISSION_OWNER {
+		apiReturn.ErrorNoAccess(c)
+		return
+	}
+
+	// 校验共享对象，相同对象只保留最后一条
+	shares := map[string]models.ItemIconGroupShare{}
+	mRole := models.Role{}
+	for _, v := range req.Shares {
+		if v.ShareType == models.SHARE_TYPE_USER {
+			if v.TargetId == userInfo.ID {
+				continue
+			}
+			if err := global.Db.First(&models.User{}, "id=?", v.TargetId).Error; err != nil {
+				apiReturn.ErrorParamFomat(c, "user does not exist")
+				return
+			}
+		} else if _, err := mRole.GetInfo(v.TargetId); err != nil {
+			apiReturn.ErrorParamFomat(c, "role does not exist")
+			return
+		}
+		shares[fmt.Sprintf("%s_%d", v.ShareType, v.TargetId)] = models.ItemIconGroupShare{
+			ItemIconGroupId: req.ItemIconGroupId,
+			ShareType:       v.ShareType,
+			TargetId:        v.TargetId,
+			Permission:      v.Permission,
+		}
+	}
+
+	txErr := global.Db.Transaction(func(tx *gorm.DB) error {
+		mShare := models.ItemIconGroupShare{}
+		if err := mShare.DeleteByGroupIds(tx, []uint{req.ItemIconGroupId}); err != nil {
+			return err
+		}
+		for _, v := range shares {
+			if err := tx.Create(&v).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if txErr != nil {
+		apiReturn.ErrorDatabase(c, txErr.Error())
+		return
+	}
+	apiReturn.Success(c)
+}
@@ -0,0 +1,185 @@
+package panel
+
+import (
+	"fmt"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/healthCheck"
+	"sun-panel/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"gorm.io/gorm"
+)
+
+// 保存图标的健康检查配置，需要图标所在分组的写权限
+// 配置的用户不是系统管理员时，检查不能连接本机、链路本地和元数据地址
+func (a *ItemIcon) SaveHealthCheck(c *gin.Context) {
+	req := models.ItemIconHealthCheck{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if err := healthCheck.Normalize(&req); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	itemIcon := models.ItemIcon{}
+	if err := global.Db.First(&itemIcon, "id=?", req.ItemIconId).Error; err == gorm.ErrRecordNotFound {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	} else if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	if _, permission := itemIconGroupGetPermission(userInfo, uint(itemIcon.ItemIconGroupId)); permission < models.SHARE_PERMISSION_WRITE {
+		apiReturn.ErrorNoAccess(c)
+		return
+	}
+
+	check := models.ItemIconHealthCheck{
+		ItemIconId:     itemIcon.ID,
+		UserId:         itemIcon.UserId,
+		ConfigUserId:   userInfo.ID,
+		Enabled:        req.Enabled,
+		Type:           req.Type,
+		UseLanUrl:      req.UseLanUrl,
+		Target:         req.Target,
+		Keyword:        req.Keyword,
+		ExpectedStatus: req.ExpectedStatus,
+		CheckInterval:  req.CheckInterval,
+		Timeout:        req.Timeout,
+	}
+	old := models.ItemIconHealthCheck{}
+	if err := global.Db.First(&old, "item_icon_id=?", itemIcon.ID).Error; err == gorm.ErrRecordNotFound {
+		if err := global.Db.Create(&check).Error; err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+	} else if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	} else {
+		// 修改后尽快重新检查
+		if err := global.Db.Model(&models.ItemIconHealthCheck{}).
+			Select("ConfigUserId", "Enabled", "Type", "UseLanUrl", "Target", "Keyword", "ExpectedStatus", "CheckInterval", "Timeout", "NextCheckTime").
+			Where("id=?", old.ID).Updates(&check).Error; err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+		check.ID = old.ID
+		check.Status, check.ResponseTime, check.Message, check.LastCheckTime = old.Status, old.ResponseTime, old.Message, old.LastCheckTime
+	}
+
+	apiReturn.SuccessData(c, check)
+}
+
+// 批量获取图标的健康状态，没有读取权限的图标忽略
+func (a *ItemIcon) GetHealthStatus(c *gin.Context) {
+	type Req struct {
+		ItemIconIds []uint `json:"itemIconIds"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	itemIconIds, err := itemIconHealthFilterReadable(userInfo, req.ItemIconIds)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	mItemIconHealthCheck := models.ItemIconHealthCheck{}
+	checks, err := mItemIconHealthCheck.GetMapByItemIconIds(global.Db, itemIconIds)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	list := []models.ItemIconHealthCheck{}
+	for _, id := range itemIconIds {
+		if v, ok := checks[id]; ok {
+			list = append(list, v)
+		}
+	}
+	apiReturn.SuccessListData(c, list, int64(len(list)))
+}
+
+// 获取图标在时间范围内的在线率、响应时间百分位数和图表数据，默认最近24小时
+// step 为图表数据的间隔（秒），为0时自动选择
+func (a *ItemIcon) GetHealthHistory(c *gin.Context) {
+	type Req struct {
+		ItemIconIds []uint     `json:"itemIconIds" validate:"required,min=1,max=100"`
+		StartTime   *time.Time `json:"startTime"` // RFC3339
+		EndTime     *time.Time `json:"endTime"`
+		Step        int        `json:"step"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	end := time.Now()
+	if req.EndTime != nil {
+		end = *req.EndTime
+	}
+	start := end.Add(-24 * time.Hour)
+	if req.StartTime != nil {
+		start = *req.StartTime
+	}
+	if !start.Before(end) || req.Step < 0 {
+		apiReturn.ErrorParamFomat(c, "startTime must be before endTime and step must not be negative")
+		return
+	}
+	if end.Sub(start) > healthCheck.MAX_HISTORY_RANGE {
+		apiReturn.ErrorParamFomat(c, fmt.Sprintf("time range must not exceed %d days", healthCheck.MAX_HISTORY_RANGE/(24*time.Hour)))
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	itemIconIds, err := itemIconHealthFilterReadable(userInfo, req.ItemIconIds)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	list, err := healthCheck.GetHistory(global.Db, itemIconIds, start, end, time.Duration(req.Step)*time.Second)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessListData(c, list, int64(len(list)))
+}
+
+// 过滤出有读取权限的图标
+func itemIconHealthFilterReadable(userInfo models.User, ids []uint) ([]uint, error) {
+	itemIconIds := []uint{}
+	if len(ids) == 0 {
+		return itemIconIds, nil
+	}
+	itemIcons := []models.ItemIcon{}
+	if err := global.Db.Select("id", "item_icon_group_id").Find(&itemIcons, "id in ?", ids).Error; err != nil {
+		return nil, err
+	}
+	allowed := map[int]bool{}
+	for _, v := range itemIcons {
+		if _, ok := allowed[v.ItemIconGroupId]; !ok {
+			_, permission := itemIconGroupGetPermission(userInfo, uint(v.ItemIconGroupId))
+			allowed[v.ItemIconGroupId] = permission >= models.SHARE_PERMISSION_READ
+		}
+		if allowed[v.ItemIconGroupId] {
+			itemIconIds = append(itemIconIds, v.ID)
+		}
+	}
+	return itemIconIds, nil
+}
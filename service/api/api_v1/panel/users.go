@@ -7,8 +7,12 @@ import (
 	"sun-panel/api/api_v1/common/apiReturn"
 	"sun-panel/api/api_v1/common/base"
 	"sun-panel/global"
-	"sun-panel/lib/cmn"
+	"sun-panel/lib/auditLog"
 	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/panelTemplate"
+	"sun-panel/lib/password"
+	"sun-panel/lib/permission"
+	"sun-panel/lib/session"
 	"sun-panel/models"
 
 	"github.com/gin-gonic/gin"
@@ -36,15 +40,25 @@ func (a UsersApi) Create(c *gin.Context) {
 		return
 	}
 
+	if !usersRoleExist(c, param.Role) || !usersCanManageRole(c, param.Role) {
+		return
+	}
+
 	param.Username = strings.TrimSpace(param.Username)
 	if len(param.Username) < 5 {
 		apiReturn.ErrorParamFomat(c, "The account must be no less than 5 characters long")
 		return
 	}
 
+	encoded, err := password.Hash(param.Password)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
 	mUser := models.User{
 		Username:  strings.TrimSpace(param.Username),
-		Password:  cmn.PasswordEncryption(param.Password),
+		Password:  encoded,
 		Name:      param.Name,
 		HeadImage: param.HeadImage,
 		Status:    1,
@@ -66,6 +80,12 @@ func (a UsersApi) Create(c *gin.Context) {
 		return
 	}
 
+	if err := panelTemplate.ApplyDefault(userInfo.ID); err != nil {
+		global.Logger.Errorln("Failed to apply panel template:", userInfo.ID, err)
+	}
+
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_USER_CREATE, auditLog.TARGET_USER, userInfo.ID, nil, usersAuditData(userInfo))
 	apiReturn.SuccessData(c, gin.H{"userId": userInfo.ID})
 }
 
@@ -79,15 +99,30 @@ func (a UsersApi) Deletes(c *gin.Context) {
 		c.Abort()
 		return
 	}
+	if !usersCanManageUsers(c, param.UserIds...) {
+		return
+	}
+
+	deletedUsers := []models.User{}
+	global.Db.Find(&deletedUsers, "id IN ?", param.UserIds)
 
 	txErr := global.Db.Transaction(func(tx *gorm.DB) error {
 		mitemIconGroup := models.ItemIconGroup{}
+		mItemIconGroupShare := models.ItemIconGroupShare{}
+		mUserTotp := models.UserTotp{}
+		mUserPasskey := models.UserPasskey{}
+		mUserSession := models.UserSession{}
+		mUserApiToken := models.UserApiToken{}
 
 		for _, v := range param.UserIds {
 			// 删除图标
 			if err := tx.Delete(&models.ItemIcon{}, "user_id=?", v).Error; err != nil {
 				return err
 			}
+			// 删除分组共享
+			if err := mItemIconGroupShare.DeleteByUserId(tx, v); err != nil {
+				return err
+			}
 			// 删除分组
 			if err := mitemIconGroup.DeleteByUserId(tx, v); err != nil {
 				return err
@@ -100,6 +135,22 @@ func (a UsersApi) Deletes(c *gin.Context) {
 			if err := tx.Delete(&models.ModuleConfig{}, "user_id=?", v).Error; err != nil {
 				return err
 			}
+			// 删除两步验证
+			if err := mUserTotp.DeleteByUserId(tx, v); err != nil {
+				return err
+			}
+			// 删除通行密钥
+			if err := mUserPasskey.DeleteByUserId(tx, v); err != nil {
+				return err
+			}
+			// 删除登录会话
+			if err := mUserSession.DeleteByUserId(tx, v); err != nil {
+				return err
+			}
+			// 删除API令牌
+			if err := mUserApiToken.DeleteByUserId(tx, v); err != nil {
+				return err
+			}
 			// // 删除文件记录（不删除资源文件）
 			// if err := tx.Delete(&models.File{}, "user_id=?", v).Error; err != nil {
 			// 	return err
@@ -113,7 +164,7 @@ func (a UsersApi) Deletes(c *gin.Context) {
 
 		// 验证是否还存在管理员
 		var count int64
-		if err := tx.Model(&models.User{}).Where("role=?", 1).Count(&count).Error; err != nil {
+		if err := tx.Model(&models.User{}).Where("role=?", models.ROLE_ADMIN).Count(&count).Error; err != nil {
 			return err
 		} else if count == 0 {
 			return ErrUsersApiAtLeastKeepOne
@@ -129,6 +180,10 @@ func (a UsersApi) Deletes(c *gin.Context) {
 		return
 	}
 
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	for _, v := range deletedUsers {
+		auditLog.Record(c, currentUser, auditLog.ACTION_USER_DELETE, auditLog.TARGET_USER, v.ID, usersAuditData(v), nil)
+	}
 	apiReturn.Success(c)
 }
 
@@ -150,6 +205,11 @@ func (a UsersApi) Update(c *gin.Context) {
 		return
 	}
 
+	// 需要可以管理用户当前的角色和新的角色
+	if !usersRoleExist(c, param.Role) || !usersCanManageRole(c, param.Role) || !usersCanManageUsers(c, param.ID) {
+		return
+	}
+
 	param.Username = strings.Trim(param.Username, " ")
 	if len(param.Username) < 3 {
 		// 账号不得少于3个字符
@@ -161,7 +221,12 @@ func (a UsersApi) Update(c *gin.Context) {
 
 	// 密码不为默认“-”空，修改密码
 	if param.Password != "-" {
-		param.Password = cmn.PasswordEncryption(param.Password)
+		encoded, err := password.Hash(param.Password)
+		if err != nil {
+			apiReturn.Error(c, err.Error())
+			return
+		}
+		param.Password = encoded
 		allowField = append(allowField, "Password")
 	}
 
@@ -180,13 +245,29 @@ func (a UsersApi) Update(c *gin.Context) {
 		userInfo = user
 	}
 
+	before := models.User{}
+	if err := global.Db.First(&before, "id=?", param.ID).Error; err != nil {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	}
+
 	param.Token = "" // 修改资料就重置token
 	if err := global.Db.Select(allowField).Where("id=?", param.ID).Updates(&param).Error; err != nil {
 		apiReturn.ErrorDatabase(c, err.Error())
 		return
 	}
+	after := models.User{}
+	global.Db.First(&after, "id=?", param.ID)
+	beforeData, afterData := usersAuditData(before), usersAuditData(after)
+	if param.Password != "-" {
+		afterData["passwordChanged"] = true
+	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_USER_UPDATE, auditLog.TARGET_USER, param.ID, beforeData, afterData)
+
 	// global.Logger.Debug("修改资料清空token", userInfo.Token)
 	global.UserToken.Delete(userInfo.Token) // 更新用户信息
+	session.RevokeAll(param.ID)
 	// 返回token等基本信息
 	apiReturn.SuccessData(c, param)
 }
@@ -256,12 +337,19 @@ func (a UsersApi) SetPublicVisitUser(c *gin.Context) {
 			apiReturn.ErrorDataNotFound(c)
 			return
 		}
+		if !usersCanManageRole(c, userInfo.Role) {
+			return
+		}
 	}
 
+	var before *uint
+	global.SystemSetting.GetValueByInterface(systemSetting.PANEL_PUBLIC_USER_ID, &before)
 	if err := global.SystemSetting.Set(systemSetting.PANEL_PUBLIC_USER_ID, req.UserId); err != nil {
 		apiReturn.Error(c, "set fail")
 		return
 	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_PUBLIC_USER_SET, auditLog.TARGET_SETTING, systemSetting.PANEL_PUBLIC_USER_ID, before, req.UserId)
 	apiReturn.Success(c)
 }
 
@@ -269,8 +357,29 @@ func (a UsersApi) GetPublicVisitUser(c *gin.Context) {
 	var userId *uint
 	if err := global.SystemSetting.GetValueByInterface(systemSetting.PANEL_PUBLIC_USER_ID, &userId); err == nil && userId != nil {
 		userInfo := models.User{}
-		if err := global.Db.First(&userInfo, "id=?", userId).Error; err == nil {
-			apiReturn.SuccessData(c, userInfo)
+		if err := global.Db.Select("id", "username", "name").First(&userInfo, "id=?", userId).Error; err == nil {
+			apiReturn.SuccessData(c, gin.H{
+				"id":       userInfo.ID,
+				"username": userInfo.Username,
+				"name":     userInfo.Name,
+			})
+			return
+		}
+	}
+
+	// 没有此配置
+	apiReturn.ErrorDataNotFound(c)
+}
+
+func (a UsersApi) GetTemplateUser(c *gin.Context) {
+	if userId := panelTemplate.GetTemplateUserId(); userId != 0 {
+		userInfo := models.User{}
+		if err := global.Db.Select("id", "username", "name").First(&userInfo, "id=?", userId).Error; err == nil {
+			apiReturn.SuccessData(c, gin.H{
+				"id":       userInfo.ID,
+				"username": userInfo.Username,
+				"name":     userInfo.Name,
+			})
 			return
 		}
 	}
@@ -278,3 +387,359 @@ func (a UsersApi) GetPublicVisitUser(c *gin.Context) {
 	// 没有此配置
 	apiReturn.ErrorDataNotFound(c)
 }
+
+// 设置新用户的默认面板模板用户，为空取消
+func (a UsersApi) SetTemplateUser(c *gin.Context) {
+	type Req struct {
+		UserId *uint `json:"userId"`
+	}
+
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	if req.UserId != nil {
+		userInfo := models.User{}
+		if err := global.Db.First(&userInfo, "id=?", req.UserId).Error; err != nil {
+			apiReturn.ErrorDataNotFound(c)
+			return
+		}
+		if !usersCanManageRole(c, userInfo.Role) {
+			return
+		}
+	}
+
+	before := panelTemplate.GetTemplateUserId()
+	if err := global.SystemSetting.Set(systemSetting.PANEL_TEMPLATE_USER_ID, req.UserId); err != nil {
+		apiReturn.Error(c, "set fail")
+		return
+	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_SETTING_UPDATE, auditLog.TARGET_SETTING, systemSetting.PANEL_TEMPLATE_USER_ID, before, req.UserId)
+	apiReturn.Success(c)
+}
+
+// 将模板重新应用到指定用户，mode: merge 合并 / replace 替换
+func (a UsersApi) ApplyTemplate(c *gin.Context) {
+	type Req struct {
+		UserIds []uint `json:"userIds" validate:"required,min=1,max=1000"`
+		Mode    string `json:"mode" validate:"oneof=merge replace"`
+	}
+
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	templateUserId := panelTemplate.GetTemplateUserId()
+	if templateUserId == 0 {
+		apiReturn.Error(c, panelTemplate.ErrNoTemplate.Error())
+		return
+	}
+
+	var count int64
+	if err := global.Db.Model(&models.User{}).Where("id in ?", req.UserIds).Count(&count).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	} else if int(count) != len(req.UserIds) {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	}
+	if !usersCanManageUsers(c, req.UserIds...) {
+		return
+	}
+
+	txErr := global.Db.Transaction(func(tx *gorm.DB) error {
+		for _, v := range req.UserIds {
+			if err := panelTemplate.Apply(tx, templateUserId, v, req.Mode); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if txErr != nil {
+		apiReturn.ErrorDatabase(c, txErr.Error())
+		return
+	}
+
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	for _, v := range req.UserIds {
+		auditLog.Record(c, currentUser, auditLog.ACTION_PANEL_TEMPLATE_APPLY, auditLog.TARGET_USER, v, nil, gin.H{"templateUserId": templateUserId, "mode": req.Mode})
+	}
+	apiReturn.Success(c)
+}
+
+// 重置用户的两步验证（用户丢失设备时使用）
+func (a UsersApi) ResetTotp(c *gin.Context) {
+	type Req struct {
+		UserId uint `json:"userId" validate:"required"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	if !usersCanManageUsers(c, req.UserId) {
+		return
+	}
+
+	mUserTotp := models.UserTotp{}
+	if err := mUserTotp.DeleteByUserId(global.Db, req.UserId); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_TOTP_RESET, auditLog.TARGET_USER, req.UserId, nil, nil)
+	apiReturn.Success(c)
+}
+
+func (a UsersApi) GetTotpPolicy(c *gin.Context) {
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	apiReturn.SuccessData(c, gin.H{
+		"adminRequireTotp": settings.AdminRequireTotp,
+	})
+}
+
+// 设置管理员是否必须启用两步验证
+func (a UsersApi) SetTotpPolicy(c *gin.Context) {
+	type Req struct {
+		AdminRequireTotp bool `json:"adminRequireTotp"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	before := gin.H{"adminRequireTotp": settings.AdminRequireTotp}
+	settings.AdminRequireTotp = req.AdminRequireTotp
+	if err := global.SystemSetting.Set(systemSetting.SYSTEM_APPLICATION, settings); err != nil {
+		apiReturn.Error(c, "set fail")
+		return
+	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_SETTING_UPDATE, auditLog.TARGET_SETTING, systemSetting.SYSTEM_APPLICATION, before, req)
+	apiReturn.Success(c)
+}
+
+// 获取用户的登录会话列表
+func (a UsersApi) GetSessions(c *gin.Context) {
+	type Req struct {
+		UserId uint `json:"userId" validate:"required"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	if !usersCanManageUsers(c, req.UserId) {
+		return
+	}
+
+	mUserSession := models.UserSession{}
+	list, err := mUserSession.GetListByUserId(req.UserId)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessListData(c, list, int64(len(list)))
+}
+
+// 吊销用户的某个登录会话
+func (a UsersApi) RevokeSession(c *gin.Context) {
+	type Req struct {
+		UserId uint `json:"userId" validate:"required"`
+		Id     uint `json:"id" validate:"required"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	if !usersCanManageUsers(c, req.UserId) {
+		return
+	}
+
+	if err := session.Revoke(req.UserId, req.Id); err == session.ErrSessionNotFound {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	} else if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_SESSION_REVOKE, auditLog.TARGET_USER, req.UserId, gin.H{"sessionId": req.Id}, nil)
+	apiReturn.Success(c)
+}
+
+// 强制用户退出全部设备
+func (a UsersApi) RevokeAllSessions(c *gin.Context) {
+	type Req struct {
+		UserId uint `json:"userId" validate:"required"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	if !usersCanManageUsers(c, req.UserId) {
+		return
+	}
+
+	if err := session.RevokeAllAndRotate(req.UserId); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_SESSION_REVOKE_ALL, auditLog.TARGET_USER, req.UserId, nil, nil)
+	apiReturn.Success(c)
+}
+
+// 获取当前被锁定的登录（IP/账号）
+func (a UsersApi) GetLoginLocks(c *gin.Context) {
+	list := global.LoginGuard.GetLockedList()
+	apiReturn.SuccessListData(c, list, int64(len(list)))
+}
+
+// 解除登录锁定，keys为空时解除全部
+func (a UsersApi) ClearLoginLocks(c *gin.Context) {
+	type Req struct {
+		Keys []string `json:"keys"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	if len(req.Keys) == 0 {
+		global.LoginGuard.ClearAll()
+	} else {
+		global.LoginGuard.Clear(req.Keys...)
+	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_LOGIN_LOCK_CLEAR, "", nil, nil, req)
+	apiReturn.Success(c)
+}
+
+func (a UsersApi) GetLoginLockPolicy(c *gin.Context) {
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	apiReturn.SuccessData(c, gin.H{
+		"loginMaxFailUsername": settings.LoginMaxFailUsername,
+		"loginMaxFailIp":       settings.LoginMaxFailIp,
+		"loginFailWindow":      settings.LoginFailWindow,
+		"loginLockDuration":    settings.LoginLockDuration,
+	})
+}
+
+// 设置登录锁定阈值，0使用默认值，小于0不限制
+func (a UsersApi) SetLoginLockPolicy(c *gin.Context) {
+	type Req struct {
+		LoginMaxFailUsername int `json:"loginMaxFailUsername"`
+		LoginMaxFailIp       int `json:"loginMaxFailIp"`
+		LoginFailWindow      int `json:"loginFailWindow" validate:"min=0"`
+		LoginLockDuration    int `json:"loginLockDuration" validate:"min=0"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	before := Req{
+		LoginMaxFailUsername: settings.LoginMaxFailUsername,
+		LoginMaxFailIp:       settings.LoginMaxFailIp,
+		LoginFailWindow:      settings.LoginFailWindow,
+		LoginLockDuration:    settings.LoginLockDuration,
+	}
+	settings.LoginMaxFailUsername = req.LoginMaxFailUsername
+	settings.LoginMaxFailIp = req.LoginMaxFailIp
+	settings.LoginFailWindow = req.LoginFailWindow
+	settings.LoginLockDuration = req.LoginLockDuration
+	if err := global.SystemSetting.Set(systemSetting.SYSTEM_APPLICATION, settings); err != nil {
+		apiReturn.Error(c, "set fail")
+		return
+	}
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	auditLog.Record(c, currentUser, auditLog.ACTION_SETTING_UPDATE, auditLog.TARGET_SETTING, systemSetting.SYSTEM_APPLICATION, before, req)
+	apiReturn.Success(c)
+}
+
+// 校验角色是否存在，不存在时返回参数错误
+func usersRoleExist(c *gin.Context, roleId int) bool {
+	mRole := models.Role{}
+	if _, err := mRole.GetInfo(uint(roleId)); err != nil {
+		apiReturn.ErrorParamFomat(c, "role does not exist")
+		return false
+	}
+	return true
+}
+
+// 校验当前用户是否可以分配该角色或管理该角色的用户，不可以时返回无权限
+func usersCanManageRole(c *gin.Context, roleId int) bool {
+	currentUser, _ := base.GetCurrentUserInfo(c)
+	if !permission.CanManageRole(currentUser.Role, roleId) {
+		apiReturn.ErrorNoAccess(c)
+		return false
+	}
+	return true
+}
+
+// 校验当前用户是否可以管理这些用户
+func usersCanManageUsers(c *gin.Context, userIds ...uint) bool {
+	roles := []int{}
+	if err := global.Db.Model(&models.User{}).Where("id in ?", userIds).Distinct().Pluck("role", &roles).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return false
+	}
+	for _, v := range roles {
+		if !usersCanManageRole(c, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// 审计日志中记录的用户字段
+func usersAuditData(info models.User) map[string]interface{} {
+	return map[string]interface{}{
+		"username": info.Username,
+		"name":     info.Name,
+		"mail":     info.Mail,
+		"role":     info.Role,
+		"status":   info.Status,
+	}
+}
@@ -10,4 +10,10 @@ type ApiSystem struct {
 	MonitorApi      MonitorApi
 	SsoApi          SsoApi
 	SsoConfigApi    SsoConfigApi
+	TotpApi         TotpApi
+	PasskeyApi      PasskeyApi
+	SessionApi      SessionApi
+	ApiTokenApi     ApiTokenApi
+	RegisterApi     RegisterApi
+	CaptchaApi      CaptchaApi
 }
@@ -0,0 +1,130 @@
+package system
+
+import (
+	"strings"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/apiToken"
+	"sun-panel/lib/cmn"
+	"sun-panel/lib/permission"
+	"sun-panel/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// API令牌管理
+type ApiTokenApi struct{}
+
+// 获取当前用户的令牌列表
+func (a *ApiTokenApi) GetList(c *gin.Context) {
+	type Item struct {
+		models.UserApiToken
+		Scopes  []string `json:"scopes"`
+		Expired bool     `json:"expired"`
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	mUserApiToken := models.UserApiToken{}
+	list, err := mUserApiToken.GetListByUserId(userInfo.ID)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	items := []Item{}
+	for _, v := range list {
+		items = append(items, Item{
+			UserApiToken: v,
+			Scopes:       apiToken.GetScopes(v),
+			Expired:      v.ExpiresAt != nil && time.Now().After(*v.ExpiresAt),
+		})
+	}
+	apiReturn.SuccessListData(c, items, int64(len(items)))
+}
+
+// 创建令牌，令牌明文只在创建时返回一次
+// expiresInDays 为0时不过期；只有管理员可以创建admin权限的令牌
+func (a *ApiTokenApi) Create(c *gin.Context) {
+	type Req struct {
+		Name          string   `json:"name" validate:"required,max=50"`
+		Scopes        []string `json:"scopes" validate:"required"`
+		ExpiresInDays int      `json:"expiresInDays" validate:"min=0,max=3650"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+	scopes, err := apiToken.NormalizeScopes(req.Scopes)
+	if err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	if !permission.Has(userInfo.Role, permission.MANAGE_SYSTEM) && cmn.InArray(scopes, apiToken.SCOPE_ADMIN) {
+		apiReturn.ErrorNoAccess(c)
+		return
+	}
+
+	token := apiToken.Generate()
+	record := models.UserApiToken{
+		UserId:    userInfo.ID,
+		Name:      req.Name,
+		TokenHash: apiToken.HashToken(token),
+		TokenTail: token[len(token)-4:],
+		Scopes:    strings.Join(scopes, ","),
+	}
+	if req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		record.ExpiresAt = &expiresAt
+	}
+	if err := global.Db.Create(&record).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	apiReturn.SuccessData(c, gin.H{
+		"id":        record.ID,
+		"name":      record.Name,
+		"token":     token,
+		"scopes":    scopes,
+		"expiresAt": record.ExpiresAt,
+	})
+}
+
+// 吊销令牌
+func (a *ApiTokenApi) Revoke(c *gin.Context) {
+	type Req struct {
+		Id uint `json:"id" validate:"required"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	res := global.Db.Unscoped().Delete(&models.UserApiToken{}, "id=? AND user_id=?", req.Id, userInfo.ID)
+	if res.Error != nil {
+		apiReturn.ErrorDatabase(c, res.Error.Error())
+		return
+	}
+	if res.RowsAffected == 0 {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	}
+	apiReturn.Success(c)
+}
@@ -0,0 +1,31 @@
+package system
+
+import (
+	"strconv"
+	"sun-panel/lib/captcha"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 图形验证码
+type CaptchaApi struct{}
+
+// 根据验证码ID获取验证码图片（PNG），ID由需要验证的接口返回
+func (a *CaptchaApi) GetImageByCaptchaId(c *gin.Context) {
+	captchaId := c.Param("captchaId")
+	width, _ := strconv.Atoi(c.Param("width"))
+	height, _ := strconv.Atoi(c.Param("height"))
+	if captchaId == "" || len(captchaId) > 32 {
+		c.Status(400)
+		return
+	}
+	if width <= 0 || width > 400 || height <= 0 || height > 200 {
+		width, height = 120, 40
+	}
+
+	c.Header("Content-Type", "image/png")
+	c.Header("Cache-Control", "no-store")
+	if err := captcha.WriteCaptchaImage(c.Writer, captchaId, width, height); err != nil {
+		c.Status(500)
+	}
+}
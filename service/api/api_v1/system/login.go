@@ -3,12 +3,21 @@ package system
 import (
 	"strconv"
 	"strings"
+	"sun-panel/api/api_v1/common/apiData/commonApiStructs"
 	"sun-panel/api/api_v1/common/apiReturn"
 	"sun-panel/api/api_v1/common/base"
 	"sun-panel/global"
+	"sun-panel/lib/auditLog"
 	"sun-panel/lib/cmn"
 	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/loginGuard"
+	"sun-panel/lib/mail"
+	"sun-panel/lib/password"
+	"sun-panel/lib/permission"
+	"sun-panel/lib/session"
+	"sun-panel/lib/totp"
 	"sun-panel/models"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -18,12 +27,24 @@ import (
 type LoginApi struct {
 }
 
+const (
+	LOGIN_TOTP_TICKET_PREFIX     = "login_totp_" // 两步验证登录凭证缓存前缀
+	LOGIN_TOTP_TICKET_EXPIRATION = 5 * time.Minute
+	LOGIN_TOTP_MAX_FAIL          = 5 // 单个凭证允许的最大错误次数
+
+	RESET_PASSWORD_VCODE_PREFIX     = "reset_password_vcode_" // 重置密码验证码缓存前缀
+	RESET_PASSWORD_VCODE_EXPIRATION = 10 * time.Minute
+	RESET_PASSWORD_VCODE_INTERVAL   = 60 * time.Second // 同一邮箱发送间隔
+	RESET_PASSWORD_VCODE_MAX_FAIL   = 5
+)
+
 // 登录输入验证
 type LoginLoginVerify struct {
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required,max=50"`
-	VCode    string `json:"vcode" validate:"max=6"`
-	Email    string `json:"email"`
+	Username  string `json:"username" validate:"required"`
+	Password  string `json:"password" validate:"required,max=50"`
+	VCode     string `json:"vcode" validate:"max=6"`
+	CaptchaId string `json:"captchaId" validate:"max=32"`
+	Email     string `json:"email"`
 }
 
 // @Summary 登录账号
@@ -47,16 +68,42 @@ func (l LoginApi) Login(c *gin.Context) {
 	settings := systemSetting.ApplicationSetting{}
 	global.SystemSetting.GetValueByInterface("system_application", &settings)
 
-	mUser := models.User{}
 	var (
 		err  error
 		info models.User
 	)
-	bToken := ""
 	param.Username = strings.TrimSpace(param.Username)
-	if info, err = mUser.GetUserInfoByUsernameAndPassword(param.Username, cmn.PasswordEncryption(param.Password)); err != nil {
+
+	// 登录防爆破
+	ip := c.ClientIP()
+	policy := loginGuard.GetPolicy(settings)
+	if locked, remaining := global.LoginGuard.Check(ip, param.Username); locked {
+		loginLockedError(c, remaining)
+		return
+	}
+
+	// 图形验证码
+	captchaRequired := loginCaptchaRequired(settings, ip, param.Username)
+	if captchaRequired {
+		if errCode, _ := base.VerificationCheck(param.CaptchaId, param.VCode); errCode != apiReturn.ERROR_CODE_SUCCESS {
+			loginCaptchaError(c, errCode)
+			return
+		}
+	}
+	time.Sleep(global.LoginGuard.Delay(ip, param.Username, policy))
+
+	if info, err = loginAuthenticate(param.Username, param.Password); err != nil {
 		// 未找到记录 账号或密码错误
 		if err == gorm.ErrRecordNotFound {
+			auditLog.Record(c, models.User{Username: param.Username}, auditLog.ACTION_LOGIN_FAIL, "", nil, nil, nil)
+			if global.LoginGuard.Fail(ip, param.Username, policy) {
+				global.Logger.Warnln("login locked, ip:", ip, "username:", param.Username)
+			}
+			// 告知前端下次登录是否需要验证码
+			if captchaRequired || loginCaptchaRequired(settings, ip, param.Username) {
+				loginCaptchaError(c, 1003)
+				return
+			}
 			apiReturn.ErrorByCode(c, 1003)
 			return
 		} else {
@@ -69,45 +116,357 @@ func (l LoginApi) Login(c *gin.Context) {
 
 	// 停用或未激活
 	if info.Status != 1 {
+		auditLog.Record(c, info, auditLog.ACTION_LOGIN_FAIL, auditLog.TARGET_USER, info.ID, nil, nil)
 		apiReturn.ErrorByCode(c, 1004)
 		return
 	}
 
-	bToken = info.Token
-	if info.Token == "" {
-		// 生成token
-		buildTokenOver := false
-		for !buildTokenOver {
-			bToken = cmn.BuildRandCode(32, cmn.RAND_CODE_MODE2)
-			if _, err := mUser.GetUserInfoByToken(bToken); err != nil {
-				// 保存token
-				mUser.UpdateUserInfoByUserId(info.ID, map[string]interface{}{
-					"token": bToken,
-				})
-				buildTokenOver = true
-			}
+	// 两步验证
+	if required, needSetup := loginTotpRequired(info, settings); required {
+		ticket := uuid.NewString()
+		global.VerifyCodeCachePool.Set(LOGIN_TOTP_TICKET_PREFIX+ticket, strconv.Itoa(int(info.ID)), LOGIN_TOTP_TICKET_EXPIRATION)
+		apiReturn.ErrorCode(c, 1008, "Two-factor authentication required", gin.H{
+			"totpTicket": ticket,
+			"needSetup":  needSetup,
+		})
+		return
+	}
+
+	global.LoginGuard.Success(param.Username)
+	userInfo, err := loginIssueToken(c, info)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessData(c, userInfo)
+}
+
+// 发送重置密码的邮箱验证码
+// 无论邮箱是否存在都返回成功，避免暴露已注册的邮箱
+func (l LoginApi) SendResetPasswordVCode(c *gin.Context) {
+	type Req struct {
+		Email        string                               `json:"email" validate:"required,email,max=50"`
+		Verification commonApiStructs.VerificationRequest `json:"verification"`
+	}
+	req := Req{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	if !base.VerificationCheckReturn(c, req.Verification) {
+		return
+	}
+
+	// 邮箱未配置时对任何邮箱返回相同的错误
+	emailer, err := mail.NewSystemEmailer()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	key := RESET_PASSWORD_VCODE_PREFIX + req.Email
+	if _, ok := global.VerifyCodeCachePool.Get(key + "_interval"); ok {
+		apiReturn.Error(c, "Please wait before requesting another code")
+		return
+	}
+	global.VerifyCodeCachePool.Set(key+"_interval", "1", RESET_PASSWORD_VCODE_INTERVAL)
+
+	userInfo := models.User{}
+	if err := global.Db.First(&userInfo, "mail=? AND status=?", req.Email, 1).Error; err != nil {
+		apiReturn.Success(c)
+		return
+	}
+
+	vcode := cmn.BuildSecureRandCode(6, cmn.RAND_CODE_MODE3)
+	global.VerifyCodeCachePool.Set(key, vcode, RESET_PASSWORD_VCODE_EXPIRATION)
+	global.VerifyCodeCachePool.Delete(key + "_fail")
+
+	// 后台发送，避免通过响应内容或耗时判断邮箱是否存在
+	go func() {
+		if err := mail.SendResetPasswordVCode(emailer, req.Email, vcode); err != nil {
+			global.Logger.Errorln("Failed to send reset password email:", req.Email, err)
 		}
-		info.Token = bToken
+	}()
+
+	apiReturn.Success(c)
+}
+
+// 使用邮箱验证码重置密码，并退出该账号的全部会话
+func (l LoginApi) ResetPasswordByVCode(c *gin.Context) {
+	type Req struct {
+		Email      string `json:"email" validate:"required,email,max=50"`
+		Password   string `json:"password" validate:"required,min=6,max=50"`
+		EmailVCode string `json:"emailVCode" validate:"required,max=10"`
+	}
+	req := Req{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	if !emailVCodeVerify(RESET_PASSWORD_VCODE_PREFIX+req.Email, req.EmailVCode, RESET_PASSWORD_VCODE_MAX_FAIL, RESET_PASSWORD_VCODE_EXPIRATION) {
+		apiReturn.ErrorByCode(c, 1009)
+		return
 	}
+
+	userInfo := models.User{}
+	if err := global.Db.First(&userInfo, "mail=? AND status=?", req.Email, 1).Error; err != nil {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	}
+
+	encoded, err := password.Hash(req.Password)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	if err := global.Db.Model(&models.User{}).Where("id=?", userInfo.ID).Updates(map[string]interface{}{
+		"password": encoded,
+		"token":    "",
+	}).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	// 旧token和全部会话失效，并解除登录锁定
+	global.UserToken.Delete(userInfo.Token)
+	session.RevokeAll(userInfo.ID)
+	global.LoginGuard.Success(userInfo.Username)
+
+	apiReturn.Success(c)
+}
+
+// 登录成功，创建会话并返回用户信息（Token字段为cToken）
+func loginIssueToken(c *gin.Context, info models.User) (models.User, error) {
+	if err := session.EnsureUserToken(&info); err != nil {
+		return info, err
+	}
+	bToken := info.Token
 	info.Password = ""
 	info.ReferralCode = ""
 
 	// global.UserToken.SetDefault(bToken, info)
-	cToken := uuid.NewString() + "-" + cmn.Md5(cmn.Md5("userId"+strconv.Itoa(int(info.ID))))
-	global.CUserToken.SetDefault(cToken, bToken)
+	cToken, err := session.Create(info, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return info, err
+	}
 	global.Logger.Debug("token:", cToken, "|", bToken)
-	global.Logger.Debug(global.CUserToken.Get(cToken))
+
+	auditLog.Record(c, info, auditLog.ACTION_LOGIN, auditLog.TARGET_USER, info.ID, nil, nil)
 
 	// 设置当前用户信息
 	c.Set("userInfo", info)
 	info.Token = cToken // 重要 采用cToken,隐藏真实token
-	apiReturn.SuccessData(c, info)
+	return info, nil
 }
 
 // 安全退出
 func (l *LoginApi) Logout(c *gin.Context) {
-	// userInfo, _ := base.GetCurrentUserInfo(c)
+	userInfo, _ := base.GetCurrentUserInfo(c)
 	cToken := c.GetHeader("token")
-	global.CUserToken.Delete(cToken)
+	session.Delete(cToken)
+	auditLog.Record(c, userInfo, auditLog.ACTION_LOGOUT, auditLog.TARGET_USER, userInfo.ID, nil, nil)
 	apiReturn.Success(c)
 }
+
+// 两步验证登录
+func (l LoginApi) LoginTotp(c *gin.Context) {
+	type Req struct {
+		Ticket string `json:"ticket" validate:"required"`
+		Code   string `json:"code" validate:"required,max=20"`
+	}
+	req := Req{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	info, ok := loginTotpGetTicketUser(req.Ticket)
+	if !ok {
+		apiReturn.ErrorByCode(c, 1010)
+		return
+	}
+
+	// 两步验证失败按账号和IP计入登录防爆破，不受凭证重新申请影响
+	ip := c.ClientIP()
+	if locked, remaining := global.LoginGuard.Check(ip, info.Username); locked {
+		loginLockedError(c, remaining)
+		return
+	}
+
+	mUserTotp := models.UserTotp{}
+	record, err := mUserTotp.GetByUserId(info.ID)
+	if err != nil {
+		apiReturn.ErrorByCode(c, 1009)
+		return
+	}
+
+	// 强制启用但尚未绑定的账号，在登录时完成绑定
+	var recoveryCodes []string
+	if record.Enabled != 1 {
+		if !totpValidateOnce(info.ID, req.Code, record.Secret) {
+			loginTotpFail(c, req.Ticket, info)
+			apiReturn.ErrorByCode(c, 1009)
+			return
+		}
+		codes, hashes, err := totp.GenerateRecoveryCodes()
+		if err != nil {
+			apiReturn.Error(c, err.Error())
+			return
+		}
+		if err := mUserTotp.Enable(info.ID, hashes); err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+		recoveryCodes = codes
+	} else if !totpVerify(info.ID, record, req.Code) {
+		loginTotpFail(c, req.Ticket, info)
+		apiReturn.ErrorByCode(c, 1009)
+		return
+	}
+
+	global.VerifyCodeCachePool.Delete(LOGIN_TOTP_TICKET_PREFIX + req.Ticket)
+	global.VerifyCodeCachePool.Delete(LOGIN_TOTP_TICKET_PREFIX + req.Ticket + "_fail")
+	global.LoginGuard.Success(info.Username)
+	userInfo, err := loginIssueToken(c, info)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	if recoveryCodes != nil {
+		// 首次绑定，返回恢复码（仅展示一次）
+		apiReturn.SuccessData(c, struct {
+			models.User
+			RecoveryCodes []string `json:"recoveryCodes"`
+		}{userInfo, recoveryCodes})
+		return
+	}
+	apiReturn.SuccessData(c, userInfo)
+}
+
+// 登录时绑定两步验证（管理员强制启用时）
+func (l LoginApi) LoginTotpSetup(c *gin.Context) {
+	type Req struct {
+		Ticket string `json:"ticket" validate:"required"`
+	}
+	req := Req{}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	info, ok := loginTotpGetTicketUser(req.Ticket)
+	if !ok {
+		apiReturn.ErrorByCode(c, 1010)
+		return
+	}
+
+	mUserTotp := models.UserTotp{}
+	if mUserTotp.IsEnabled(info.ID) {
+		apiReturn.ErrorNoAccess(c)
+		return
+	}
+
+	key, err := totpSetupPending(info)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	apiReturn.SuccessData(c, key)
+}
+
+// 是否需要两步验证，needSetup表示需要先绑定
+func loginTotpRequired(info models.User, settings systemSetting.ApplicationSetting) (required bool, needSetup bool) {
+	mUserTotp := models.UserTotp{}
+	if mUserTotp.IsEnabled(info.ID) {
+		return true, false
+	}
+	if settings.AdminRequireTotp && permission.Has(info.Role, permission.MANAGE_SYSTEM) {
+		return true, true
+	}
+	return false, false
+}
+
+func loginTotpGetTicketUser(ticket string) (models.User, bool) {
+	userId, ok := global.VerifyCodeCachePool.Get(LOGIN_TOTP_TICKET_PREFIX + ticket)
+	if !ok || userId == "" {
+		return models.User{}, false
+	}
+	mUser := models.User{}
+	info, err := mUser.GetUserInfoByUid(cmn.StrToUint(userId))
+	if err != nil || info.Status != 1 {
+		return models.User{}, false
+	}
+	return info, true
+}
+
+// 记录失败次数，计入账号和IP的失败记录，单个凭证超过限制后作废
+func loginTotpFail(c *gin.Context, ticket string, info models.User) {
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface("system_application", &settings)
+	ip := c.ClientIP()
+	auditLog.Record(c, info, auditLog.ACTION_LOGIN_FAIL, auditLog.TARGET_USER, info.ID, nil, nil)
+	if global.LoginGuard.Fail(ip, info.Username, loginGuard.GetPolicy(settings)) {
+		global.Logger.Warnln("login locked, ip:", ip, "username:", info.Username)
+		global.VerifyCodeCachePool.Delete(LOGIN_TOTP_TICKET_PREFIX + ticket)
+		global.VerifyCodeCachePool.Delete(LOGIN_TOTP_TICKET_PREFIX + ticket + "_fail")
+		return
+	}
+
+	key := LOGIN_TOTP_TICKET_PREFIX + ticket + "_fail"
+	times := 1
+	if v, ok := global.VerifyCodeCachePool.Get(key); ok {
+		times = cmn.StrToInt(v) + 1
+	}
+	if times >= LOGIN_TOTP_MAX_FAIL {
+		global.VerifyCodeCachePool.Delete(LOGIN_TOTP_TICKET_PREFIX + ticket)
+		global.VerifyCodeCachePool.Delete(key)
+		return
+	}
+	global.VerifyCodeCachePool.Set(key, strconv.Itoa(times), LOGIN_TOTP_TICKET_EXPIRATION)
+}
+
+func loginLockedError(c *gin.Context, remaining time.Duration) {
+	apiReturn.ErrorCode(c, 1011, apiReturn.ErrorCodeMap[1011], gin.H{
+		"retryAfter": int(remaining.Seconds()),
+	})
+}
+
+// 返回错误并下发新的图形验证码ID，前端通过 /captcha/getImageByCaptchaId 获取图片
+func loginCaptchaError(c *gin.Context, errCode int) {
+	msg, _ := apiReturn.GetErrorMsgByCode(errCode)
+	apiReturn.ErrorCode(c, errCode, msg, gin.H{
+		"captchaRequired": true,
+		"verification": commonApiStructs.VerificationResponse{
+			CodeID:  cmn.BuildSecureRandCode(16, cmn.RAND_CODE_MODE1),
+			Result:  false,
+			Message: msg,
+		},
+	})
+}
+
+// 是否需要图形验证码，自适应模式下仅在失败达到次数后需要
+func loginCaptchaRequired(settings systemSetting.ApplicationSetting, ip, username string) bool {
+	if !settings.LoginCaptcha {
+		return false
+	}
+	if settings.LoginCaptchaAfterFails <= 0 {
+		return true
+	}
+	return global.LoginGuard.Fails(ip, username) >= settings.LoginCaptchaAfterFails
+}
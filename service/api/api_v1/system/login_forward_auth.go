@@ -0,0 +1,50 @@
+package system
+
+import (
+	"errors"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/lib/auditLog"
+	"sun-panel/lib/forwardAuth"
+	"sun-panel/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 反向代理认证登录，返回与账号密码登录相同的用户信息和token
+// 请求不是来自可信代理或没有用户头时返回未登录
+func (l LoginApi) ForwardAuth(c *gin.Context) {
+	cfg, ok := forwardAuth.GetConfig()
+	if !ok {
+		apiReturn.ErrorByCode(c, 1000)
+		return
+	}
+	identity, ok := forwardAuth.GetIdentity(cfg, c.Request.Header, c.RemoteIP())
+	if !ok {
+		apiReturn.ErrorByCode(c, 1000)
+		return
+	}
+
+	cToken, bToken, err := forwardAuth.GetSession(c, cfg, identity)
+	if err != nil {
+		auditLog.Record(c, models.User{Username: identity.Username}, auditLog.ACTION_LOGIN_FAIL, "", nil, nil, gin.H{"method": forwardAuth.PROVIDER})
+		if errors.Is(err, forwardAuth.ErrUserNotFound) {
+			apiReturn.ErrorByCode(c, 1006)
+		} else if errors.Is(err, forwardAuth.ErrUserDisabled) {
+			apiReturn.ErrorByCode(c, 1004)
+		} else {
+			apiReturn.ErrorDatabase(c, err.Error())
+		}
+		return
+	}
+
+	mUser := models.User{}
+	info, err := mUser.GetUserInfoByToken(bToken)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	info.Password = ""
+	info.ReferralCode = ""
+	info.Token = cToken // 采用cToken,隐藏真实token
+	apiReturn.SuccessData(c, info)
+}
@@ -0,0 +1,89 @@
+package system
+
+import (
+	"errors"
+	"strings"
+	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/externalUser"
+	"sun-panel/lib/ldapAuth"
+	"sun-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// LDAP账号在 UserAuth 中的提供商名称
+const LDAP_PROVIDER = "ldap"
+
+// 账号密码验证：先验证本地账号，未通过时使用LDAP
+// 已存在且未关联LDAP的本地账号只使用本地密码，避免同名的LDAP账号登录
+// 账号或密码错误返回 gorm.ErrRecordNotFound
+func loginAuthenticate(username, password string) (models.User, error) {
+	mUser := models.User{}
+	info, err := mUser.GetUserInfoByUsernameAndPassword(username, password)
+	if err != gorm.ErrRecordNotFound {
+		return info, err
+	}
+
+	ldapSetting := systemSetting.Ldap{}
+	if err := global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_LDAP, &ldapSetting); err != nil || !ldapSetting.Enabled {
+		return info, gorm.ErrRecordNotFound
+	}
+	if localUser, err := mUser.GetUserInfoByUsername(username); err == nil {
+		mUserAuth := models.UserAuth{}
+		if err := global.Db.First(&mUserAuth, "user_id=? AND provider=?", localUser.ID, LDAP_PROVIDER).Error; err != nil {
+			return info, gorm.ErrRecordNotFound
+		}
+	}
+
+	ldapUser, err := ldapAuth.Authenticate(ldapSetting, username, password)
+	if err != nil {
+		if errors.Is(err, ldapAuth.ErrInvalidCredentials) {
+			return info, gorm.ErrRecordNotFound
+		}
+		global.Logger.Errorln("LDAP authentication error:", err)
+		return info, errors.New("LDAP server error")
+	}
+	return loginLdapUser(ldapSetting, ldapUser)
+}
+
+// 获取LDAP账号关联的本地用户，不存在时创建，并同步管理员角色
+func loginLdapUser(ldapSetting systemSetting.Ldap, ldapUser ldapAuth.User) (models.User, error) {
+	mUser := models.User{}
+	mUserAuth := models.UserAuth{}
+	uid := strings.ToLower(ldapUser.Username)
+
+	role := 0
+	if ldapSetting.AdminGroupFilter != "" {
+		role = models.ROLE_USER
+		if ldapUser.IsAdmin {
+			role = models.ROLE_ADMIN
+		}
+	}
+
+	var (
+		info models.User
+		err  error
+	)
+	if authRec, err := mUserAuth.GetByProviderAndUid(LDAP_PROVIDER, uid); err == nil {
+		if info, err = mUser.GetUserInfoByUid(authRec.UserId); err != nil {
+			return info, err
+		}
+	} else {
+		profile := externalUser.Profile{
+			Uid:      uid,
+			Username: ldapUser.Username,
+			Name:     ldapUser.Name,
+			Email:    ldapUser.Email,
+		}
+		if info, err = externalUser.Create(LDAP_PROVIDER, profile, role); err != nil {
+			return info, err
+		}
+		if err := global.Db.Create(&models.UserAuth{UserId: info.ID, Provider: LDAP_PROVIDER, ProviderUid: uid}).Error; err != nil {
+			return info, err
+		}
+	}
+
+	err = externalUser.SyncRole(&info, role)
+	return info, err
+}
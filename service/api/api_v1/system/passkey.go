@@ -0,0 +1,349 @@
+package system
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"sun-panel/api/api_v1/common/apiData/commonApiStructs"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/cmn"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+)
+
+// 通行密钥(WebAuthn)
+type PasskeyApi struct{}
+
+const (
+	PASSKEY_SESSION_PREFIX     = "passkey_session_" // 注册/登录过程数据缓存前缀
+	PASSKEY_SESSION_EXPIRATION = 5 * time.Minute
+)
+
+type passkeyFinishReq struct {
+	SessionId  string          `json:"sessionId" validate:"required"`
+	Name       string          `json:"name" validate:"max=50"`
+	Credential json.RawMessage `json:"credential" validate:"required"`
+}
+
+// WebAuthn 用户适配
+type passkeyUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(strconv.Itoa(int(u.user.ID)))
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.Name != "" {
+		return u.user.Name
+	}
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (u *passkeyUser) WebAuthnIcon() string {
+	return ""
+}
+
+// 开始注册通行密钥
+func (a *PasskeyApi) RegisterBegin(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	w, err := passkeyWebAuthn()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	user, _, err := passkeyLoadUser(userInfo)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	exclusions := []protocol.CredentialDescriptor{}
+	for _, v := range user.credentials {
+		exclusions = append(exclusions, v.Descriptor())
+	}
+
+	creation, session, err := w.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	sessionId := passkeySaveSession(session)
+	apiReturn.SuccessData(c, gin.H{
+		"sessionId": sessionId,
+		"options":   creation,
+	})
+}
+
+// 完成注册通行密钥
+func (a *PasskeyApi) RegisterFinish(c *gin.Context) {
+	req := passkeyFinishReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	session, ok := passkeyTakeSession(req.SessionId)
+	if !ok {
+		apiReturn.ErrorByCode(c, 1010)
+		return
+	}
+
+	w, err := passkeyWebAuthn()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	user, _, err := passkeyLoadUser(userInfo)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	credential, err := w.CreateCredential(user, session, parsed)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	credentialJson, _ := json.Marshal(credential)
+	if req.Name == "" {
+		req.Name = "Passkey " + time.Now().Format(cmn.TimeFormatMode4)
+	}
+	passkey := models.UserPasskey{
+		UserId:         userInfo.ID,
+		Name:           req.Name,
+		CredentialId:   base64.RawURLEncoding.EncodeToString(credential.ID),
+		CredentialJson: string(credentialJson),
+	}
+	if err := global.Db.Create(&passkey).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	apiReturn.SuccessData(c, passkey)
+}
+
+// 获取当前用户的通行密钥列表
+func (a *PasskeyApi) GetList(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	mUserPasskey := models.UserPasskey{}
+	list, err := mUserPasskey.GetListByUserId(userInfo.ID)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessListData(c, list, int64(len(list)))
+}
+
+// 删除（吊销）通行密钥
+func (a *PasskeyApi) Deletes(c *gin.Context) {
+	req := commonApiStructs.RequestDeleteIds[uint]{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	if err := global.Db.Unscoped().Delete(&models.UserPasskey{}, "id in ? AND user_id=?", req.Ids, userInfo.ID).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.Success(c)
+}
+
+// 开始通行密钥登录（可发现凭证，无需输入账号）
+func (a *PasskeyApi) LoginBegin(c *gin.Context) {
+	w, err := passkeyWebAuthn()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	assertion, session, err := w.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationPreferred))
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	sessionId := passkeySaveSession(session)
+	apiReturn.SuccessData(c, gin.H{
+		"sessionId": sessionId,
+		"options":   assertion,
+	})
+}
+
+// 完成通行密钥登录，返回与密码登录相同的用户信息与token
+func (a *PasskeyApi) LoginFinish(c *gin.Context) {
+	req := passkeyFinishReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	session, ok := passkeyTakeSession(req.SessionId)
+	if !ok {
+		apiReturn.ErrorByCode(c, 1010)
+		return
+	}
+
+	w, err := passkeyWebAuthn()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(req.Credential))
+	if err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+
+	var (
+		loginUser    models.User
+		passkeyIndex map[string]models.UserPasskey
+	)
+	credential, err := w.ValidateDiscoverableLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		mUser := models.User{}
+		info, err := mUser.GetUserInfoByUid(cmn.StrToUint(string(userHandle)))
+		if err != nil {
+			return nil, err
+		}
+		user, index, err := passkeyLoadUser(info)
+		if err != nil {
+			return nil, err
+		}
+		loginUser = info
+		passkeyIndex = index
+		return user, nil
+	}, session, parsed)
+	if err != nil {
+		apiReturn.ErrorByCode(c, 1003)
+		return
+	}
+
+	// 停用或未激活
+	if loginUser.Status != 1 {
+		apiReturn.ErrorByCode(c, 1004)
+		return
+	}
+
+	// 更新签名计数
+	if passkey, ok := passkeyIndex[base64.RawURLEncoding.EncodeToString(credential.ID)]; ok {
+		credentialJson, _ := json.Marshal(credential)
+		mUserPasskey := models.UserPasskey{}
+		mUserPasskey.UpdateCredential(passkey.ID, string(credentialJson))
+	}
+
+	userInfo, err := loginIssueToken(c, loginUser)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessData(c, userInfo)
+}
+
+// 根据系统设置的站点地址创建WebAuthn实例
+// RP ID 不能使用请求的 Host 等可伪造的请求头，未设置站点地址时不可使用通行密钥
+func passkeyWebAuthn() (*webauthn.WebAuthn, error) {
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	if settings.WebSiteUrl == "" {
+		return nil, errors.New("passkeys require the site url to be set in system settings")
+	}
+	origin := strings.TrimRight(settings.WebSiteUrl, "/")
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return nil, errors.New("invalid site url: " + origin)
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: TOTP_ISSUER,
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+	})
+}
+
+// 加载用户及其全部凭证，返回以凭证ID为键的索引
+func passkeyLoadUser(info models.User) (*passkeyUser, map[string]models.UserPasskey, error) {
+	mUserPasskey := models.UserPasskey{}
+	list, err := mUserPasskey.GetListByUserId(info.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := &passkeyUser{user: info}
+	index := map[string]models.UserPasskey{}
+	for _, v := range list {
+		credential := webauthn.Credential{}
+		if err := json.Unmarshal([]byte(v.CredentialJson), &credential); err != nil {
+			continue
+		}
+		user.credentials = append(user.credentials, credential)
+		index[v.CredentialId] = v
+	}
+	return user, index, nil
+}
+
+func passkeySaveSession(session *webauthn.SessionData) string {
+	sessionId := uuid.NewString()
+	b, _ := json.Marshal(session)
+	global.VerifyCodeCachePool.Set(PASSKEY_SESSION_PREFIX+sessionId, string(b), PASSKEY_SESSION_EXPIRATION)
+	return sessionId
+}
+
+// 取出并删除过程数据，每个过程只能使用一次
+func passkeyTakeSession(sessionId string) (webauthn.SessionData, bool) {
+	session := webauthn.SessionData{}
+	v, ok := global.VerifyCodeCachePool.Get(PASSKEY_SESSION_PREFIX + sessionId)
+	if !ok {
+		return session, false
+	}
+	global.VerifyCodeCachePool.Delete(PASSKEY_SESSION_PREFIX + sessionId)
+	if err := json.Unmarshal([]byte(v), &session); err != nil {
+		return session, false
+	}
+	return session, true
+}
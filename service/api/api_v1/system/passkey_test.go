@@ -0,0 +1,292 @@
+package system
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sun-panel/global"
+	"sun-panel/lib/cache"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const passkeyTestSiteUrl = "https://panel.example.org"
+
+// 软件认证器：ES256密钥，none 格式的证明
+type testAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialId []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newTestAuthenticator(t *testing.T) *testAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credentialId := make([]byte, 16)
+	rand.Read(credentialId)
+	return &testAuthenticator{key: key, credentialId: credentialId}
+}
+
+func (a *testAuthenticator) clientData(t *testing.T, typ string, challenge protocol.URLEncodedBase64, origin string) []byte {
+	t.Helper()
+	data, err := json.Marshal(gin.H{"type": typ, "challenge": challenge.String(), "origin": origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// 认证器数据，attested 为true时包含凭证公钥
+func (a *testAuthenticator) authData(t *testing.T, rpId string, attested bool) []byte {
+	t.Helper()
+	rpIdHash := sha256.Sum256([]byte(rpId))
+	flags := byte(protocol.FlagUserPresent | protocol.FlagUserVerified)
+	if attested {
+		flags |= byte(protocol.FlagAttestedCredentialData)
+	}
+	a.signCount++
+	data := append(rpIdHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if !attested {
+		return data
+	}
+
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = append(data, make([]byte, 16)...) // AAGUID
+	data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialId)))
+	data = append(data, a.credentialId...)
+	return append(data, publicKey...)
+}
+
+// navigator.credentials.create 的结果
+func (a *testAuthenticator) create(t *testing.T, options protocol.CredentialCreation, origin string) json.RawMessage {
+	t.Helper()
+	a.userHandle = options.Response.User.ID.(protocol.URLEncodedBase64)
+	attestationObject, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": a.authData(t, options.Response.RelyingParty.ID, true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := json.Marshal(gin.H{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialId),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": gin.H{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(a.clientData(t, "webauthn.create", options.Response.Challenge, origin)),
+			"attestationObject": base64.RawURLEncoding.EncodeToString(attestationObject),
+		},
+	})
+	return res
+}
+
+// navigator.credentials.get 的结果
+func (a *testAuthenticator) get(t *testing.T, options protocol.CredentialAssertion, rpId, origin string) json.RawMessage {
+	t.Helper()
+	authData := a.authData(t, rpId, false)
+	clientData := a.clientData(t, "webauthn.get", options.Response.Challenge, origin)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := json.Marshal(gin.H{
+		"id":    base64.RawURLEncoding.EncodeToString(a.credentialId),
+		"rawId": base64.RawURLEncoding.EncodeToString(a.credentialId),
+		"type":  "public-key",
+		"response": gin.H{
+			"clientDataJSON":    base64.RawURLEncoding.EncodeToString(clientData),
+			"authenticatorData": base64.RawURLEncoding.EncodeToString(authData),
+			"signature":         base64.RawURLEncoding.EncodeToString(signature),
+			"userHandle":        base64.RawURLEncoding.EncodeToString(a.userHandle),
+		},
+	})
+	return res
+}
+
+type passkeyTestResponse struct {
+	Code int             `json:"code"`
+	Msg  string          `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// 调用接口，user 不为空时作为当前登录用户
+func passkeyTestCall(t *testing.T, handler gin.HandlerFunc, user *models.User, body interface{}, header http.Header) passkeyTestResponse {
+	t.Helper()
+	b, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(b))
+	c.Request.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		c.Request.Header[k] = v
+	}
+	if host := header.Get("Host"); host != "" {
+		c.Request.Host = host
+	}
+	if user != nil {
+		c.Set("userInfo", *user)
+	}
+	handler(c)
+
+	res := passkeyTestResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("invalid response %q: %v", w.Body.String(), err)
+	}
+	return res
+}
+
+func setupPasskeyTest(t *testing.T) models.User {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDb.Close() })
+	if err := db.AutoMigrate(&models.User{}, &models.UserPasskey{}, &models.UserSession{}, &models.AuditLog{}, &models.SystemSetting{}); err != nil {
+		t.Fatal(err)
+	}
+	models.Db, global.Db = db, db
+	global.Logger = zap.NewNop().Sugar()
+	global.VerifyCodeCachePool = cache.NewGoCache[string](10*time.Minute, time.Minute)
+	global.UserToken = cache.NewGoCache[models.User](10*time.Minute, time.Minute)
+	global.CUserToken = cache.NewGoCache[string](10*time.Minute, time.Minute)
+	global.SystemSetting = &systemSetting.SystemSettingCache{Cache: cache.NewGoCache[interface{}](10*time.Minute, time.Minute)}
+
+	user := models.User{Username: "alice", Name: "Alice", Status: 1, Role: 2}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestPasskeyRequiresSiteUrl(t *testing.T) {
+	user := setupPasskeyTest(t)
+	api := &PasskeyApi{}
+
+	// 未设置站点地址时不使用请求头中的 Host
+	header := http.Header{"X-Forwarded-Proto": {"https"}}
+	if res := passkeyTestCall(t, api.RegisterBegin, &user, gin.H{}, header); res.Code == 0 {
+		t.Error("RegisterBegin should fail when the site url is not set")
+	}
+	if res := passkeyTestCall(t, api.LoginBegin, nil, gin.H{}, header); res.Code == 0 {
+		t.Error("LoginBegin should fail when the site url is not set")
+	}
+}
+
+func TestPasskeyRegisterAndLogin(t *testing.T) {
+	user := setupPasskeyTest(t)
+	if err := global.SystemSetting.Set(systemSetting.SYSTEM_APPLICATION, systemSetting.ApplicationSetting{WebSiteUrl: passkeyTestSiteUrl + "/"}); err != nil {
+		t.Fatal(err)
+	}
+	api := &PasskeyApi{}
+	authenticator := newTestAuthenticator(t)
+
+	// 注册
+	res := passkeyTestCall(t, api.RegisterBegin, &user, gin.H{}, nil)
+	if res.Code != 0 {
+		t.Fatalf("RegisterBegin: %d %s", res.Code, res.Msg)
+	}
+	begin := struct {
+		SessionId string                      `json:"sessionId"`
+		Options   protocol.CredentialCreation `json:"options"`
+	}{}
+	json.Unmarshal(res.Data, &begin)
+	if begin.Options.Response.RelyingParty.ID != "panel.example.org" {
+		t.Errorf("RP ID = %q, want panel.example.org", begin.Options.Response.RelyingParty.ID)
+	}
+	// user.id 反序列化为字符串，转换为字节
+	userId, _ := base64.RawURLEncoding.DecodeString(begin.Options.Response.User.ID.(string))
+	begin.Options.Response.User.ID = protocol.URLEncodedBase64(userId)
+	if string(userId) != strconv.Itoa(int(user.ID)) {
+		t.Errorf("user handle = %q, want %d", userId, user.ID)
+	}
+
+	credential := authenticator.create(t, begin.Options, passkeyTestSiteUrl)
+	res = passkeyTestCall(t, api.RegisterFinish, &user, gin.H{"sessionId": begin.SessionId, "name": "test key", "credential": credential}, nil)
+	if res.Code != 0 {
+		t.Fatalf("RegisterFinish: %d %s", res.Code, res.Msg)
+	}
+	// 注册过程只能使用一次
+	if res := passkeyTestCall(t, api.RegisterFinish, &user, gin.H{"sessionId": begin.SessionId, "credential": credential}, nil); res.Code != 1010 {
+		t.Errorf("RegisterFinish with a used session: code = %d, want 1010", res.Code)
+	}
+
+	login := func(origin string, header http.Header) passkeyTestResponse {
+		res := passkeyTestCall(t, api.LoginBegin, nil, gin.H{}, header)
+		if res.Code != 0 {
+			t.Fatalf("LoginBegin: %d %s", res.Code, res.Msg)
+		}
+		begin := struct {
+			SessionId string                       `json:"sessionId"`
+			Options   protocol.CredentialAssertion `json:"options"`
+		}{}
+		json.Unmarshal(res.Data, &begin)
+		credential := authenticator.get(t, begin.Options, "panel.example.org", origin)
+		return passkeyTestCall(t, api.LoginFinish, nil, gin.H{"sessionId": begin.SessionId, "credential": credential}, header)
+	}
+
+	// 登录
+	res = login(passkeyTestSiteUrl, nil)
+	if res.Code != 0 {
+		t.Fatalf("LoginFinish: %d %s", res.Code, res.Msg)
+	}
+	info := models.User{}
+	json.Unmarshal(res.Data, &info)
+	if info.ID != user.ID || info.Token == "" {
+		t.Errorf("LoginFinish returned %+v, want user %d with a token", info, user.ID)
+	}
+	passkey := models.UserPasskey{}
+	global.Db.First(&passkey, "user_id=?", user.ID)
+	if passkey.Name != "test key" || passkey.LastUsedAt == nil {
+		t.Errorf("passkey = %+v, want the name and last used time to be saved", passkey)
+	}
+
+	// 其他站点的断言，伪造 Host 也无法改变 RP ID
+	if res := login("https://evil.example.org", http.Header{"Host": {"evil.example.org"}}); res.Code != 1003 {
+		t.Errorf("LoginFinish from another origin: code = %d, want 1003", res.Code)
+	}
+
+	// 停用的用户
+	global.Db.Model(&models.User{}).Where("id=?", user.ID).Update("status", 2)
+	if res := login(passkeyTestSiteUrl, nil); res.Code != 1004 {
+		t.Errorf("LoginFinish for a disabled user: code = %d, want 1004", res.Code)
+	}
+}
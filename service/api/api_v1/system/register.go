@@ -0,0 +1,247 @@
+package system
+
+import (
+	"strconv"
+	"strings"
+	"sun-panel/api/api_v1/common/apiData/commonApiStructs"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/cmn"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/mail"
+	"sun-panel/lib/panelTemplate"
+	"sun-panel/lib/password"
+	"sun-panel/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// 自助注册
+// 1.发送验证码：创建未激活（status=3）的账号并发送邮箱验证码
+// 2.提交：校验邮箱验证码后设置密码并激活账号
+type RegisterApi struct{}
+
+const (
+	REGISTER_VCODE_PREFIX     = "register_vcode_" // 注册验证码缓存前缀
+	REGISTER_VCODE_EXPIRATION = 10 * time.Minute
+	REGISTER_VCODE_INTERVAL   = 60 * time.Second // 同一邮箱发送间隔
+	REGISTER_VCODE_MAX_FAIL   = 5
+)
+
+type registerSendVcodeReq struct {
+	Email        string                               `json:"email" validate:"required,email,max=50"`
+	Username     string                               `json:"username" validate:"required,min=3,max=50"`
+	Password     string                               `json:"password" validate:"required,min=6,max=50"`
+	Verification commonApiStructs.VerificationRequest `json:"verification"`
+}
+
+type registerCommitReq struct {
+	Email      string `json:"email" validate:"required,email,max=50"`
+	Password   string `json:"password" validate:"required,min=6,max=50"`
+	EmailVCode string `json:"emailVCode" validate:"required,max=10"`
+}
+
+// 发送注册验证码
+// 邮箱已被激活的账号使用时返回相同的结果但不发送邮件，避免通过注册判断邮箱是否存在
+func (a *RegisterApi) SendRegisterVcode(c *gin.Context) {
+	req := registerSendVcodeReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	req.Username = strings.TrimSpace(req.Username)
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	if !registerCheckOpen(c, settings, req.Email) {
+		return
+	}
+
+	// 图形验证码，防止滥发邮件
+	if !base.VerificationCheckReturn(c, req.Verification) {
+		return
+	}
+
+	// 邮箱未配置时对任何邮箱返回相同的错误
+	emailer, err := mail.NewSystemEmailer()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	key := REGISTER_VCODE_PREFIX + req.Email
+	if _, ok := global.VerifyCodeCachePool.Get(key + "_interval"); ok {
+		apiReturn.Error(c, "Please wait before requesting another code")
+		return
+	}
+
+	// 未激活的同邮箱账号可以重新发送验证码
+	mUser := models.User{}
+	pending := models.User{}
+	if user, err := mUser.CheckMailExist(req.Email); err != nil {
+		if user.Status != 3 {
+			global.VerifyCodeCachePool.Set(key+"_interval", "1", REGISTER_VCODE_INTERVAL)
+			apiReturn.Success(c)
+			return
+		}
+		pending = user
+	}
+	// 账号不能被其他账号占用，过期未激活的账号可以释放
+	if user, err := mUser.CheckUsernameExist(req.Username); err != nil && user.ID != pending.ID {
+		if user.Status != 3 || time.Since(user.UpdatedAt) < REGISTER_VCODE_EXPIRATION {
+			apiReturn.ErrorByCode(c, 1006)
+			return
+		}
+		if err := global.Db.Unscoped().Delete(&models.User{}, "id=? AND status=?", user.ID, 3).Error; err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+	}
+
+	encoded, err := password.Hash(req.Password)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	created := pending.ID == 0
+	pending.Username = req.Username
+	pending.Password = encoded
+	pending.Name = cmn.SubRuneStr(req.Username, 0, 20)
+	pending.Mail = req.Email
+	pending.Status = 3
+	pending.Role = models.ROLE_USER
+	if err := global.Db.Save(&pending).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	vcode := cmn.BuildSecureRandCode(6, cmn.RAND_CODE_MODE3)
+	global.VerifyCodeCachePool.Set(key, vcode, REGISTER_VCODE_EXPIRATION)
+	global.VerifyCodeCachePool.Delete(key + "_fail")
+	global.VerifyCodeCachePool.Set(key+"_interval", "1", REGISTER_VCODE_INTERVAL)
+
+	// 后台发送，避免通过耗时判断邮箱是否存在；发送失败时删除本次创建的账号
+	go func() {
+		if err := mail.SendRegisterEmail(emailer, req.Email, vcode); err != nil {
+			global.Logger.Errorln("Failed to send register email:", req.Email, err)
+			global.VerifyCodeCachePool.Delete(key)
+			if created {
+				global.Db.Unscoped().Delete(&models.User{}, "id=? AND status=?", pending.ID, 3)
+			}
+		}
+	}()
+
+	apiReturn.Success(c)
+}
+
+// 提交注册：验证邮箱验证码，设置密码并激活账号
+// 密码以提交时为准，未激活账号被他人重新发送验证码覆盖后也只能由邮箱所有者激活
+func (a *RegisterApi) Commit(c *gin.Context) {
+	req := registerCommitReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	if !registerCheckOpen(c, settings, req.Email) {
+		return
+	}
+
+	if !emailVCodeVerify(REGISTER_VCODE_PREFIX+req.Email, req.EmailVCode, REGISTER_VCODE_MAX_FAIL, REGISTER_VCODE_EXPIRATION) {
+		apiReturn.ErrorByCode(c, 1009)
+		return
+	}
+	pending := models.User{}
+	if err := global.Db.First(&pending, "mail=? AND status=?", req.Email, 3).Error; err != nil {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	}
+	encoded, err := password.Hash(req.Password)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	if err := global.Db.Model(&models.User{}).Where("id=? AND status=?", pending.ID, 3).
+		Updates(map[string]interface{}{"password": encoded, "status": 1}).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	if err := panelTemplate.ApplyDefault(pending.ID); err != nil {
+		global.Logger.Errorln("Failed to apply panel template:", pending.ID, err)
+	}
+
+	apiReturn.SuccessData(c, gin.H{"username": pending.Username})
+}
+
+// 验证是否开放注册以及邮箱后缀是否允许
+func registerCheckOpen(c *gin.Context, settings systemSetting.ApplicationSetting, email string) bool {
+	if !settings.OpenRegister {
+		apiReturn.Error(c, "Registration is not open")
+		return false
+	}
+	if !registerEmailSuffixAllowed(settings.EmailSuffix, email) {
+		apiReturn.Error(c, "The email suffix is not allowed: "+settings.EmailSuffix)
+		return false
+	}
+	return true
+}
+
+// 邮箱后缀，多个使用英文逗号分隔，为空不限制
+func registerEmailSuffixAllowed(emailSuffix, email string) bool {
+	if strings.TrimSpace(emailSuffix) == "" {
+		return true
+	}
+	for _, suffix := range strings.Split(emailSuffix, ",") {
+		suffix = strings.ToLower(strings.TrimSpace(suffix))
+		if suffix == "" {
+			continue
+		}
+		if !strings.HasPrefix(suffix, "@") {
+			suffix = "@" + suffix
+		}
+		if strings.HasSuffix(email, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// 校验邮箱验证码，验证成功或错误次数过多后作废
+func emailVCodeVerify(key, vcode string, maxFail int, expiration time.Duration) bool {
+	code, ok := global.VerifyCodeCachePool.Get(key)
+	if !ok || code == "" {
+		return false
+	}
+	if code == vcode {
+		global.VerifyCodeCachePool.Delete(key)
+		global.VerifyCodeCachePool.Delete(key + "_fail")
+		return true
+	}
+
+	times := 1
+	if v, ok := global.VerifyCodeCachePool.Get(key + "_fail"); ok {
+		times = cmn.StrToInt(v) + 1
+	}
+	if times >= maxFail {
+		global.VerifyCodeCachePool.Delete(key)
+		global.VerifyCodeCachePool.Delete(key + "_fail")
+	} else {
+		global.VerifyCodeCachePool.Set(key+"_fail", strconv.Itoa(times), expiration)
+	}
+	return false
+}
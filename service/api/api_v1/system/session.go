@@ -0,0 +1,75 @@
+package system
+
+import (
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/lib/session"
+	"sun-panel/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// 登录会话（设备）管理
+type SessionApi struct{}
+
+type sessionIdReq struct {
+	Id uint `json:"id" validate:"required"`
+}
+
+// 获取当前用户的会话列表，current标记当前设备
+func (a *SessionApi) GetList(c *gin.Context) {
+	type Item struct {
+		models.UserSession
+		Current bool `json:"current"`
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	currentId := session.GetSessionId(c.GetHeader("token"))
+
+	mUserSession := models.UserSession{}
+	list, err := mUserSession.GetListByUserId(userInfo.ID)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	items := []Item{}
+	for _, v := range list {
+		items = append(items, Item{UserSession: v, Current: v.ID == currentId})
+	}
+	apiReturn.SuccessListData(c, items, int64(len(items)))
+}
+
+// 吊销某个会话（退出指定设备）
+func (a *SessionApi) Revoke(c *gin.Context) {
+	req := sessionIdReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	if err := session.Revoke(userInfo.ID, req.Id); err == session.ErrSessionNotFound {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	} else if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.Success(c)
+}
+
+// 退出全部设备（包括当前设备），并更换用户token
+func (a *SessionApi) RevokeAll(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	if err := session.RevokeAllAndRotate(userInfo.ID); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.Success(c)
+}
@@ -5,18 +5,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
+	"net/url"
 
 	"sun-panel/api/api_v1/common/apiReturn"
 	"sun-panel/api/api_v1/common/base"
-	"sun-panel/global"
-	"sun-panel/lib/cmn"
+	"sun-panel/lib/auditLog"
+	"sun-panel/lib/externalUser"
+	"sun-panel/lib/session"
 	"sun-panel/models"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
 	"golang.org/x/oauth2/google"
@@ -49,23 +48,18 @@ func getOauth2Config(c *gin.Context, provider string) (*oauth2.Config, *models.S
 	if err != nil {
 		return nil, nil, fmt.Errorf("provider not found or disabled")
 	}
-
-	scheme := "http://"
-	if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
-		scheme = "https://"
+	clientSecret, err := config.GetClientSecret()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt client secret: %v", err)
 	}
 
-	host := c.Request.Host
-	// In local dev, map 3002 to 1002 for the callback as well
-	host = strings.Replace(host, ":3002", ":1002", 1)
-
-	redirectUrl := scheme + host + "/api/system/sso/callback/" + provider
+	redirectUrl := ssoBaseUrl(c, config) + "/api/system/sso/callback/" + provider
 
 	switch provider {
 	case "github":
 		return &oauth2.Config{
 			ClientID:     config.ClientId,
-			ClientSecret: config.ClientSecret,
+			ClientSecret: clientSecret,
 			Endpoint:     github.Endpoint,
 			RedirectURL:  redirectUrl,
 			Scopes:       []string{"read:user", "user:email"},
@@ -73,7 +67,7 @@ func getOauth2Config(c *gin.Context, provider string) (*oauth2.Config, *models.S
 	case "google":
 		return &oauth2.Config{
 			ClientID:     config.ClientId,
-			ClientSecret: config.ClientSecret,
+			ClientSecret: clientSecret,
 			Endpoint:     google.Endpoint,
 			RedirectURL:  redirectUrl,
 			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
@@ -86,7 +80,7 @@ func getOauth2Config(c *gin.Context, provider string) (*oauth2.Config, *models.S
 		}
 		return &oauth2.Config{
 			ClientID:     config.ClientId,
-			ClientSecret: config.ClientSecret,
+			ClientSecret: clientSecret,
 			Endpoint:     providerOIDC.Endpoint(),
 			RedirectURL:  redirectUrl,
 			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
@@ -95,9 +89,30 @@ func getOauth2Config(c *gin.Context, provider string) (*oauth2.Config, *models.S
 }
 
 // Login 重定向到SSO提供商登录页
+// 携带token时为绑定到当前登录的用户
 func (a *SsoApi) Login(c *gin.Context) {
 	provider := c.Param("provider")
-	userToken := c.Query("token")
+
+	state := ssoState{Provider: provider}
+	if userToken := c.Query("token"); userToken != "" {
+		mUser := models.User{}
+		bToken, ok := session.Get(userToken)
+		if !ok || bToken == "" {
+			redirectFrontend(c, "", "Session expired, please login again before binding")
+			return
+		}
+		userInfo, err := mUser.GetUserInfoByToken(bToken)
+		if err != nil {
+			redirectFrontend(c, "", "Invalid binding user")
+			return
+		}
+		state.BindUserId = userInfo.ID
+	}
+
+	if config, err := ssoSamlGetConfig(provider, true); err == nil {
+		ssoSamlLogin(c, config, state)
+		return
+	}
 
 	oauthCfg, _, err := getOauth2Config(c, provider)
 	if err != nil {
@@ -105,43 +120,43 @@ func (a *SsoApi) Login(c *gin.Context) {
 		return
 	}
 
-	state := cmn.BuildRandCode(32, cmn.RAND_CODE_MODE2)
-	if userToken != "" {
-		state = state + "||" + userToken
+	state.CodeVerifier = oauth2.GenerateVerifier()
+	opts := []oauth2.AuthCodeOption{oauth2.AccessTypeOffline, oauth2.S256ChallengeOption(state.CodeVerifier)}
+	if provider != "github" {
+		state.Nonce = oauth2.GenerateVerifier()
+		opts = append(opts, oidc.Nonce(state.Nonce))
 	}
 
-	global.VerifyCodeCachePool.SetDefault(state, "1")
+	stateKey, err := ssoStateSave(state)
+	if err != nil {
+		redirectFrontend(c, "", err.Error())
+		return
+	}
 
-	url := oauthCfg.AuthCodeURL(state, oauth2.AccessTypeOffline)
-	c.Redirect(http.StatusFound, url)
+	c.Redirect(http.StatusFound, oauthCfg.AuthCodeURL(stateKey, opts...))
 }
 
+// 回跳到前端登录页
 func redirectFrontend(c *gin.Context, token string, errMsg string) {
-	scheme := "http://"
-	if c.Request.TLS != nil || c.Request.Header.Get("X-Forwarded-Proto") == "https" {
-		scheme = "https://"
+	baseUrl := c.GetString(ssoBaseUrlContextKey)
+	if baseUrl == "" {
+		baseUrl = base.GetSiteUrl(c)
 	}
 
-	host := c.Request.Host
-	// In local dev, Vite runs on 1002 while backend API runs on 3002.
-	// We remap the redirect host for convenience during development.
-	host = strings.Replace(host, ":3002", ":1002", 1)
-
-	url := scheme + host + "/#/login"
-
-	params := []string{}
+	params := url.Values{}
 	if token != "" {
-		params = append(params, "ssoToken="+token)
+		params.Set("ssoToken", token)
 	}
 	if errMsg != "" {
-		params = append(params, "ssoError="+errMsg)
+		params.Set("ssoError", errMsg)
 	}
 
+	redirectUrl := baseUrl + "/#/login"
 	if len(params) > 0 {
-		url += "?" + strings.Join(params, "&")
+		redirectUrl += "?" + params.Encode()
 	}
 
-	c.Redirect(http.StatusFound, url)
+	c.Redirect(http.StatusFound, redirectUrl)
 }
 
 // Callback SSO回调处理
@@ -155,17 +170,11 @@ func (a *SsoApi) Callback(c *gin.Context) {
 		return
 	}
 
-	if _, found := global.VerifyCodeCachePool.Get(state); !found {
+	stateInfo, ok := ssoStateTake(state, provider)
+	if !ok {
 		c.String(http.StatusBadRequest, "Invalid or expired state")
 		return
 	}
-	global.VerifyCodeCachePool.Delete(state)
-
-	var userToken string
-	stateParts := strings.Split(state, "||")
-	if len(stateParts) > 1 {
-		userToken = stateParts[1]
-	}
 
 	oauthCfg, ssoConfig, err := getOauth2Config(c, provider)
 	if err != nil {
@@ -173,96 +182,131 @@ func (a *SsoApi) Callback(c *gin.Context) {
 		return
 	}
 
-	token, err := oauthCfg.Exchange(context.Background(), code)
+	token, err := oauthCfg.Exchange(context.Background(), code, oauth2.VerifierOption(stateInfo.CodeVerifier))
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to exchange token: "+err.Error())
 		return
 	}
 
-	var providerUid string
-	var email string
-	var name string
+	ext, err := ssoConfig.GetExt()
+	if err != nil {
+		redirectFrontend(c, "", "Invalid provider extended config")
+		return
+	}
 
+	var profile externalUser.Profile
 	if provider == "github" {
 		client := oauthCfg.Client(context.Background(), token)
-		userResp, err := client.Get("https://api.github.com/user")
-		if err != nil {
+		var user map[string]interface{}
+		if err := ssoGetJson(client, "https://api.github.com/user", &user); err != nil {
 			c.String(http.StatusInternalServerError, "Failed to get user info: "+err.Error())
 			return
 		}
-		defer userResp.Body.Close()
-		var user map[string]interface{}
-		json.NewDecoder(userResp.Body).Decode(&user)
-		if id, ok := user["id"].(float64); ok {
-			providerUid = fmt.Sprintf("%.0f", id)
-		}
-		if e, ok := user["email"].(string); ok {
-			email = e
+		profile = ssoProfileFromClaims(user, ext, ssoClaimDefaultsGithub)
+		profile.Uid = ssoClaimString(user, "id", nil)
+
+		// 公开邮箱不一定已验证，使用已验证的主邮箱
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
 		}
-		if n, ok := user["name"].(string); ok {
-			name = n
+		if err := ssoGetJson(client, "https://api.github.com/user/emails", &emails); err == nil {
+			for _, v := range emails {
+				if v.Primary && v.Verified {
+					profile.Email = v.Email
+					profile.EmailVerified = true
+				}
+			}
 		}
 	} else {
-		providerOIDC, err := oidc.NewProvider(context.Background(), ssoConfig.IssuerUrl)
+		issuerUrl := ssoConfig.IssuerUrl
 		if provider == "google" {
-			providerOIDC, _ = oidc.NewProvider(context.Background(), "https://accounts.google.com")
+			issuerUrl = "https://accounts.google.com"
 		}
+		providerOIDC, err := oidc.NewProvider(context.Background(), issuerUrl)
 		if err != nil {
 			c.String(http.StatusInternalServerError, "Failed to init OIDC provider: "+err.Error())
 			return
 		}
-		verifier := providerOIDC.Verifier(&oidc.Config{ClientID: ssoConfig.ClientId})
 
-		rawIDToken, ok := token.Extra("id_token").(string)
-		if !ok {
-			userInfo, err := providerOIDC.UserInfo(context.Background(), oauth2.StaticTokenSource(token))
-			if err != nil {
-				c.String(http.StatusInternalServerError, "Failed to get user info: "+err.Error())
-				return
-			}
-			providerUid = userInfo.Subject
-			var claims struct {
-				Email string `json:"email"`
-				Name  string `json:"name"`
-			}
-			userInfo.Claims(&claims)
-			email = claims.Email
-			name = claims.Name
-		} else {
+		claims := map[string]interface{}{}
+		subject := ""
+		if rawIDToken, ok := token.Extra("id_token").(string); ok {
+			verifier := providerOIDC.Verifier(&oidc.Config{ClientID: ssoConfig.ClientId})
 			idToken, err := verifier.Verify(context.Background(), rawIDToken)
 			if err != nil {
 				c.String(http.StatusInternalServerError, "Failed to verify ID token: "+err.Error())
 				return
 			}
-			var claims struct {
-				Email string `json:"email"`
-				Name  string `json:"name"`
+			if stateInfo.Nonce == "" || idToken.Nonce != stateInfo.Nonce {
+				c.String(http.StatusBadRequest, "Invalid ID token nonce")
+				return
 			}
 			idToken.Claims(&claims)
-			providerUid = idToken.Subject
-			email = claims.Email
-			name = claims.Name
+			subject = idToken.Subject
+		}
+
+		// 部分提供商只在userinfo中返回组等信息，合并ID Token中不存在的claim
+		userInfo, err := providerOIDC.UserInfo(context.Background(), oauth2.StaticTokenSource(token))
+		if err != nil && subject == "" {
+			c.String(http.StatusInternalServerError, "Failed to get user info: "+err.Error())
+			return
 		}
+		if err == nil && (subject == "" || userInfo.Subject == subject) {
+			userClaims := map[string]interface{}{}
+			userInfo.Claims(&userClaims)
+			for k, v := range userClaims {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+			subject = userInfo.Subject
+		}
+
+		profile = ssoProfileFromClaims(claims, ext, ssoClaimDefaultsOidc)
+		profile.Uid = subject
+		profile.EmailVerified = ssoClaimBool(claims, "email_verified")
 	}
 
-	if providerUid == "" {
+	if profile.Uid == "" {
 		c.String(http.StatusInternalServerError, "Could not identify user from provider")
 		return
 	}
 
+	ssoLoginOrBind(c, ssoConfig, profile, stateInfo.BindUserId)
+}
+
+// 请求JSON接口
+func ssoGetJson(client *http.Client, url string, v interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// 第三方账号登录，bindUserId不为0时绑定到该用户
+// 未绑定的账号按提供商的策略（SsoConfigExt）关联已有用户或自动创建，组映射的角色每次登录重新计算
+func ssoLoginOrBind(c *gin.Context, config *models.SsoConfig, profile externalUser.Profile, bindUserId uint) {
+	provider := config.Provider
+	ext, err := config.GetExt()
+	if err != nil {
+		redirectFrontend(c, "", "Invalid provider extended config")
+		return
+	}
+
 	mUserAuth := models.UserAuth{}
-	authRec, _ := mUserAuth.GetByProviderAndUid(provider, providerUid)
+	authRec, _ := mUserAuth.GetByProviderAndUid(provider, profile.Uid)
 	mUser := models.User{}
 
-	if userToken != "" {
-		dbToken, ok := global.CUserToken.Get(userToken)
-		if !ok || dbToken == "" {
-			redirectFrontend(c, "", "Session expired, please login again before binding")
-			return
-		}
-
-		userInfo, err := mUser.GetUserInfoByToken(dbToken)
-		if err != nil {
+	if bindUserId != 0 {
+		userInfo, err := mUser.GetUserInfoByUid(bindUserId)
+		if err != nil || userInfo.Status != 1 {
 			redirectFrontend(c, "", "Invalid binding user")
 			return
 		}
@@ -279,13 +323,23 @@ func (a *SsoApi) Callback(c *gin.Context) {
 		newAuth := models.UserAuth{
 			UserId:      userInfo.ID,
 			Provider:    provider,
-			ProviderUid: providerUid,
+			ProviderUid: profile.Uid,
 		}
-		models.Db.Create(&newAuth)
+		if err := models.Db.Create(&newAuth).Error; err != nil {
+			redirectFrontend(c, "", "Bind failed")
+			return
+		}
+		auditLog.Record(c, userInfo, auditLog.ACTION_SSO_BIND, auditLog.TARGET_USER, userInfo.ID, nil, gin.H{"provider": provider, "providerUid": profile.Uid})
 		redirectFrontend(c, "", "Bind success")
 		return
 	}
 
+	role, ok := ssoMapRole(ext, profile.Groups)
+	if !ok {
+		redirectFrontend(c, "", "Your account is not in an allowed group")
+		return
+	}
+
 	var loginUser models.User
 	if authRec.ID != 0 {
 		loginUser, err = mUser.GetUserInfoByUid(authRec.UserId)
@@ -294,51 +348,59 @@ func (a *SsoApi) Callback(c *gin.Context) {
 			return
 		}
 	} else {
-		username := email
-		if username == "" {
-			username = providerUid + "@" + provider
-		}
-		loginUser = models.User{
-			Username: username,
-			Password: cmn.PasswordEncryption(cmn.BuildRandCode(12, cmn.RAND_CODE_MODE2)),
-			Name:     name,
-			Mail:     email,
-			Status:   1,
-			Role:     2,
-		}
-		if name == "" {
-			loginUser.Name = loginUser.Username
+		if !ssoEmailDomainAllowed(ext, profile.Email) {
+			redirectFrontend(c, "", "Email domain is not allowed")
+			return
 		}
-		for i := 0; i < 10; i++ {
-			if _, err := mUser.CheckUsernameExist(loginUser.Username); err == nil {
-				break
+
+		// 通过已验证的邮箱关联已有用户
+		if ext.LinkByEmail && profile.EmailVerified && profile.Email != "" {
+			users := []models.User{}
+			if err := models.Db.Where("mail=?", profile.Email).Limit(2).Find(&users).Error; err != nil {
+				c.String(http.StatusInternalServerError, "Failed to query user: "+err.Error())
+				return
+			}
+			if len(users) == 1 {
+				loginUser = users[0]
+				if loginUser.Status != 1 {
+					redirectFrontend(c, "", "User account is disabled or does not exist")
+					return
+				}
 			}
-			loginUser.Username = username + fmt.Sprintf("%d", i)
 		}
 
-		err = models.Db.Create(&loginUser).Error
-		if err != nil {
-			c.String(http.StatusInternalServerError, "Failed to create user: "+err.Error())
-			return
+		if loginUser.ID == 0 {
+			if !ext.AutoRegister {
+				redirectFrontend(c, "", "Automatic registration is disabled, please contact the administrator")
+				return
+			}
+			if loginUser, err = externalUser.Create(provider, profile, role); err != nil {
+				c.String(http.StatusInternalServerError, "Failed to create user: "+err.Error())
+				return
+			}
 		}
 
 		newAuth := models.UserAuth{
 			UserId:      loginUser.ID,
 			Provider:    provider,
-			ProviderUid: providerUid,
+			ProviderUid: profile.Uid,
 		}
 		models.Db.Create(&newAuth)
 	}
 
-	bToken := loginUser.Token
-	if bToken == "" {
-		bToken = cmn.BuildRandCode(32, cmn.RAND_CODE_MODE2)
-		models.Db.Model(&loginUser).Update("token", bToken)
+	// 同步组映射的角色
+	if err := externalUser.SyncRole(&loginUser, role); err != nil {
+		c.String(http.StatusInternalServerError, "Failed to update user role: "+err.Error())
+		return
+	}
+
+	userInfo, err := loginIssueToken(c, loginUser)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to create session: "+err.Error())
+		return
 	}
-	cToken := uuid.NewString() + "-" + cmn.Md5(cmn.Md5("userId"+strconv.Itoa(int(loginUser.ID))))
-	global.CUserToken.SetDefault(cToken, bToken)
 
-	redirectFrontend(c, cToken, "")
+	redirectFrontend(c, userInfo.Token, "")
 }
 
 // GetUserBindings 获取当前用户绑定的SSO账号
@@ -373,10 +435,13 @@ func (a *SsoApi) Unbind(c *gin.Context) {
 		return
 	}
 	userInfo, _ := base.GetCurrentUserInfo(c)
-	err := models.Db.Where("user_id = ? AND provider = ?", userInfo.ID, req.Provider).Delete(&models.UserAuth{}).Error
-	if err != nil {
-		apiReturn.ErrorDatabase(c, err.Error())
+	res := models.Db.Where("user_id = ? AND provider = ?", userInfo.ID, req.Provider).Delete(&models.UserAuth{})
+	if res.Error != nil {
+		apiReturn.ErrorDatabase(c, res.Error.Error())
 		return
 	}
+	if res.RowsAffected > 0 {
+		auditLog.Record(c, userInfo, auditLog.ACTION_SSO_UNBIND, auditLog.TARGET_USER, userInfo.ID, gin.H{"provider": req.Provider}, nil)
+	}
 	apiReturn.Success(c)
 }
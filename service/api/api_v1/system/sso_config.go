@@ -1,42 +1,224 @@
 package system
 
 import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
 	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/lib/auditLog"
+	"sun-panel/lib/ssoSaml"
 	"sun-panel/models"
+	"time"
 
+	"github.com/coreos/go-oidc/v3/oidc"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 )
 
 type SsoConfigApi struct{}
 
-// GetList 获取所有配置
+const ssoSecretMask = "******" // 返回给前端的密钥掩码
+
+var ssoProviderRegexp = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+// GetList 获取所有配置，ClientSecret只返回掩码
 func (a *SsoConfigApi) GetList(c *gin.Context) {
 	var configs []models.SsoConfig
-	models.Db.Find(&configs)
+	if err := models.Db.Find(&configs).Error; err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	for i := range configs {
+		if configs[i].ClientSecret != "" {
+			configs[i].ClientSecret = ssoSecretMask
+		}
+	}
 	apiReturn.SuccessData(c, configs)
 }
 
 // Save 保存配置
+// ClientSecret 为只写字段：为空或为掩码时保留原值
 func (a *SsoConfigApi) Save(c *gin.Context) {
 	var req models.SsoConfig
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		apiReturn.ErrorParamFomat(c, err.Error())
 		return
 	}
 
-	if req.Provider == "" {
-		apiReturn.ErrorParamFomat(c, "provider is required")
+	req.Provider = strings.TrimSpace(req.Provider)
+	if !ssoProviderRegexp.MatchString(req.Provider) {
+		apiReturn.ErrorParamFomat(c, "provider must be 1-50 lowercase letters, digits, '-' or '_'")
 		return
 	}
 
+	ext, err := req.GetExt()
+	if err != nil {
+		apiReturn.ErrorParamFomat(c, "ext must be a valid JSON object: "+err.Error())
+		return
+	}
+	if ext.BaseUrl != "" {
+		if u, err := url.Parse(ext.BaseUrl); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			apiReturn.ErrorParamFomat(c, "ext.baseUrl must be an http(s) URL")
+			return
+		}
+	}
+
 	var existing models.SsoConfig
-	if err := models.Db.Where("provider = ?", req.Provider).First(&existing).Error; err != nil {
+	exists := models.Db.Where("provider = ?", req.Provider).First(&existing).Error == nil
+
+	if req.ClientSecret == "" || req.ClientSecret == ssoSecretMask {
+		req.ClientSecret = existing.ClientSecret
+	} else if err := req.SetClientSecret(req.ClientSecret); err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+
+	var before interface{}
+	if !exists {
 		// create
-		models.Db.Create(&req)
+		if err := models.Db.Create(&req).Error; err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
 	} else {
+		beforeConfig := existing
+		req.ID = existing.ID
 		// update
-		models.Db.Model(&existing).Select("enabled", "name", "client_id", "client_secret", "issuer_url", "saml_metadata", "ext").Updates(req)
+		if err := models.Db.Model(&existing).Select("enabled", "name", "client_id", "client_secret", "issuer_url", "saml_metadata", "ext").Updates(req).Error; err != nil {
+			apiReturn.ErrorDatabase(c, err.Error())
+			return
+		}
+		// 审计日志中不记录密钥
+		if beforeConfig.ClientSecret != "" {
+			beforeConfig.ClientSecret = ssoSecretMask
+		}
+		before = beforeConfig
 	}
 
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	after := req
+	if after.ClientSecret != "" {
+		after.ClientSecret = ssoSecretMask
+	}
+	auditLog.Record(c, userInfo, auditLog.ACTION_SSO_CONFIG_SAVE, auditLog.TARGET_SSO_CONFIG, req.Provider, before, after)
 	apiReturn.Success(c)
 }
+
+// Test 测试提供商配置：校验IssuerUrl的OIDC发现文档，SAML则校验IdP元数据
+// issuerUrl、samlMetadata为空时使用已保存的配置
+func (a *SsoConfigApi) Test(c *gin.Context) {
+	type Req struct {
+		Provider     string `json:"provider" validate:"required,max=50"`
+		IssuerUrl    string `json:"issuerUrl" validate:"max=255"`
+		SamlMetadata string `json:"samlMetadata"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	issuerUrl := strings.TrimSpace(req.IssuerUrl)
+	samlMetadata := strings.TrimSpace(req.SamlMetadata)
+	mSsoConfig := models.SsoConfig{}
+	if config, err := mSsoConfig.GetByProvider(req.Provider); err == nil {
+		if issuerUrl == "" {
+			issuerUrl = config.IssuerUrl
+		}
+		if samlMetadata == "" {
+			samlMetadata = config.SamlMetadata
+		}
+	}
+
+	if req.Provider == "saml" || samlMetadata != "" {
+		ssoConfigTestSaml(c, samlMetadata)
+		return
+	}
+
+	switch {
+	case req.Provider == "github":
+		// GitHub 使用固定的OAuth2端点，没有发现文档
+		apiReturn.SuccessData(c, gin.H{"discovery": false})
+		return
+	case req.Provider == "google" && issuerUrl == "":
+		issuerUrl = "https://accounts.google.com"
+	case issuerUrl == "":
+		apiReturn.ErrorParamFomat(c, "issuerUrl is required")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	provider, err := oidc.NewProvider(ctx, issuerUrl)
+	if err != nil {
+		apiReturn.Error(c, "OIDC discovery failed: "+err.Error())
+		return
+	}
+
+	var claims struct {
+		Issuer                string   `json:"issuer"`
+		AuthorizationEndpoint string   `json:"authorization_endpoint"`
+		TokenEndpoint         string   `json:"token_endpoint"`
+		UserinfoEndpoint      string   `json:"userinfo_endpoint"`
+		JwksUri               string   `json:"jwks_uri"`
+		ScopesSupported       []string `json:"scopes_supported"`
+	}
+	provider.Claims(&claims)
+	if claims.JwksUri == "" {
+		apiReturn.Error(c, "OIDC discovery document has no jwks_uri")
+		return
+	}
+
+	apiReturn.SuccessData(c, gin.H{
+		"discovery":             true,
+		"issuer":                claims.Issuer,
+		"authorizationEndpoint": claims.AuthorizationEndpoint,
+		"tokenEndpoint":         claims.TokenEndpoint,
+		"userinfoEndpoint":      claims.UserinfoEndpoint,
+		"jwksUri":               claims.JwksUri,
+		"scopesSupported":       claims.ScopesSupported,
+	})
+}
+
+// 校验SAML IdP元数据（URL或XML）
+func ssoConfigTestSaml(c *gin.Context, metadata string) {
+	if metadata == "" {
+		apiReturn.ErrorParamFomat(c, "samlMetadata is required")
+		return
+	}
+
+	data := []byte(metadata)
+	if ssoSaml.IsMetadataUrl(metadata) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		var err error
+		if data, err = ssoSaml.FetchMetadata(ctx, metadata); err != nil {
+			apiReturn.Error(c, "SAML metadata fetch failed: "+err.Error())
+			return
+		}
+	}
+
+	entity, err := ssoSaml.ParseMetadata(data)
+	if err != nil {
+		apiReturn.Error(c, "SAML metadata parse failed: "+err.Error())
+		return
+	}
+
+	ssoUrls := []string{}
+	for _, idp := range entity.IDPSSODescriptors {
+		for _, v := range idp.SingleSignOnServices {
+			ssoUrls = append(ssoUrls, v.Location)
+		}
+	}
+	apiReturn.SuccessData(c, gin.H{
+		"saml":     true,
+		"entityId": entity.EntityID,
+		"ssoUrls":  ssoUrls,
+	})
+}
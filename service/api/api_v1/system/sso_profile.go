@@ -0,0 +1,190 @@
+package system
+
+import (
+	"fmt"
+	"strings"
+	"sun-panel/lib/externalUser"
+	"sun-panel/models"
+)
+
+// 各类提供商claim的默认路径，按顺序取第一个非空值
+type ssoClaimDefaults struct {
+	Username []string
+	Name     []string
+	Email    []string
+	Avatar   []string
+	Groups   []string
+}
+
+var (
+	ssoClaimDefaultsOidc = ssoClaimDefaults{
+		Username: []string{"preferred_username"},
+		Name:     []string{"name"},
+		Email:    []string{"email"},
+		Avatar:   []string{"picture"},
+		Groups:   []string{"groups"},
+	}
+	ssoClaimDefaultsGithub = ssoClaimDefaults{
+		Username: []string{"login"},
+		Name:     []string{"name"},
+		Email:    []string{"email"},
+		Avatar:   []string{"avatar_url"},
+	}
+	ssoClaimDefaultsSaml = ssoClaimDefaults{
+		Username: []string{"uid", "username", "urn:oid:0.9.2342.19200300.100.1.1"},
+		Name: []string{"displayName", "name", "cn", "urn:oid:2.16.840.1.113730.3.1.241",
+			"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name"},
+		Email: []string{"email", "mail", "emailaddress", "urn:oid:0.9.2342.19200300.100.1.3",
+			"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/emailaddress"},
+		Groups: []string{"groups", "memberOf", "urn:oid:1.3.6.1.4.1.5923.1.5.1.1",
+			"http://schemas.microsoft.com/ws/2008/06/identity/claims/groups"},
+	}
+)
+
+// 根据映射规则从claims中解析账号资料，uid与邮箱是否已验证由调用方设置
+func ssoProfileFromClaims(claims map[string]interface{}, ext models.SsoConfigExt, defaults ssoClaimDefaults) externalUser.Profile {
+	return externalUser.Profile{
+		Username: ssoClaimString(claims, ext.ClaimUsername, defaults.Username),
+		Name:     ssoClaimString(claims, ext.ClaimName, defaults.Name),
+		Email:    ssoClaimString(claims, ext.ClaimEmail, defaults.Email),
+		Avatar:   ssoClaimString(claims, ext.ClaimAvatar, defaults.Avatar),
+		Groups:   ssoClaimStrings(claims, ext.ClaimGroups, defaults.Groups),
+	}
+}
+
+// 配置了路径时只使用配置的路径，否则依次尝试默认路径
+func ssoClaimPaths(path string, defaults []string) []string {
+	if path = strings.TrimSpace(path); path != "" {
+		return []string{path}
+	}
+	return defaults
+}
+
+func ssoClaimString(claims map[string]interface{}, path string, defaults []string) string {
+	for _, v := range ssoClaimPaths(path, defaults) {
+		if values := ssoClaimToStrings(ssoClaimLookup(claims, v)); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func ssoClaimStrings(claims map[string]interface{}, path string, defaults []string) []string {
+	for _, v := range ssoClaimPaths(path, defaults) {
+		if values := ssoClaimToStrings(ssoClaimLookup(claims, v)); len(values) > 0 {
+			return values
+		}
+	}
+	return nil
+}
+
+// 按路径查找claim，优先完整匹配（SAML属性名可能包含"."），其次按"."逐级查找，键名不区分大小写
+func ssoClaimLookup(claims map[string]interface{}, path string) interface{} {
+	if v, ok := ssoClaimGet(claims, path); ok {
+		return v
+	}
+	var current interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if current, ok = ssoClaimGet(m, key); !ok {
+			return nil
+		}
+	}
+	return current
+}
+
+func ssoClaimGet(m map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func ssoClaimToStrings(value interface{}) []string {
+	res := []string{}
+	switch v := value.(type) {
+	case nil:
+	case string:
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			res = append(res, ssoClaimToStrings(item)...)
+		}
+	case []string:
+		for _, item := range v {
+			res = append(res, ssoClaimToStrings(item)...)
+		}
+	case float64:
+		res = append(res, fmt.Sprintf("%.0f", v))
+	default:
+		res = append(res, fmt.Sprint(v))
+	}
+	return res
+}
+
+// 邮箱是否已验证，兼容布尔值与字符串
+func ssoClaimBool(claims map[string]interface{}, key string) bool {
+	v, _ := ssoClaimGet(claims, key)
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return strings.EqualFold(b, "true")
+	}
+	return false
+}
+
+// 邮箱域名是否在允许列表中，列表为空不限制
+func ssoEmailDomainAllowed(ext models.SsoConfigExt, email string) bool {
+	if len(ext.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at == -1 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, v := range ext.AllowedDomains {
+		v = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(v), "@"))
+		if v != "" && domain == v {
+			return true
+		}
+	}
+	return false
+}
+
+// 根据组映射计算角色
+// 未配置组映射时返回 0,true（不修改角色）；配置了映射但不属于任何映射组时返回 false
+func ssoMapRole(ext models.SsoConfigExt, groups []string) (int, bool) {
+	if len(ext.AdminGroups) == 0 && len(ext.UserGroups) == 0 {
+		return 0, true
+	}
+	if ssoGroupsContain(groups, ext.AdminGroups) {
+		return models.ROLE_ADMIN, true
+	}
+	if len(ext.UserGroups) == 0 || ssoGroupsContain(groups, ext.UserGroups) {
+		return models.ROLE_USER, true
+	}
+	return 0, false
+}
+
+func ssoGroupsContain(groups []string, targets []string) bool {
+	for _, g := range groups {
+		for _, t := range targets {
+			if strings.TrimSpace(t) != "" && strings.EqualFold(g, strings.TrimSpace(t)) {
+				return true
+			}
+		}
+	}
+	return false
+}
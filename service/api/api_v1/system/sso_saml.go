@@ -0,0 +1,199 @@
+package system
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/ssoSaml"
+	"sun-panel/models"
+	"time"
+
+	"github.com/crewjam/saml"
+	"github.com/gin-gonic/gin"
+)
+
+// SAML 2.0 SP 登录
+// 登录: /system/sso/login/:provider 重定向到IdP（签名的AuthnRequest）
+// 回调: /system/sso/saml/acs/:provider 校验断言后，以NameID作为第三方账号ID，属性按SsoConfigExt映射
+
+const (
+	SSO_SAML_METADATA_PREFIX     = "sso_saml_metadata_" // IdP元数据（URL方式）缓存前缀
+	SSO_SAML_METADATA_EXPIRATION = time.Hour
+)
+
+// SamlMetadata 获取SP元数据，供IdP配置使用
+func (a *SsoApi) SamlMetadata(c *gin.Context) {
+	config, err := ssoSamlGetConfig(c.Param("provider"), false)
+	if err != nil {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	sp, err := ssoSamlServiceProvider(c, config, false)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.XML(http.StatusOK, sp.Metadata())
+}
+
+// SamlAcs 断言消费服务(ACS)，接收IdP以HTTP-POST方式返回的断言
+func (a *SsoApi) SamlAcs(c *gin.Context) {
+	provider := c.Param("provider")
+	relayState := c.PostForm("RelayState")
+
+	state, ok := ssoStateTake(relayState, provider)
+	if !ok {
+		c.String(http.StatusBadRequest, "Invalid or expired state")
+		return
+	}
+
+	config, err := ssoSamlGetConfig(provider, true)
+	if err != nil {
+		redirectFrontend(c, "", err.Error())
+		return
+	}
+	sp, err := ssoSamlServiceProvider(c, config, true)
+	if err != nil {
+		redirectFrontend(c, "", err.Error())
+		return
+	}
+
+	assertion, err := sp.ParseResponse(c.Request, []string{state.RequestId})
+	if err != nil {
+		var invalidErr *saml.InvalidResponseError
+		if errors.As(err, &invalidErr) {
+			global.Logger.Errorln("SAML response validation failed:", invalidErr.PrivateErr)
+		}
+		redirectFrontend(c, "", "Invalid SAML response")
+		return
+	}
+
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value == "" {
+		redirectFrontend(c, "", "Could not identify user from provider")
+		return
+	}
+	nameId := assertion.Subject.NameID
+
+	ext, err := config.GetExt()
+	if err != nil {
+		redirectFrontend(c, "", "Invalid provider extended config")
+		return
+	}
+	// SAML没有邮箱验证标识，只有配置为信任IdP时才视为已验证，避免通过邮箱接管本地用户
+	profile := ssoProfileFromClaims(ssoSaml.GetAttributes(assertion), ext, ssoClaimDefaultsSaml)
+	profile.Uid = nameId.Value
+	if profile.Email == "" && nameId.Format == string(saml.EmailAddressNameIDFormat) {
+		profile.Email = nameId.Value
+	}
+	profile.EmailVerified = ext.TrustEmail && profile.Email != ""
+
+	ssoLoginOrBind(c, config, profile, state.BindUserId)
+}
+
+// 发起SP登录
+func ssoSamlLogin(c *gin.Context, config *models.SsoConfig, state ssoState) {
+	sp, err := ssoSamlServiceProvider(c, config, true)
+	if err != nil {
+		redirectFrontend(c, "", err.Error())
+		return
+	}
+
+	bindingLocation := sp.GetSSOBindingLocation(saml.HTTPRedirectBinding)
+	if bindingLocation == "" {
+		redirectFrontend(c, "", "IdP does not support HTTP-Redirect binding")
+		return
+	}
+	req, err := sp.MakeAuthenticationRequest(bindingLocation, saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		redirectFrontend(c, "", err.Error())
+		return
+	}
+
+	state.RequestId = req.ID
+	relayState, err := ssoStateSave(state)
+	if err != nil {
+		redirectFrontend(c, "", err.Error())
+		return
+	}
+
+	redirectUrl, err := req.Redirect(relayState, sp)
+	if err != nil {
+		redirectFrontend(c, "", err.Error())
+		return
+	}
+	c.Redirect(http.StatusFound, redirectUrl.String())
+}
+
+func ssoSamlGetConfig(provider string, mustEnabled bool) (*models.SsoConfig, error) {
+	mSsoConfig := models.SsoConfig{}
+	config, err := mSsoConfig.GetByProvider(provider)
+	if err != nil || !config.IsSaml() || (mustEnabled && config.Enabled != 1) {
+		return nil, errors.New("provider not found or disabled")
+	}
+	return config, nil
+}
+
+// 创建SP实例，withIdp为true时加载IdP元数据
+func ssoSamlServiceProvider(c *gin.Context, config *models.SsoConfig, withIdp bool) (*saml.ServiceProvider, error) {
+	keyPair, err := ssoSamlGetKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	sp, err := ssoSaml.NewServiceProvider(keyPair, ssoBaseUrl(c, config), config.Provider, config.ClientId)
+	if err != nil {
+		return nil, err
+	}
+
+	if withIdp {
+		if sp.IDPMetadata, err = ssoSamlIdpMetadata(config); err != nil {
+			return nil, err
+		}
+	}
+	return sp, nil
+}
+
+// IdP元数据，URL方式会缓存一段时间
+func ssoSamlIdpMetadata(config *models.SsoConfig) (*saml.EntityDescriptor, error) {
+	if !ssoSaml.IsMetadataUrl(config.SamlMetadata) {
+		return ssoSaml.ParseMetadata([]byte(config.SamlMetadata))
+	}
+
+	cacheKey := SSO_SAML_METADATA_PREFIX + config.Provider
+	if data, ok := global.VerifyCodeCachePool.Get(cacheKey); ok {
+		if entity, err := ssoSaml.ParseMetadata([]byte(data)); err == nil {
+			return entity, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	data, err := ssoSaml.FetchMetadata(ctx, config.SamlMetadata)
+	if err != nil {
+		return nil, err
+	}
+	entity, err := ssoSaml.ParseMetadata(data)
+	if err != nil {
+		return nil, err
+	}
+	global.VerifyCodeCachePool.Set(cacheKey, string(data), SSO_SAML_METADATA_EXPIRATION)
+	return entity, nil
+}
+
+// SP签名密钥，首次使用时生成
+func ssoSamlGetKeyPair() (ssoSaml.KeyPair, error) {
+	keyPair := ssoSaml.KeyPair{}
+	if err := global.SystemSetting.GetValueByInterface(systemSetting.SSO_SAML_SP_KEYPAIR, &keyPair); err == nil && keyPair.Key != "" {
+		return keyPair, nil
+	}
+
+	keyPair, err := ssoSaml.GenerateKeyPair(TOTP_ISSUER)
+	if err != nil {
+		return keyPair, err
+	}
+	if err := global.SystemSetting.Set(systemSetting.SSO_SAML_SP_KEYPAIR, keyPair); err != nil {
+		return keyPair, err
+	}
+	return keyPair, nil
+}
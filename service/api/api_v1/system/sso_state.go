@@ -0,0 +1,71 @@
+package system
+
+import (
+	"encoding/json"
+	"strings"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/cmn"
+	"sun-panel/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SSO登录的服务端状态，state参数只作为随机键，不再携带用户token
+
+const (
+	SSO_STATE_PREFIX     = "sso_state_"
+	SSO_STATE_EXPIRATION = 10 * time.Minute
+
+	ssoBaseUrlContextKey = "ssoBaseUrl" // 当前请求使用的对外访问地址
+)
+
+type ssoState struct {
+	Provider     string `json:"provider"`
+	CodeVerifier string `json:"codeVerifier"` // PKCE
+	Nonce        string `json:"nonce"`        // OIDC
+	RequestId    string `json:"requestId"`    // SAML AuthnRequest ID
+	BindUserId   uint   `json:"bindUserId"`   // 绑定到已登录的用户，0为登录
+}
+
+// 保存状态，返回state
+func ssoStateSave(state ssoState) (string, error) {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	key := cmn.BuildSecureRandToken(32)
+	global.VerifyCodeCachePool.Set(SSO_STATE_PREFIX+key, string(value), SSO_STATE_EXPIRATION)
+	return key, nil
+}
+
+// 取出状态（一次性），不存在、过期或提供商不一致时返回false
+func ssoStateTake(key, provider string) (ssoState, bool) {
+	state := ssoState{}
+	if key == "" {
+		return state, false
+	}
+	value, ok := global.VerifyCodeCachePool.Get(SSO_STATE_PREFIX + key)
+	if !ok {
+		return state, false
+	}
+	global.VerifyCodeCachePool.Delete(SSO_STATE_PREFIX + key)
+	if err := json.Unmarshal([]byte(value), &state); err != nil || state.Provider != provider {
+		return state, false
+	}
+	return state, true
+}
+
+// 提供商的对外访问地址：提供商配置 > 系统设置的站点地址 > 请求地址
+// 同时记录到上下文中，供回跳前端使用
+func ssoBaseUrl(c *gin.Context, config *models.SsoConfig) string {
+	baseUrl := ""
+	if ext, err := config.GetExt(); err == nil && ext.BaseUrl != "" {
+		baseUrl = strings.TrimRight(ext.BaseUrl, "/")
+	} else {
+		baseUrl = base.GetSiteUrl(c)
+	}
+	c.Set(ssoBaseUrlContextKey, baseUrl)
+	return baseUrl
+}
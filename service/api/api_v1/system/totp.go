@@ -0,0 +1,228 @@
+package system
+
+import (
+	"strconv"
+	"sun-panel/api/api_v1/common/apiReturn"
+	"sun-panel/api/api_v1/common/base"
+	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/password"
+	"sun-panel/lib/permission"
+	"sun-panel/lib/totp"
+	"sun-panel/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// 两步验证(TOTP)
+type TotpApi struct{}
+
+const TOTP_ISSUER = "Sun-Panel"
+
+type totpCodeReq struct {
+	Code string `json:"code" validate:"required,max=20"`
+}
+
+// 获取当前用户两步验证状态
+func (a *TotpApi) GetStatus(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+
+	mUserTotp := models.UserTotp{}
+	record, err := mUserTotp.GetByUserId(userInfo.ID)
+	enabled := err == nil && record.Enabled == 1
+	recoveryCodeCount := 0
+	if enabled {
+		recoveryCodeCount = len(record.GetRecoveryCodes())
+	}
+
+	apiReturn.SuccessData(c, gin.H{
+		"enabled":           enabled,
+		"required":          settings.AdminRequireTotp && permission.Has(userInfo.Role, permission.MANAGE_SYSTEM),
+		"recoveryCodeCount": recoveryCodeCount,
+	})
+}
+
+// 生成密钥，待验证后启用
+func (a *TotpApi) Setup(c *gin.Context) {
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	mUserTotp := models.UserTotp{}
+	if mUserTotp.IsEnabled(userInfo.ID) {
+		apiReturn.Error(c, "Two-factor authentication is already enabled")
+		return
+	}
+
+	key, err := totpSetupPending(userInfo)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	apiReturn.SuccessData(c, key)
+}
+
+// 验证动态码并启用，返回恢复码
+func (a *TotpApi) Enable(c *gin.Context) {
+	req := totpCodeReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	mUserTotp := models.UserTotp{}
+	record, err := mUserTotp.GetByUserId(userInfo.ID)
+	if err != nil {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	}
+	if record.Enabled == 1 {
+		apiReturn.Error(c, "Two-factor authentication is already enabled")
+		return
+	}
+
+	if !totpValidateOnce(userInfo.ID, req.Code, record.Secret) {
+		apiReturn.ErrorByCode(c, 1009)
+		return
+	}
+
+	codes, hashes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	if err := mUserTotp.Enable(userInfo.ID, hashes); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+
+	apiReturn.SuccessData(c, gin.H{"recoveryCodes": codes})
+}
+
+// 关闭两步验证，需要密码和动态码（或恢复码）
+func (a *TotpApi) Disable(c *gin.Context) {
+	type Req struct {
+		Password string `json:"password" validate:"required,max=50"`
+		Code     string `json:"code" validate:"required,max=20"`
+	}
+	req := Req{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	mUser := models.User{}
+	user, err := mUser.GetUserInfoByUid(userInfo.ID)
+	if err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	if ok, _ := password.Verify(req.Password, user.Password); !ok {
+		apiReturn.ErrorByCode(c, 1007)
+		return
+	}
+
+	mUserTotp := models.UserTotp{}
+	record, err := mUserTotp.GetByUserId(userInfo.ID)
+	if err != nil || record.Enabled != 1 {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	}
+	if !totpVerify(userInfo.ID, record, req.Code) {
+		apiReturn.ErrorByCode(c, 1009)
+		return
+	}
+
+	if err := mUserTotp.DeleteByUserId(global.Db, userInfo.ID); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.Success(c)
+}
+
+// 重新生成恢复码，旧的恢复码全部失效
+func (a *TotpApi) RegenerateRecoveryCodes(c *gin.Context) {
+	req := totpCodeReq{}
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		apiReturn.ErrorParamFomat(c, err.Error())
+		return
+	}
+	if errMsg, err := base.ValidateInputStruct(req); err != nil {
+		apiReturn.ErrorParamFomat(c, errMsg)
+		return
+	}
+
+	userInfo, _ := base.GetCurrentUserInfo(c)
+	mUserTotp := models.UserTotp{}
+	record, err := mUserTotp.GetByUserId(userInfo.ID)
+	if err != nil || record.Enabled != 1 {
+		apiReturn.ErrorDataNotFound(c)
+		return
+	}
+	if !totpValidateOnce(userInfo.ID, req.Code, record.Secret) {
+		apiReturn.ErrorByCode(c, 1009)
+		return
+	}
+
+	codes, hashes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
+	if err := mUserTotp.SetRecoveryCodes(userInfo.ID, hashes); err != nil {
+		apiReturn.ErrorDatabase(c, err.Error())
+		return
+	}
+	apiReturn.SuccessData(c, gin.H{"recoveryCodes": codes})
+}
+
+// 生成并保存待验证的密钥
+func totpSetupPending(userInfo models.User) (totp.Key, error) {
+	key, err := totp.GenerateKey(TOTP_ISSUER, userInfo.Username)
+	if err != nil {
+		return key, err
+	}
+	mUserTotp := models.UserTotp{}
+	if err := mUserTotp.SavePending(userInfo.ID, key.Secret); err != nil {
+		return key, err
+	}
+	return key, nil
+}
+
+// 验证动态码，同一个动态码在有效期内只能使用一次
+func totpValidateOnce(userId uint, code, secret string) bool {
+	if !totp.Validate(code, secret) {
+		return false
+	}
+	usedKey := "totp_used_" + strconv.Itoa(int(userId)) + "_" + code
+	if _, used := global.VerifyCodeCachePool.Get(usedKey); used {
+		return false
+	}
+	global.VerifyCodeCachePool.Set(usedKey, "1", 90*time.Second)
+	return true
+}
+
+// 验证动态码或恢复码，恢复码使用后作废
+func totpVerify(userId uint, record models.UserTotp, code string) bool {
+	if totpValidateOnce(userId, code, record.Secret) {
+		return true
+	}
+
+	remaining, ok := totp.UseRecoveryCode(code, record.GetRecoveryCodes())
+	if !ok {
+		return false
+	}
+	mUserTotp := models.UserTotp{}
+	return mUserTotp.SetRecoveryCodes(userId, remaining) == nil
+}
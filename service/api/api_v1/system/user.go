@@ -6,6 +6,9 @@ import (
 	"sun-panel/api/api_v1/common/base"
 	"sun-panel/global"
 	"sun-panel/lib/cmn"
+	"sun-panel/lib/password"
+	"sun-panel/lib/permission"
+	"sun-panel/lib/session"
 	"sun-panel/models"
 
 	"github.com/gin-gonic/gin"
@@ -17,11 +20,12 @@ type UserApi struct{}
 func (a *UserApi) GetInfo(c *gin.Context) {
 	userInfo, _ := base.GetCurrentUserInfo(c)
 	apiReturn.SuccessData(c, gin.H{
-		"userId":    userInfo.ID,
-		"id":        userInfo.ID,
-		"headImage": userInfo.HeadImage,
-		"name":      userInfo.Name,
-		"role":      userInfo.Role,
+		"userId":      userInfo.ID,
+		"id":          userInfo.ID,
+		"headImage":   userInfo.HeadImage,
+		"name":        userInfo.Name,
+		"role":        userInfo.Role,
+		"permissions": permission.GetByRoleId(userInfo.Role),
 		// "token":     userInfo.Token,
 
 	})
@@ -95,22 +99,28 @@ func (a *UserApi) UpdatePasssword(c *gin.Context) {
 		apiReturn.ErrorParamFomat(c, err.Error())
 		return
 	} else {
-		if v.Password != cmn.PasswordEncryption(params.OldPassword) {
+		if ok, _ := password.Verify(params.OldPassword, v.Password); !ok {
 			// 旧密码不正确
 			apiReturn.ErrorByCode(c, 1007)
 			return
 		}
 	}
+	encoded, err := password.Hash(params.NewPassword)
+	if err != nil {
+		apiReturn.Error(c, err.Error())
+		return
+	}
 	res := global.Db.Model(&models.User{}).Where("id", userInfo.ID).Updates(map[string]interface{}{
-		"password": cmn.PasswordEncryption(params.NewPassword),
+		"password": encoded,
 		"token":    "",
 	})
 	if res.Error != nil {
 		apiReturn.ErrorDatabase(c, res.Error.Error())
 		return
 	}
-	// 删除token
+	// 删除token，并退出全部会话
 	global.UserToken.Delete(userInfo.Token)
+	session.RevokeAll(userInfo.ID)
 	apiReturn.Success(c)
 }
 
@@ -6,6 +6,7 @@ import (
 	"sun-panel/lib/cmn/systemSetting"
 	"sun-panel/lib/iniConfig"
 	"sun-panel/lib/language"
+	"sun-panel/lib/loginGuard"
 	"sun-panel/models"
 
 	redis "github.com/redis/go-redis/v9"
@@ -37,4 +38,6 @@ var (
 	SystemSetting       *systemSetting.SystemSettingCache
 	SystemMonitor       cache.Cacher[interface{}]
 	RateLimit           *RateLimiter
+	LoginGuard          *loginGuard.Guard
+	RolePermission      cache.Cacher[[]string] // 角色ID => 权限列表
 )
@@ -9,12 +9,19 @@ import (
 	"sun-panel/initialize/config"
 	"sun-panel/initialize/database"
 	"sun-panel/initialize/lang"
+	"sun-panel/initialize/loginGuardCache"
 	"sun-panel/initialize/other"
 	"sun-panel/initialize/redis"
 	"sun-panel/initialize/runlog"
 	"sun-panel/initialize/systemSettingCache"
 	"sun-panel/initialize/userToken"
+	"sun-panel/lib/auditLog"
 	"sun-panel/lib/cmn"
+	"sun-panel/lib/healthCheck"
+	"sun-panel/lib/panelConfig"
+	"sun-panel/lib/password"
+	"sun-panel/lib/permission"
+	"sun-panel/lib/secret"
 	"sun-panel/models"
 	"sun-panel/structs"
 	"time"
@@ -57,8 +64,22 @@ func InitApp() error {
 	// 多语言初始化
 	lang.LangInit("zh-cn") // en-us
 
+	PasswordHasherInit()
+	SecretInit()
+
 	DatabaseConnect()
 
+	// 内置角色
+	if err := permission.InitRoles(); err != nil {
+		global.Logger.Errorln("Failed to initialize roles:", err)
+	}
+
+	// 旧的明文SSO密钥加密保存
+	mSsoConfig := models.SsoConfig{}
+	if err := mSsoConfig.EncryptPlainSecrets(); err != nil {
+		global.Logger.Errorln("Failed to encrypt sso client secrets:", err)
+	}
+
 	// Redis 连接
 	{
 		// 判断是否有使用redis的驱动，没有将不连接
@@ -90,6 +111,30 @@ func InitApp() error {
 	global.VerifyCodeCachePool = other.InitVerifyCodeCachePool()
 	global.SystemSetting = systemSettingCache.InItSystemSettingCache()
 	global.SystemMonitor = global.NewCache[interface{}](5*time.Hour, -1, "systemMonitorCache")
+	global.LoginGuard = loginGuardCache.InitLoginGuard()
+	global.RolePermission = global.NewCache[[]string](10*time.Minute, 10*time.Minute, "rolePermissionCache")
+
+	// 定时清理过期的审计日志
+	auditLog.StartCleanup(24 * time.Hour)
+
+	// 服务健康检查
+	{
+		workers := global.Config.GetValueInt("base", "health_check_workers")
+		if workers < 1 {
+			workers = 8
+		}
+		healthCheck.Start(workers)
+		healthCheck.StartHistoryCompaction(5 * time.Minute)
+	}
+
+	// 声明式面板配置，应用配置文件并监听变化
+	if path := global.Config.GetValueString("base", "panel_config_file"); path != "" {
+		interval := global.Config.GetValueInt("base", "panel_config_interval")
+		if interval < 1 {
+			interval = 10
+		}
+		panelConfig.StartWatch(path, time.Duration(interval)*time.Second)
+	}
 
 	return nil
 }
@@ -126,15 +171,44 @@ func DatabaseConnect() {
 	database.NotFoundAndCreateUser(global.Db)
 }
 
+// 密码哈希算法，未配置时使用默认的bcrypt
+func PasswordHasherInit() {
+	hasher := global.Config.GetValueString("base", "password_hasher")
+	if err := password.SetDefault(hasher); err != nil {
+		log.Panicln("Password hasher initialization error", hasher, err)
+	}
+}
+
+// 敏感配置加密密钥初始化，未配置时自动生成并写入配置文件
+func SecretInit() {
+	key := global.Config.GetValueString("base", "secret_key")
+	if key == "" {
+		key = cmn.BuildSecureRandToken(32) // 32字节随机数
+		if err := global.Config.SetValue("base", "secret_key", key); err != nil {
+			log.Panicln("Failed to save secret_key to the configuration file", err)
+		}
+		global.Logger.Infoln("secret_key has been generated and saved to the configuration file")
+	}
+	if err := secret.SetKey(key); err != nil {
+		log.Panicln("Secret initialization error", err)
+	}
+}
+
 // 命令行运行
 func CommandRun() {
 	var (
-		cfg bool
-		pwd bool
+		cfg             bool
+		pwd             bool
+		username        string
+		panelConfigFile string
+		panelConfigDump string
 	)
 
 	flag.BoolVar(&cfg, "config", false, "Generate configuration file")
-	flag.BoolVar(&pwd, "password-reset", false, "Reset the password of the first user")
+	flag.BoolVar(&pwd, "password-reset", false, "Reset the password of a user to a random password")
+	flag.StringVar(&username, "username", "", "The user to reset with -password-reset, defaults to the first administrator")
+	flag.StringVar(&panelConfigFile, "panel-config-validate", "", "Validate a declarative panel configuration file (YAML)")
+	flag.StringVar(&panelConfigDump, "panel-config-dump", "", "Save the current panels to a declarative configuration file (YAML), limited to -username if set")
 
 	flag.Parse()
 
@@ -152,35 +226,112 @@ func CommandRun() {
 		config, _ := config.ConfigInit()
 		global.Config = config
 
+		PasswordHasherInit()
 		DatabaseConnect()
 		userInfo := models.User{}
-		if err := global.Db.Where("role=?", 1).Order("id").First(&userInfo).Error; err != nil {
+		query := global.Db.Where("role=?", 1).Order("id")
+		if username != "" {
+			query = global.Db.Where("username=?", username)
+		}
+		if err := query.First(&userInfo).Error; err != nil {
 			fmt.Println("ERROR", err.Error())
 			os.Exit(0) // 务必退出
 		}
 
-		newPassword := "12345678"
+		newPassword := cmn.BuildSecureRandCode(12, cmn.RAND_CODE_MODE1)
+		encoded, err := password.Hash(newPassword)
+		if err != nil {
+			fmt.Println("ERROR", err.Error())
+			os.Exit(0) // 务必退出
+		}
 
 		updateInfo := models.User{
-			Password: cmn.PasswordEncryption(newPassword),
+			Password: encoded,
 			Token:    "",
 		}
-		// 重置第一个管理员的密码
+		// 重置指定账号（默认第一个管理员）的密码
 		if err := global.Db.Select("Password", "Token").Where("id=?", userInfo.ID).Updates(&updateInfo).Error; err != nil {
 			fmt.Println("ERROR", err.Error())
 			os.Exit(0) // 务必退出
 		}
+		// 清除该账号的全部登录会话
+		mUserSession := models.UserSession{}
+		if err := mUserSession.DeleteByUserId(global.Db, userInfo.ID); err != nil {
+			fmt.Println("ERROR", err.Error())
+			os.Exit(0) // 务必退出
+		}
 
 		fmt.Println("The password has been successfully reset. Here is the account information")
 		fmt.Println("Username ", userInfo.Username)
 		fmt.Println("Password ", newPassword)
 		os.Exit(0) // 务必退出
+	} else if panelConfigFile != "" {
+		// 校验声明式面板配置文件
+		panelConfigValidate(panelConfigFile)
+		os.Exit(0) // 务必退出
+	} else if panelConfigDump != "" {
+		// 导出当前的面板为声明式配置文件
+		panelConfigDumpRun(panelConfigDump, username)
+		os.Exit(0) // 务必退出
 	} else {
 		return
 	}
 	os.Exit(0) // 务必退出
 }
 
+func panelConfigValidate(path string) {
+	panelCfg, err := panelConfig.Load(path)
+	if err != nil {
+		fmt.Println("ERROR", err.Error())
+		os.Exit(1)
+	}
+
+	// 检查用户是否存在
+	cfg, _ := config.ConfigInit()
+	global.Config = cfg
+	DatabaseConnect()
+	unknown := []string{}
+	for _, v := range panelCfg.Users {
+		var count int64
+		if err := global.Db.Model(&models.User{}).Where("username=?", v.Username).Count(&count).Error; err != nil {
+			fmt.Println("ERROR", err.Error())
+			os.Exit(1)
+		} else if count == 0 {
+			unknown = append(unknown, v.Username)
+		}
+	}
+	if len(unknown) > 0 {
+		fmt.Println("WARNING unknown users will be skipped:", unknown)
+	}
+	fmt.Println("The panel configuration file is valid")
+}
+
+func panelConfigDumpRun(path string, username string) {
+	cfg, _ := config.ConfigInit()
+	global.Config = cfg
+	DatabaseConnect()
+
+	usernames := []string{}
+	if username != "" {
+		usernames = append(usernames, username)
+	}
+	dump, err := panelConfig.Dump(global.Db, usernames)
+	if err != nil {
+		fmt.Println("ERROR", err.Error())
+		os.Exit(1)
+	}
+	data, err := dump.Marshal()
+	if err != nil {
+		fmt.Println("ERROR", err.Error())
+		os.Exit(1)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		fmt.Println("ERROR", err.Error())
+		os.Exit(1)
+	}
+	fmt.Println("The panel configuration has been saved to", path)
+}
+
 func Logo() {
 	fmt.Println("     ____            ___                __")
 	fmt.Println("    / __/_ _____    / _ \\___ ____  ___ / /")
@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"sun-panel/lib/cmn"
+	"sun-panel/lib/password"
 	"sun-panel/models"
 	"time"
 
@@ -122,9 +123,18 @@ func CreateDatabase(driver string, db *gorm.DB) error {
 		&models.UserConfig{},
 		&models.File{},
 		&models.ItemIconGroup{},
+		&models.ItemIconGroupShare{},
+		&models.ItemIconHealthCheck{},
+		&models.ItemIconHealthHistory{},
 		&models.ModuleConfig{},
 		&models.UserAuth{},
 		&models.SsoConfig{},
+		&models.UserTotp{},
+		&models.UserPasskey{},
+		&models.UserSession{},
+		&models.UserApiToken{},
+		&models.AuditLog{},
+		&models.Role{},
 	)
 
 	return err
@@ -142,8 +152,12 @@ func NotFoundAndCreateUser(db *gorm.DB) error {
 		fUser.Username = username
 		fUser.Name = username
 		fUser.Status = 1
-		fUser.Role = 1
-		fUser.Password = cmn.PasswordEncryption("12345678")
+		fUser.Role = models.ROLE_ADMIN
+		encoded, err := password.Hash("12345678")
+		if err != nil {
+			return err
+		}
+		fUser.Password = encoded
 
 		if errCreate := db.Create(&fUser).Error; errCreate != nil {
 			return errCreate
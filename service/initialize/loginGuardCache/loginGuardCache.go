@@ -0,0 +1,14 @@
+package loginGuardCache
+
+import (
+	"sun-panel/global"
+	"sun-panel/lib/loginGuard"
+	"time"
+)
+
+// 登录失败记录与锁定索引
+func InitLoginGuard() *loginGuard.Guard {
+	records := global.NewCache[loginGuard.Record](15*time.Minute, 30*time.Minute, "LoginGuardRecord")
+	index := global.NewCache[[]string](0, -1, "LoginGuardIndex")
+	return loginGuard.New(records, index)
+}
@@ -0,0 +1,118 @@
+package apiToken
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"sun-panel/global"
+	"sun-panel/lib/cmn"
+	"sun-panel/models"
+	"time"
+)
+
+// 用户的API令牌，请求时使用 Authorization: Bearer <令牌>
+// 数据库中只保存令牌的sha256
+
+const (
+	TOKEN_PREFIX = "sp_"
+
+	SCOPE_ITEMS_READ  = "items:read"
+	SCOPE_ITEMS_WRITE = "items:write"
+	SCOPE_FILES_READ  = "files:read"
+	SCOPE_FILES_WRITE = "files:write"
+	SCOPE_ADMIN       = "admin" // 拥有全部权限，包括管理员接口
+
+	LAST_USED_INTERVAL   = time.Minute // 最后使用时间的更新间隔
+	LOGIN_AUDIT_INTERVAL = time.Hour   // 同一令牌登录审计日志的记录间隔
+
+	lastUsedCachePrefix   = "api_token_last_used_"
+	loginAuditCachePrefix = "api_token_login_audit_"
+)
+
+var Scopes = []string{SCOPE_ITEMS_READ, SCOPE_ITEMS_WRITE, SCOPE_FILES_READ, SCOPE_FILES_WRITE, SCOPE_ADMIN}
+
+var (
+	ErrInvalidToken = errors.New("invalid api token")
+	ErrExpiredToken = errors.New("api token has expired")
+)
+
+// 计算令牌的哈希
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// 生成令牌，32字节随机数
+func Generate() string {
+	return TOKEN_PREFIX + cmn.BuildSecureRandToken(32)
+}
+
+// 校验并整理权限范围，去重
+func NormalizeScopes(scopes []string) ([]string, error) {
+	res := []string{}
+	for _, v := range scopes {
+		v = strings.TrimSpace(v)
+		if !cmn.InArray(Scopes, v) {
+			return nil, errors.New("invalid scope: " + v)
+		}
+		if !cmn.InArray(res, v) {
+			res = append(res, v)
+		}
+	}
+	if len(res) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	return res, nil
+}
+
+// 是否拥有权限，admin拥有全部权限
+func HasScope(scopes []string, scope string) bool {
+	for _, v := range scopes {
+		if v == SCOPE_ADMIN || (scope != "" && v == scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// 令牌的权限列表
+func GetScopes(token models.UserApiToken) []string {
+	if token.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(token.Scopes, ",")
+}
+
+// 验证令牌，更新最后使用时间
+func Authenticate(token string) (models.UserApiToken, error) {
+	info := models.UserApiToken{}
+	if !strings.HasPrefix(token, TOKEN_PREFIX) {
+		return info, ErrInvalidToken
+	}
+	info, err := info.GetByTokenHash(HashToken(token))
+	if err != nil {
+		return info, ErrInvalidToken
+	}
+	if info.ExpiresAt != nil && time.Now().After(*info.ExpiresAt) {
+		return info, ErrExpiredToken
+	}
+
+	cacheKey := lastUsedCachePrefix + strconv.Itoa(int(info.ID))
+	if _, ok := global.VerifyCodeCachePool.Get(cacheKey); !ok {
+		global.VerifyCodeCachePool.Set(cacheKey, "1", LAST_USED_INTERVAL)
+		info.UpdateLastUsed(info.ID, time.Now())
+	}
+	return info, nil
+}
+
+// 令牌登录是否需要记录审计日志，每个令牌在间隔内只记录一次，避免每个请求都写入
+func ShouldAuditLogin(tokenId uint) bool {
+	cacheKey := loginAuditCachePrefix + strconv.Itoa(int(tokenId))
+	if _, ok := global.VerifyCodeCachePool.Get(cacheKey); ok {
+		return false
+	}
+	global.VerifyCodeCachePool.Set(cacheKey, "1", LOGIN_AUDIT_INTERVAL)
+	return true
+}
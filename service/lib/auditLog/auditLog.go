@@ -0,0 +1,171 @@
+package auditLog
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 审计日志：记录安全相关和管理类操作
+
+const (
+	ACTION_LOGIN                = "login"
+	ACTION_LOGIN_FAIL           = "login_fail"
+	ACTION_LOGOUT               = "logout"
+	ACTION_USER_CREATE          = "user_create"
+	ACTION_USER_UPDATE          = "user_update"
+	ACTION_USER_DELETE          = "user_delete"
+	ACTION_SSO_CONFIG_SAVE      = "sso_config_save"
+	ACTION_SSO_BIND             = "sso_bind"
+	ACTION_SSO_UNBIND           = "sso_unbind"
+	ACTION_PUBLIC_USER_SET      = "public_visit_user_set"
+	ACTION_SETTING_UPDATE       = "setting_update"
+	ACTION_ROLE_SAVE            = "role_save"
+	ACTION_ROLE_DELETE          = "role_delete"
+	ACTION_AUDIT_LOG_EXPORT     = "audit_log_export"
+	ACTION_PANEL_TEMPLATE_APPLY = "panel_template_apply"
+	ACTION_TOTP_RESET           = "totp_reset"
+	ACTION_SESSION_REVOKE       = "session_revoke"
+	ACTION_SESSION_REVOKE_ALL   = "session_revoke_all"
+	ACTION_LOGIN_LOCK_CLEAR     = "login_lock_clear"
+)
+
+const (
+	TARGET_USER       = "user"
+	TARGET_SSO_CONFIG = "sso_config"
+	TARGET_SETTING    = "setting"
+	TARGET_ROLE       = "role"
+)
+
+const secretMask = "******"
+
+// 敏感字段（不区分大小写，包含即匹配），变更内容中只记录掩码
+var secretFields = []string{"password", "secret", "token"}
+
+// 不记录的字段
+var ignoreFields = []string{"ID", "createTime", "updateTime", "CreatedAt", "UpdatedAt", "DeletedAt"}
+
+type change struct {
+	Old interface{} `json:"old,omitempty"`
+	New interface{} `json:"new,omitempty"`
+}
+
+// 写入日志，actor为操作人（未登录时为空），before、after为变更前后的数据，可为nil
+func Record(c *gin.Context, actor models.User, action, targetType string, targetId interface{}, before, after interface{}) {
+	log := models.AuditLog{
+		ActorId:    actor.ID,
+		ActorName:  actor.Username,
+		Action:     action,
+		TargetType: targetType,
+		Diff:       Diff(before, after),
+	}
+	if targetId != nil {
+		log.TargetId = fmt.Sprint(targetId)
+	}
+	if c != nil {
+		log.Ip = c.ClientIP()
+		log.UserAgent = cutString(c.Request.UserAgent(), 255)
+	}
+	if err := log.Create(); err != nil {
+		global.Logger.Errorln("Failed to write audit log:", action, err)
+	}
+}
+
+// 计算变更内容，返回JSON，无变化时返回空字符串
+func Diff(before, after interface{}) string {
+	oldMap := toMap(before)
+	newMap := toMap(after)
+	res := map[string]change{}
+	for k, v := range newMap {
+		if old, ok := oldMap[k]; ok && reflect.DeepEqual(old, v) {
+			continue
+		}
+		res[k] = change{Old: maskValue(k, oldMap[k]), New: maskValue(k, v)}
+	}
+	for k, v := range oldMap {
+		if _, ok := newMap[k]; !ok {
+			res[k] = change{Old: maskValue(k, v)}
+		}
+	}
+	if len(res) == 0 {
+		return ""
+	}
+	b, _ := json.Marshal(res)
+	return string(b)
+}
+
+// 转为字段map，非对象类型使用 value 作为字段名
+func toMap(v interface{}) map[string]interface{} {
+	res := map[string]interface{}{}
+	if v == nil {
+		return res
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return res
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		var value interface{}
+		json.Unmarshal(b, &value)
+		return map[string]interface{}{"value": value}
+	}
+	for _, f := range ignoreFields {
+		delete(res, f)
+	}
+	return res
+}
+
+func maskValue(field string, v interface{}) interface{} {
+	if v == nil || v == "" {
+		return v
+	}
+	lower := strings.ToLower(field)
+	for _, s := range secretFields {
+		if strings.Contains(lower, s) {
+			return secretMask
+		}
+	}
+	return v
+}
+
+func cutString(s string, length int) string {
+	if r := []rune(s); len(r) > length {
+		return string(r[:length])
+	}
+	return s
+}
+
+// 按系统设置的保留天数清理过期日志，0为永久保留
+func Cleanup() (int64, error) {
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	if settings.AuditLogRetentionDays <= 0 {
+		return 0, nil
+	}
+	mAuditLog := models.AuditLog{}
+	return mAuditLog.DeleteBefore(time.Now().AddDate(0, 0, -settings.AuditLogRetentionDays))
+}
+
+// 定时清理过期日志
+func StartCleanup(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if count, err := Cleanup(); err != nil {
+				global.Logger.Errorln("Failed to clean up audit log:", err)
+			} else if count > 0 {
+				global.Logger.Infoln("Audit log cleaned up:", count)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,286 @@
+package bookmark
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 书签导入：浏览器导出的 Netscape 书签 HTML，以及 Heimdall、Homer、Homarr、Dashy 的配置文件
+// 文件夹/分类对应分组，链接对应图标
+
+const (
+	FORMAT_AUTO     = "auto"
+	FORMAT_NETSCAPE = "netscape"
+	FORMAT_HEIMDALL = "heimdall"
+	FORMAT_HOMER    = "homer"
+	FORMAT_HOMARR   = "homarr"
+	FORMAT_DASHY    = "dashy"
+
+	DEFAULT_FOLDER = "Bookmarks" // 没有文件夹的链接
+)
+
+var Formats = []string{FORMAT_AUTO, FORMAT_NETSCAPE, FORMAT_HEIMDALL, FORMAT_HOMER, FORMAT_HOMARR, FORMAT_DASHY}
+
+var ErrUnknownFormat = errors.New("unknown bookmark file format")
+
+type Folder struct {
+	Title string `json:"title"`
+	Links []Link `json:"links"`
+}
+
+type Link struct {
+	Title       string `json:"title"`
+	Url         string `json:"url"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`  // 图标地址，仅支持 http(s)
+	Color       string `json:"color"` // 背景颜色
+}
+
+// 解析文件，format 为 auto 时自动识别，返回识别的格式
+func Parse(data []byte, format string) ([]Folder, string, error) {
+	if format == "" || format == FORMAT_AUTO {
+		format = detect(data)
+	}
+	if format == FORMAT_NETSCAPE {
+		folders, err := ParseNetscape(data)
+		return folders, format, err
+	}
+
+	// YAML 兼容 JSON
+	var config interface{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, format, fmt.Errorf("%w: %s", ErrUnknownFormat, err.Error())
+	}
+	if format == "" {
+		format = detectConfig(config)
+	}
+
+	var folders []Folder
+	switch format {
+	case FORMAT_HEIMDALL:
+		folders = parseHeimdall(config)
+	case FORMAT_HOMER:
+		folders = parseHomer(config)
+	case FORMAT_HOMARR:
+		folders = parseHomarr(config)
+	case FORMAT_DASHY:
+		folders = parseDashy(config)
+	default:
+		return nil, format, ErrUnknownFormat
+	}
+	return clean(folders), format, nil
+}
+
+func detect(data []byte) string {
+	head := bytes.ToUpper(data[:min(len(data), 4096)])
+	if bytes.Contains(head, []byte("NETSCAPE-BOOKMARK-FILE")) || bytes.Contains(head, []byte("<DL")) {
+		return FORMAT_NETSCAPE
+	}
+	return ""
+}
+
+func detectConfig(config interface{}) string {
+	if _, ok := config.([]interface{}); ok {
+		return FORMAT_HEIMDALL
+	}
+	m, ok := config.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch {
+	case m["sections"] != nil:
+		return FORMAT_DASHY
+	case m["apps"] != nil || m["categories"] != nil:
+		return FORMAT_HOMARR
+	case m["services"] != nil:
+		// Homer 的 services 为分组（含items），旧版 Homarr 的 services 为链接
+		for _, v := range toList(m["services"]) {
+			if toMap(v)["items"] != nil {
+				return FORMAT_HOMER
+			}
+		}
+		return FORMAT_HOMARR
+	case m["items"] != nil:
+		return FORMAT_HEIMDALL
+	}
+	return ""
+}
+
+// Heimdall：应用列表 [{title, url, colour, description, icon}]
+func parseHeimdall(config interface{}) []Folder {
+	list := toList(config)
+	if m := toMap(config); m != nil {
+		list = toList(m["items"])
+	}
+	folder := Folder{Title: "Heimdall"}
+	for _, v := range list {
+		item := toMap(v)
+		folder.Links = append(folder.Links, Link{
+			Title:       getString(item, "title", "name"),
+			Url:         getString(item, "url"),
+			Description: getString(item, "description"),
+			Icon:        getString(item, "icon"),
+			Color:       getString(item, "colour", "color"),
+		})
+	}
+	return []Folder{folder}
+}
+
+// Homer：services: [{name, items: [{name, url, subtitle, logo}]}]
+func parseHomer(config interface{}) []Folder {
+	folders := []Folder{}
+	for _, v := range toList(toMap(config)["services"]) {
+		service := toMap(v)
+		folder := Folder{Title: getString(service, "name")}
+		for _, i := range toList(service["items"]) {
+			item := toMap(i)
+			folder.Links = append(folder.Links, Link{
+				Title:       getString(item, "name"),
+				Url:         getString(item, "url"),
+				Description: getString(item, "subtitle"),
+				Icon:        getString(item, "logo"),
+				Color:       getString(item, "background"),
+			})
+		}
+		folders = append(folders, folder)
+	}
+	return folders
+}
+
+// Homarr：apps + categories（新版），或 services: [{name, url, icon, category}]（旧版）
+func parseHomarr(config interface{}) []Folder {
+	m := toMap(config)
+	categories := map[string]string{}
+	for _, v := range toList(m["categories"]) {
+		category := toMap(v)
+		categories[getString(category, "id")] = getString(category, "name")
+	}
+
+	folderMap := map[string]*Folder{}
+	folders := []*Folder{}
+	add := func(title string, link Link) {
+		if title == "" {
+			title = "Homarr"
+		}
+		if _, ok := folderMap[title]; !ok {
+			folderMap[title] = &Folder{Title: title}
+			folders = append(folders, folderMap[title])
+		}
+		folderMap[title].Links = append(folderMap[title].Links, link)
+	}
+
+	for _, v := range toList(m["apps"]) {
+		app := toMap(v)
+		link := Link{
+			Title: getString(app, "name"),
+			Url:   getString(toMap(app["behaviour"]), "externalUrl"),
+			Icon:  getString(toMap(app["appearance"]), "iconUrl"),
+		}
+		if link.Url == "" {
+			link.Url = getString(app, "url")
+		}
+		area := toMap(app["area"])
+		category := ""
+		if getString(area, "type") == "category" {
+			category = categories[getString(toMap(area["properties"]), "id")]
+		}
+		add(category, link)
+	}
+	for _, v := range toList(m["services"]) {
+		service := toMap(v)
+		add(getString(service, "category"), Link{
+			Title: getString(service, "name"),
+			Url:   getString(service, "url"),
+			Icon:  getString(service, "icon"),
+		})
+	}
+
+	res := []Folder{}
+	for _, v := range folders {
+		res = append(res, *v)
+	}
+	return res
+}
+
+// Dashy：sections: [{name, items: [{title, url, description, icon}]}]
+func parseDashy(config interface{}) []Folder {
+	folders := []Folder{}
+	for _, v := range toList(toMap(config)["sections"]) {
+		section := toMap(v)
+		folder := Folder{Title: getString(section, "name")}
+		for _, i := range toList(section["items"]) {
+			item := toMap(i)
+			folder.Links = append(folder.Links, Link{
+				Title:       getString(item, "title"),
+				Url:         getString(item, "url"),
+				Description: getString(item, "description"),
+				Icon:        getString(item, "icon"),
+				Color:       getString(item, "backgroundColor"),
+			})
+		}
+		folders = append(folders, folder)
+	}
+	return folders
+}
+
+// 去除无效链接和空分组，图标只保留 http(s) 地址
+func clean(folders []Folder) []Folder {
+	res := []Folder{}
+	for _, folder := range folders {
+		folder.Title = strings.TrimSpace(folder.Title)
+		if folder.Title == "" {
+			folder.Title = DEFAULT_FOLDER
+		}
+		links := []Link{}
+		for _, link := range folder.Links {
+			link.Url = strings.TrimSpace(link.Url)
+			if !IsHttpUrl(link.Url) {
+				continue
+			}
+			link.Title = strings.TrimSpace(link.Title)
+			if link.Title == "" {
+				link.Title = link.Url
+			}
+			if !IsHttpUrl(link.Icon) {
+				link.Icon = ""
+			}
+			links = append(links, link)
+		}
+		if len(links) > 0 {
+			folder.Links = links
+			res = append(res, folder)
+		}
+	}
+	return res
+}
+
+func IsHttpUrl(s string) bool {
+	s = strings.ToLower(s)
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+func toMap(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func toList(v interface{}) []interface{} {
+	l, _ := v.([]interface{})
+	return l
+}
+
+// 获取第一个不为空的字符串字段
+func getString(m map[string]interface{}, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := m[k]; ok && v != nil {
+			if s := strings.TrimSpace(fmt.Sprint(v)); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
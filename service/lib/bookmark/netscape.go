@@ -0,0 +1,130 @@
+package bookmark
+
+import (
+	"bytes"
+	"html"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// 解析 Netscape 书签 HTML（Chrome、Firefox、Edge 等导出）
+// 多级文件夹展开为一级，链接归属于最近的文件夹
+func ParseNetscape(data []byte) ([]Folder, error) {
+	folders := []*Folder{}
+	folderMap := map[string]*Folder{}
+	stack := []string{}  // 当前所在的文件夹
+	pendingFolder := ""  // 最近的 H3，遇到 DL 时入栈
+	var lastLink *Link   // 最近的链接，DD 为其描述
+	var readText *string // 正在读取文本的目标
+	var textTag string   // 读取文本的结束标签
+	var link Link
+
+	current := func() string {
+		if len(stack) == 0 || stack[len(stack)-1] == "" {
+			return DEFAULT_FOLDER
+		}
+		return stack[len(stack)-1]
+	}
+
+	z := xhtml.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			break
+		}
+		token := z.Token()
+		switch tt {
+		case xhtml.StartTagToken:
+			switch token.Data {
+			case "h3":
+				pendingFolder = ""
+				readText, textTag = &pendingFolder, "h3"
+			case "dl":
+				stack = append(stack, pendingFolder)
+				pendingFolder = ""
+			case "a":
+				link = Link{}
+				for _, attr := range token.Attr {
+					switch attr.Key {
+					case "href":
+						link.Url = attr.Val
+					case "icon_uri":
+						link.Icon = attr.Val
+					}
+				}
+				readText, textTag = &link.Title, "a"
+			case "dd":
+				if lastLink != nil {
+					readText, textTag = &lastLink.Description, "dd"
+				}
+			case "dt":
+				if textTag == "dd" {
+					readText, textTag = nil, ""
+				}
+				lastLink = nil
+			}
+		case xhtml.EndTagToken:
+			switch token.Data {
+			case "dl":
+				if len(stack) > 0 {
+					stack = stack[:len(stack)-1]
+				}
+				lastLink = nil
+			case "a":
+				if textTag != "a" {
+					break
+				}
+				readText, textTag = nil, ""
+				title := current()
+				if _, ok := folderMap[title]; !ok {
+					folderMap[title] = &Folder{Title: title}
+					folders = append(folders, folderMap[title])
+				}
+				folder := folderMap[title]
+				folder.Links = append(folder.Links, link)
+				lastLink = &folder.Links[len(folder.Links)-1]
+			}
+			if token.Data == textTag {
+				readText, textTag = nil, ""
+			}
+		case xhtml.TextToken:
+			if readText != nil {
+				*readText += token.Data
+			}
+		}
+	}
+
+	res := []Folder{}
+	for _, v := range folders {
+		for i := range v.Links {
+			v.Links[i].Description = strings.TrimSpace(v.Links[i].Description)
+		}
+		res = append(res, *v)
+	}
+	return clean(res), nil
+}
+
+// 导出为 Netscape 书签 HTML
+func ExportNetscape(folders []Folder) []byte {
+	buf := bytes.Buffer{}
+	buf.WriteString("<!DOCTYPE NETSCAPE-Bookmark-file-1>\n")
+	buf.WriteString("<META HTTP-EQUIV=\"Content-Type\" CONTENT=\"text/html; charset=UTF-8\">\n")
+	buf.WriteString("<TITLE>Bookmarks</TITLE>\n<H1>Bookmarks</H1>\n<DL><p>\n")
+	for _, folder := range folders {
+		buf.WriteString("    <DT><H3>" + html.EscapeString(folder.Title) + "</H3>\n    <DL><p>\n")
+		for _, link := range folder.Links {
+			buf.WriteString("        <DT><A HREF=\"" + html.EscapeString(link.Url) + "\"")
+			if link.Icon != "" {
+				buf.WriteString(" ICON_URI=\"" + html.EscapeString(link.Icon) + "\"")
+			}
+			buf.WriteString(">" + html.EscapeString(link.Title) + "</A>\n")
+			if link.Description != "" {
+				buf.WriteString("        <DD>" + html.EscapeString(link.Description) + "\n")
+			}
+		}
+		buf.WriteString("    </DL><p>\n")
+	}
+	buf.WriteString("</DL><p>\n")
+	return buf.Bytes()
+}
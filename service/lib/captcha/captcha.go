@@ -1,6 +1,7 @@
 package captcha
 
 import (
+	"io"
 	"sun-panel/global"
 
 	"github.com/gin-gonic/gin"
@@ -32,6 +33,20 @@ func GenerateCaptchaHandler(id string, width, height int) string {
 	return item.EncodeB64string()
 }
 
+// 生成图形验证码并写入PNG图片
+func WriteCaptchaImage(w io.Writer, id string, width, height int) error {
+	var driver = NewDriver(width, height).ConvertFonts()
+	_, content, answer := driver.GenerateIdQuestionAnswer()
+
+	item, err := driver.DrawCaptcha(content)
+	if err != nil {
+		return err
+	}
+	Store.Set(id, answer)
+	_, err = item.WriteTo(w)
+	return err
+}
+
 // 验证
 func CaptchaVerifyHandle(id, vcode string) bool {
 	return Store.Verify(id, vcode, true)
@@ -3,8 +3,11 @@ package cmn
 import (
 	// "calendar-note-gin/assets"
 	"crypto/md5"
+	crand "crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"math/big"
 	"math/rand"
 	"os"
 	"path"
@@ -81,6 +84,33 @@ func BuildRandCodeBySeed(count int, secret_content string, seed int64) (code str
 	return code
 }
 
+// 使用 crypto/rand 随机生成编码，用于令牌、密钥、验证码等安全相关的场景
+// 随机码字典内容 参考常量 RAND_CODE_MODE*
+func BuildSecureRandCode(count int, secret_content string) string {
+	if secret_content == "" {
+		secret_content = RAND_CODE_MODE1
+	}
+	max := big.NewInt(int64(len(secret_content)))
+	code := make([]byte, count)
+	for i := 0; i < count; i++ {
+		n, err := crand.Int(crand.Reader, max)
+		if err != nil {
+			panic(err)
+		}
+		code[i] = secret_content[n.Int64()]
+	}
+	return string(code)
+}
+
+// 使用 crypto/rand 生成 size 字节的随机数，base64url 编码（无填充）
+func BuildSecureRandToken(size int) string {
+	b := make([]byte, size)
+	if _, err := crand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
 func InSlice(items []string, item string) bool {
 	for _, eachItem := range items {
 		if eachItem == item {
@@ -212,8 +242,3 @@ func AssetsTakeFileToPath(assetsPath, targetPath string) error {
 	}
 	return os.WriteFile(targetPath, bytes, 0666)
 }
-
-// 密码加密
-func PasswordEncryption(password string) string {
-	return Md5(Md5(Md5(password)))
-}
@@ -10,11 +10,15 @@ import (
 )
 
 const (
-	SYSTEM_APPLICATION    = "system_application"
-	SYSTEM_EMAIL          = "system_email"
-	DISCLAIMER            = "disclaimer"            // 免责声明 储存类型：字符串
-	WEB_ABOUT_DESCRIPTION = "web_about_description" // 关于的描述信息
-	PANEL_PUBLIC_USER_ID  = "panel_public_user_id"  // 公开访问模式用户id *uint|null
+	SYSTEM_APPLICATION     = "system_application"
+	SYSTEM_EMAIL           = "system_email"
+	SYSTEM_LDAP            = "system_ldap"
+	SYSTEM_FORWARD_AUTH    = "system_forward_auth"
+	DISCLAIMER             = "disclaimer"             // 免责声明 储存类型：字符串
+	WEB_ABOUT_DESCRIPTION  = "web_about_description"  // 关于的描述信息
+	PANEL_PUBLIC_USER_ID   = "panel_public_user_id"   // 公开访问模式用户id *uint|null
+	PANEL_TEMPLATE_USER_ID = "panel_template_user_id" // 新用户默认面板模板用户id *uint|null
+	SSO_SAML_SP_KEYPAIR    = "sso_saml_sp_keypair"    // SAML SP签名密钥与证书
 )
 
 type SystemSettingCache struct {
@@ -25,7 +29,37 @@ type Email struct {
 	Host     string `json:"host" binding:"required"`
 	Port     int    `json:"port" binding:"required"`
 	Mail     string `json:"mail" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Password string `json:"password" binding:"required"` // 加密存储，见 lib/secret
+}
+
+// LDAP登录，过滤器中的 {username} {dn} 会被替换为转义后的值
+type Ldap struct {
+	Enabled            bool   `json:"enabled"`
+	Url                string `json:"url"`                // ldap://host:389 或 ldaps://host:636
+	StartTls           bool   `json:"startTls"`           // ldap:// 连接后升级为TLS
+	InsecureSkipVerify bool   `json:"insecureSkipVerify"` // 不校验服务器证书
+	BindDn             string `json:"bindDn"`             // 查询用户使用的账号，为空时匿名查询
+	BindPassword       string `json:"bindPassword"`       // 加密存储，见 lib/secret
+	BaseDn             string `json:"baseDn"`
+	UserFilter         string `json:"userFilter"` // 如 (&(objectClass=person)(uid={username}))
+	AttrUsername       string `json:"attrUsername"`
+	AttrName           string `json:"attrName"`
+	AttrEmail          string `json:"attrEmail"`
+	AdminGroupFilter   string `json:"adminGroupFilter"` // 如 (&(cn=admins)(member={dn}))，能查询到结果的为管理员，为空不同步角色
+	GroupBaseDn        string `json:"groupBaseDn"`      // 为空时使用BaseDn
+}
+
+// 反向代理认证，只信任来自可信代理的请求头
+type ForwardAuth struct {
+	Enabled        bool     `json:"enabled"`
+	TrustedProxies []string `json:"trustedProxies"` // 可信代理的IP或CIDR，直接连接的地址需在其中
+	HeaderUser     string   `json:"headerUser"`     // 为空时使用 Remote-User
+	HeaderEmail    string   `json:"headerEmail"`    // 为空时使用 Remote-Email
+	HeaderName     string   `json:"headerName"`     // 为空时使用 Remote-Name
+	HeaderGroups   string   `json:"headerGroups"`   // 为空时使用 Remote-Groups，多个组以逗号分隔
+	AutoRegister   bool     `json:"autoRegister"`   // 用户不存在时自动创建
+	LinkLocalUser  bool     `json:"linkLocalUser"`  // 允许按用户名关联未绑定的本地账号
+	AdminGroups    []string `json:"adminGroups"`    // 属于其中任一组为管理员，其他为普通用户；为空不同步角色
 }
 
 type Register struct {
@@ -34,13 +68,25 @@ type Register struct {
 }
 
 type Login struct {
-	LoginCaptcha bool `json:"loginCaptcha"` // 登录验证码
+	LoginCaptcha           bool `json:"loginCaptcha"`           // 登录验证码
+	LoginCaptchaAfterFails int  `json:"loginCaptchaAfterFails"` // 自适应验证码：失败多少次后才需要验证码，0始终需要
+	AdminRequireTotp       bool `json:"adminRequireTotp"`       // 管理员必须启用两步验证
+
+	// 登录防爆破，0使用默认值，小于0不限制
+	LoginMaxFailUsername int `json:"loginMaxFailUsername"` // 同一账号允许连续失败次数
+	LoginMaxFailIp       int `json:"loginMaxFailIp"`       // 同一IP允许连续失败次数
+	LoginFailWindow      int `json:"loginFailWindow"`      // 失败计数窗口（分钟）
+	LoginLockDuration    int `json:"loginLockDuration"`    // 锁定时长（分钟）
 }
 
 type ApplicationSetting struct {
 	Register
 	Login
-	WebSiteUrl string `json:"webSiteUrl"` // 站点地址
+	WebSiteUrl            string `json:"webSiteUrl"`            // 站点地址
+	AuditLogRetentionDays int    `json:"auditLogRetentionDays"` // 审计日志保留天数，0永久保留
+	HealthHistoryRawHours int    `json:"healthHistoryRawHours"` // 健康检查原始记录保留小时数，0为默认24小时
+	HealthHistory5mDays   int    `json:"healthHistory5mDays"`   // 健康检查5分钟汇总保留天数，0为默认30天
+	HealthHistory1hDays   int    `json:"healthHistory1hDays"`   // 健康检查1小时汇总保留天数，0为默认365天
 }
 
 var (
@@ -0,0 +1,93 @@
+package externalUser
+
+import (
+	"errors"
+	"fmt"
+	"sun-panel/global"
+	"sun-panel/lib/cmn"
+	"sun-panel/lib/panelTemplate"
+	"sun-panel/lib/password"
+	"sun-panel/models"
+)
+
+// 外部身份源（SSO、LDAP、反向代理认证）的账号
+
+// 外部账号资料
+type Profile struct {
+	Uid           string
+	Username      string
+	Name          string
+	Email         string
+	EmailVerified bool
+	Avatar        string
+	Groups        []string
+}
+
+// 创建外部账号对应的本地用户，使用无法猜测的随机密码，用户名已存在时追加数字
+// role为0时为普通用户
+func Create(provider string, profile Profile, role int) (models.User, error) {
+	mUser := models.User{}
+	username := profile.Username
+	if username == "" {
+		username = profile.Email
+	}
+	if username == "" {
+		username = profile.Uid + "@" + provider
+	}
+	username = cmn.SubRuneStr(username, 0, 45)
+
+	encoded, err := password.Hash(cmn.BuildSecureRandToken(32))
+	if err != nil {
+		return models.User{}, err
+	}
+	if role == 0 {
+		role = models.ROLE_USER
+	}
+	user := models.User{
+		Username: username,
+		Password: encoded,
+		Name:     cmn.SubRuneStr(profile.Name, 0, 20),
+		Mail:     profile.Email,
+		Status:   1,
+		Role:     role,
+	}
+	if user.Name == "" {
+		user.Name = cmn.SubRuneStr(user.Username, 0, 20)
+	}
+	if len(profile.Avatar) <= 200 {
+		user.HeadImage = profile.Avatar
+	}
+	for i := 0; ; i++ {
+		if _, err := mUser.CheckUsernameExist(user.Username); err == nil {
+			break
+		}
+		if i == 10 {
+			return models.User{}, errors.New("username already exists: " + username)
+		}
+		user.Username = username + fmt.Sprintf("%d", i)
+	}
+
+	if err := global.Db.Create(&user).Error; err != nil {
+		return user, err
+	}
+	if err := panelTemplate.ApplyDefault(user.ID); err != nil {
+		global.Logger.Errorln("Failed to apply panel template:", user.ID, err)
+	}
+	return user, nil
+}
+
+// 同步外部身份源映射的角色，role为0时不修改
+func SyncRole(info *models.User, role int) error {
+	if role == 0 || info.Role == role {
+		return nil
+	}
+	mUser := models.User{}
+	if err := mUser.UpdateUserInfoByUserId(info.ID, map[string]interface{}{"role": role}); err != nil {
+		return err
+	}
+	info.Role = role
+	if info.Token != "" {
+		global.UserToken.Delete(info.Token)
+	}
+	return nil
+}
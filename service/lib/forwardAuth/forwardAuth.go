@@ -0,0 +1,207 @@
+package forwardAuth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sun-panel/global"
+	"sun-panel/lib/auditLog"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/externalUser"
+	"sun-panel/lib/session"
+	"sun-panel/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 反向代理认证（Authelia、oauth2-proxy等）
+// 请求直接来自可信代理并携带用户头时，将其映射为本地用户并签发普通会话
+
+const (
+	PROVIDER = "forward_auth"
+
+	DEFAULT_HEADER_USER   = "Remote-User"
+	DEFAULT_HEADER_EMAIL  = "Remote-Email"
+	DEFAULT_HEADER_NAME   = "Remote-Name"
+	DEFAULT_HEADER_GROUPS = "Remote-Groups"
+
+	SESSION_CACHE_PREFIX     = "forward_auth_session_" // 身份 => cToken，复用会话，组变化时重新同步角色
+	SESSION_CACHE_EXPIRATION = session.SESSION_EXPIRATION
+)
+
+var (
+	ErrUserNotFound = errors.New("user does not exist and auto register is disabled")
+	ErrUserDisabled = errors.New("user is disabled")
+	ErrUserNotLink  = errors.New("local user exists but is not linked to forward auth")
+)
+
+type Identity struct {
+	Username string
+	Email    string
+	Name     string
+	Groups   []string
+	HasGroup bool // 是否携带了组请求头
+}
+
+// 获取配置，未启用返回false
+func GetConfig() (systemSetting.ForwardAuth, bool) {
+	cfg := systemSetting.ForwardAuth{}
+	if err := global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_FORWARD_AUTH, &cfg); err != nil || !cfg.Enabled {
+		return cfg, false
+	}
+	return cfg, true
+}
+
+// IP是否为可信代理
+func IsTrustedProxy(cfg systemSetting.ForwardAuth, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, v := range cfg.TrustedProxies {
+		v = strings.TrimSpace(v)
+		if !strings.Contains(v, "/") {
+			if proxyIp := net.ParseIP(v); proxyIp != nil && proxyIp.Equal(addr) {
+				return true
+			}
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(v); err == nil && ipNet.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// 从请求头读取身份，remoteIp 需为直接连接的地址（不能使用X-Forwarded-For）
+func GetIdentity(cfg systemSetting.ForwardAuth, header http.Header, remoteIp string) (Identity, bool) {
+	identity := Identity{}
+	if !IsTrustedProxy(cfg, remoteIp) {
+		return identity, false
+	}
+	identity.Username = strings.TrimSpace(header.Get(headerName(cfg.HeaderUser, DEFAULT_HEADER_USER)))
+	if identity.Username == "" || len(identity.Username) > 50 {
+		return identity, false
+	}
+	identity.Email = strings.TrimSpace(header.Get(headerName(cfg.HeaderEmail, DEFAULT_HEADER_EMAIL)))
+	identity.Name = strings.TrimSpace(header.Get(headerName(cfg.HeaderName, DEFAULT_HEADER_NAME)))
+	groupsHeader := headerName(cfg.HeaderGroups, DEFAULT_HEADER_GROUPS)
+	identity.HasGroup = len(header.Values(groupsHeader)) > 0
+	for _, v := range strings.Split(header.Get(groupsHeader), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			identity.Groups = append(identity.Groups, v)
+		}
+	}
+	return identity, true
+}
+
+func headerName(name, defaultName string) string {
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	return defaultName
+}
+
+// 根据组计算角色，未配置管理员组或未携带组请求头时返回0（不修改角色）
+func MapRole(cfg systemSetting.ForwardAuth, identity Identity) int {
+	if len(cfg.AdminGroups) == 0 || !identity.HasGroup {
+		return 0
+	}
+	for _, g := range identity.Groups {
+		for _, v := range cfg.AdminGroups {
+			if strings.EqualFold(g, strings.TrimSpace(v)) {
+				return models.ROLE_ADMIN
+			}
+		}
+	}
+	return models.ROLE_USER
+}
+
+// 获取身份对应的本地用户（通过UserAuth绑定），不存在时按配置关联同名本地账号或创建，并同步角色
+func GetUser(cfg systemSetting.ForwardAuth, identity Identity) (models.User, error) {
+	mUser := models.User{}
+	mUserAuth := models.UserAuth{}
+	role := MapRole(cfg, identity)
+
+	var (
+		info models.User
+		err  error
+	)
+	if authRec, authErr := mUserAuth.GetByProviderAndUid(PROVIDER, identity.Username); authErr == nil {
+		info, err = mUser.GetUserInfoByUid(authRec.UserId)
+	} else if authErr != gorm.ErrRecordNotFound {
+		return info, authErr
+	} else {
+		if info, err = mUser.GetUserInfoByUsername(identity.Username); err == nil {
+			// 未绑定的本地账号，需明确允许后才能关联，避免被同名代理用户接管
+			if !cfg.LinkLocalUser {
+				return info, ErrUserNotLink
+			}
+		} else if err == gorm.ErrRecordNotFound {
+			if !cfg.AutoRegister {
+				return info, ErrUserNotFound
+			}
+			info, err = externalUser.Create(PROVIDER, externalUser.Profile{
+				Uid:      identity.Username,
+				Username: identity.Username,
+				Name:     identity.Name,
+				Email:    identity.Email,
+			}, role)
+		}
+		if err == nil {
+			err = global.Db.Create(&models.UserAuth{
+				UserId:      info.ID,
+				Provider:    PROVIDER,
+				ProviderUid: identity.Username,
+			}).Error
+		}
+	}
+	if err != nil {
+		return info, err
+	}
+	if info.Status != 1 {
+		return info, ErrUserDisabled
+	}
+	err = externalUser.SyncRole(&info, role)
+	return info, err
+}
+
+// 获取身份对应的会话，缓存中的会话有效时复用，否则签发新的会话并记录登录日志
+// 返回cToken与用户token(bToken)
+func GetSession(c *gin.Context, cfg systemSetting.ForwardAuth, identity Identity) (string, string, error) {
+	cacheKey := SESSION_CACHE_PREFIX + identityHash(identity)
+	if cToken, ok := global.VerifyCodeCachePool.Get(cacheKey); ok {
+		if bToken, ok := session.Get(cToken); ok && bToken != "" {
+			return cToken, bToken, nil
+		}
+	}
+
+	info, err := GetUser(cfg, identity)
+	if err != nil {
+		return "", "", err
+	}
+	if err := session.EnsureUserToken(&info); err != nil {
+		return "", "", err
+	}
+	cToken, err := session.Create(info, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		return "", "", err
+	}
+	global.VerifyCodeCachePool.Set(cacheKey, cToken, SESSION_CACHE_EXPIRATION)
+	auditLog.Record(c, info, auditLog.ACTION_LOGIN, auditLog.TARGET_USER, info.ID, nil, gin.H{"method": PROVIDER})
+	return cToken, info.Token, nil
+}
+
+// 身份的哈希，组变化时重新同步角色
+func identityHash(identity Identity) string {
+	groups := strings.Join(identity.Groups, ",")
+	if !identity.HasGroup {
+		groups = "-"
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(identity.Username) + "\n" + groups))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,299 @@
+package healthCheck
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sun-panel/models"
+	"syscall"
+	"time"
+)
+
+// 服务健康检查：HTTP 状态码/关键字、TCP 连接、无 ICMP 的 ping 替代
+
+const (
+	DEFAULT_INTERVAL = 60 // 秒
+	DEFAULT_TIMEOUT  = 10
+	MIN_INTERVAL     = 10
+	MAX_INTERVAL     = 86400
+	MAX_TIMEOUT      = 60
+
+	maxBodySize = 1 << 20 // 关键字检查最多读取1M
+)
+
+var Types = []string{models.HEALTH_CHECK_TYPE_HTTP, models.HEALTH_CHECK_TYPE_KEYWORD, models.HEALTH_CHECK_TYPE_TCP, models.HEALTH_CHECK_TYPE_PING}
+
+var (
+	ErrNoTarget         = errors.New("no address to check")
+	ErrTargetNotAllowed = errors.New("address is not allowed")
+	errCheckFailed      = errors.New("service is unavailable")
+)
+
+// 云服务器元数据等非链路本地的敏感地址
+var deniedIps = []net.IP{
+	net.ParseIP("100.100.100.200"), // 阿里云
+	net.ParseIP("fd00:ec2::254"),   // AWS IPv6
+}
+
+type Result struct {
+	Status       int
+	ResponseTime int64 // 毫秒
+	Message      string
+}
+
+// 自建服务常用自签名证书，不校验证书
+var httpClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+// 非管理员的检查：不使用代理，连接时拒绝本机、链路本地和元数据地址（包括重定向和DNS解析后的地址）
+var restrictedDialer = &net.Dialer{Control: denyInternal}
+
+var restrictedHttpClient = &http.Client{
+	Transport: &http.Transport{
+		DialContext:     restrictedDialer.DialContext,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	},
+}
+
+func denyInternal(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ErrTargetNotAllowed
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return ErrTargetNotAllowed
+	}
+	for _, v := range deniedIps {
+		if v.Equal(ip) {
+			return ErrTargetNotAllowed
+		}
+	}
+	return nil
+}
+
+// 校验配置并补全默认值
+func Normalize(check *models.ItemIconHealthCheck) error {
+	check.Type = strings.TrimSpace(check.Type)
+	if check.Type == "" {
+		check.Type = models.HEALTH_CHECK_TYPE_HTTP
+	}
+	if !slices.Contains(Types, check.Type) {
+		return fmt.Errorf("type must be one of %s", strings.Join(Types, ", "))
+	}
+	if check.CheckInterval == 0 {
+		check.CheckInterval = DEFAULT_INTERVAL
+	}
+	if check.Timeout == 0 {
+		check.Timeout = DEFAULT_TIMEOUT
+	}
+	if check.CheckInterval < MIN_INTERVAL || check.CheckInterval > MAX_INTERVAL {
+		return fmt.Errorf("checkInterval must be between %d and %d seconds", MIN_INTERVAL, MAX_INTERVAL)
+	}
+	if check.Timeout < 1 || check.Timeout > MAX_TIMEOUT || check.Timeout >= check.CheckInterval {
+		return fmt.Errorf("timeout must be between 1 and %d seconds and less than the checkInterval", MAX_TIMEOUT)
+	}
+	if _, err := parseExpectedStatus(check.ExpectedStatus); err != nil {
+		return err
+	}
+	check.Target = strings.TrimSpace(check.Target)
+	check.Keyword = strings.TrimSpace(check.Keyword)
+	if check.Type == models.HEALTH_CHECK_TYPE_KEYWORD && check.Keyword == "" {
+		return errors.New("keyword is required")
+	}
+	return nil
+}
+
+// 执行检查，restricted 为 true 时限制可连接的地址，且只返回笼统的错误信息
+func Check(check models.ItemIconHealthCheck, itemIcon models.ItemIcon, restricted bool) Result {
+	target := check.Target
+	if target == "" {
+		target = itemIcon.Url
+		if check.UseLanUrl == 1 && itemIcon.LanUrl != "" {
+			target = itemIcon.LanUrl
+		}
+	}
+	if target == "" {
+		return Result{Status: models.HEALTH_STATUS_DOWN, Message: ErrNoTarget.Error()}
+	}
+
+	timeout := time.Duration(check.Timeout) * time.Second
+	start := time.Now()
+	var err error
+	dialer, client := &net.Dialer{}, httpClient
+	if restricted {
+		dialer, client = restrictedDialer, restrictedHttpClient
+	}
+	switch check.Type {
+	case models.HEALTH_CHECK_TYPE_TCP:
+		err = checkTcp(dialer, target, timeout)
+	case models.HEALTH_CHECK_TYPE_PING:
+		err = checkPing(dialer, target, timeout)
+	default:
+		err = checkHttp(client, target, check, timeout)
+	}
+	if err != nil && restricted {
+		if errors.Is(err, ErrTargetNotAllowed) {
+			err = ErrTargetNotAllowed
+		} else {
+			err = errCheckFailed
+		}
+	}
+	result := Result{
+		Status:       models.HEALTH_STATUS_UP,
+		ResponseTime: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = models.HEALTH_STATUS_DOWN
+		result.Message = err.Error()
+		if len(result.Message) > 255 {
+			result.Message = result.Message[:255]
+		}
+	}
+	return result
+}
+
+func checkHttp(client *http.Client, target string, check models.ItemIconHealthCheck, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "Sun-Panel-HealthCheck")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	ranges, _ := parseExpectedStatus(check.ExpectedStatus)
+	if !matchStatus(ranges, resp.StatusCode) {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	if check.Type == models.HEALTH_CHECK_TYPE_KEYWORD {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(body), check.Keyword) {
+			return errors.New("keyword not found")
+		}
+	}
+	return nil
+}
+
+func checkTcp(dialer *net.Dialer, target string, timeout time.Duration) error {
+	host, port := splitTarget(target)
+	if port == "" {
+		return errors.New("port is required")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// 不使用 ICMP（需要特权），依次尝试连接地址中的端口、443、80，任一端口连接成功或被拒绝（主机可达）即为在线
+func checkPing(dialer *net.Dialer, target string, timeout time.Duration) error {
+	host, port := splitTarget(target)
+	ports := []string{"443", "80"}
+	if port != "" {
+		ports = append([]string{port}, ports...)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var lastErr error
+	for _, p := range ports {
+		if ctx.Err() != nil {
+			break
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, p))
+		if err == nil {
+			return conn.Close()
+		}
+		if errors.Is(err, ErrTargetNotAllowed) {
+			return err
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && strings.Contains(strings.ToLower(opErr.Err.Error()), "refused") {
+			return nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("timeout")
+	}
+	return lastErr
+}
+
+// 从地址或 host:port 中获取主机和端口，地址未指定端口时使用协议的默认端口
+func splitTarget(target string) (host, port string) {
+	if strings.Contains(target, "://") {
+		u, err := url.Parse(target)
+		if err != nil {
+			return target, ""
+		}
+		host, port = u.Hostname(), u.Port()
+		if port == "" {
+			switch u.Scheme {
+			case "https":
+				port = "443"
+			case "http":
+				port = "80"
+			}
+		}
+		return
+	}
+	if h, p, err := net.SplitHostPort(target); err == nil {
+		return h, p
+	}
+	return target, ""
+}
+
+// 解析期望的状态码，如 200,301-399
+func parseExpectedStatus(s string) ([][2]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return [][2]int{{200, 399}}, nil
+	}
+	ranges := [][2]int{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		to := from
+		if err == nil && len(bounds) == 2 {
+			to, err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+		}
+		if err != nil || from < 100 || to > 599 || from > to {
+			return nil, fmt.Errorf("invalid expectedStatus %q", part)
+		}
+		ranges = append(ranges, [2]int{from, to})
+	}
+	return ranges, nil
+}
+
+func matchStatus(ranges [][2]int, code int) bool {
+	for _, r := range ranges {
+		if code >= r[0] && code <= r[1] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package healthCheck
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sun-panel/models"
+	"testing"
+)
+
+func TestParseExpectedStatus(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    [][2]int
+		wantErr bool
+	}{
+		{in: "", want: [][2]int{{200, 399}}},
+		{in: "  ", want: [][2]int{{200, 399}}},
+		{in: "200", want: [][2]int{{200, 200}}},
+		{in: "200,301-399", want: [][2]int{{200, 200}, {301, 399}}},
+		{in: " 204 , 400 - 404 ", want: [][2]int{{204, 204}, {400, 404}}},
+		{in: "100-599", want: [][2]int{{100, 599}}},
+		{in: "abc", wantErr: true},
+		{in: "200,", wantErr: true},
+		{in: "99", wantErr: true},
+		{in: "600", wantErr: true},
+		{in: "399-200", wantErr: true},
+		{in: "200-", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseExpectedStatus(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseExpectedStatus(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseExpectedStatus(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMatchStatus(t *testing.T) {
+	ranges := [][2]int{{200, 200}, {301, 399}}
+	tests := []struct {
+		code int
+		want bool
+	}{
+		{200, true},
+		{201, false},
+		{301, true},
+		{399, true},
+		{404, false},
+	}
+	for _, tt := range tests {
+		if got := matchStatus(ranges, tt.code); got != tt.want {
+			t.Errorf("matchStatus(%d) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "sun-panel ok")
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		check      models.ItemIconHealthCheck
+		restricted bool
+		wantStatus int
+		wantMsg    string
+	}{
+		{name: "http", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_HTTP}, wantStatus: models.HEALTH_STATUS_UP},
+		{name: "status", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_HTTP, Target: server.URL + "/missing"}, wantStatus: models.HEALTH_STATUS_DOWN},
+		{name: "expected status", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_HTTP, Target: server.URL + "/missing", ExpectedStatus: "404"}, wantStatus: models.HEALTH_STATUS_UP},
+		{name: "keyword", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_KEYWORD, Keyword: "ok"}, wantStatus: models.HEALTH_STATUS_UP},
+		{name: "keyword missing", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_KEYWORD, Keyword: "error"}, wantStatus: models.HEALTH_STATUS_DOWN},
+		{name: "tcp", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_TCP}, wantStatus: models.HEALTH_STATUS_UP},
+		{name: "restricted loopback", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_HTTP}, restricted: true, wantStatus: models.HEALTH_STATUS_DOWN, wantMsg: ErrTargetNotAllowed.Error()},
+		{name: "restricted tcp", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_TCP}, restricted: true, wantStatus: models.HEALTH_STATUS_DOWN, wantMsg: ErrTargetNotAllowed.Error()},
+		{name: "restricted metadata", check: models.ItemIconHealthCheck{Type: models.HEALTH_CHECK_TYPE_TCP, Target: "169.254.169.254:80"}, restricted: true, wantStatus: models.HEALTH_STATUS_DOWN, wantMsg: ErrTargetNotAllowed.Error()},
+	}
+	for _, tt := range tests {
+		tt.check.Timeout = 2
+		got := Check(tt.check, models.ItemIcon{Url: server.URL}, tt.restricted)
+		if got.Status != tt.wantStatus {
+			t.Errorf("%s: status = %d (%s), want %d", tt.name, got.Status, got.Message, tt.wantStatus)
+		}
+		if tt.wantMsg != "" && got.Message != tt.wantMsg {
+			t.Errorf("%s: message = %q, want %q", tt.name, got.Message, tt.wantMsg)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package healthCheck
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 健康检查历史：原始记录保留24小时，之后汇总为5分钟记录保留30天，再汇总为1小时记录保留1年
+// 保留时长见系统设置 ApplicationSetting.HealthHistory*
+// 汇总记录的百分位数为按在线次数加权的近似值
+
+const (
+	DEFAULT_HISTORY_RAW_HOURS = 24
+	DEFAULT_HISTORY_5M_DAYS   = 30
+	DEFAULT_HISTORY_1H_DAYS   = 365
+
+	MAX_HISTORY_RANGE = 366 * 24 * time.Hour // 单次查询的最大时间范围
+
+	maxHistoryPoints = 1000
+)
+
+// 记录已被其他实例汇总
+var errRollupConflict = errors.New("health history has been rolled up by another instance")
+
+// 时间范围内的统计
+type HistorySummary struct {
+	ItemIconId   uint                           `json:"itemIconId"`
+	Uptime       float64                        `json:"uptime"` // 在线率（%），没有记录时为-1
+	Count        int                            `json:"count"`
+	UpCount      int                            `json:"upCount"`
+	ResponseTime int64                          `json:"responseTime"`
+	P50          int64                          `json:"p50"`
+	P95          int64                          `json:"p95"`
+	P99          int64                          `json:"p99"`
+	Max          int64                          `json:"max"`
+	Points       []models.ItemIconHealthHistory `json:"points"` // 按 step 汇总的图表数据
+}
+
+// 获取保留时长，后一级的保留时长不小于前一级
+func getRetention() (raw, fiveMinutes, hour time.Duration) {
+	settings := systemSetting.ApplicationSetting{}
+	global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_APPLICATION, &settings)
+	if settings.HealthHistoryRawHours <= 0 {
+		settings.HealthHistoryRawHours = DEFAULT_HISTORY_RAW_HOURS
+	}
+	if settings.HealthHistory5mDays <= 0 {
+		settings.HealthHistory5mDays = DEFAULT_HISTORY_5M_DAYS
+	}
+	if settings.HealthHistory1hDays <= 0 {
+		settings.HealthHistory1hDays = DEFAULT_HISTORY_1H_DAYS
+	}
+	raw = time.Duration(settings.HealthHistoryRawHours) * time.Hour
+	fiveMinutes = max(raw, time.Duration(settings.HealthHistory5mDays)*24*time.Hour)
+	hour = max(fiveMinutes, time.Duration(settings.HealthHistory1hDays)*24*time.Hour)
+	return
+}
+
+// 记录一次检查结果
+func recordHistory(db *gorm.DB, itemIconId uint, result Result, t time.Time) error {
+	history := models.ItemIconHealthHistory{
+		ItemIconId: itemIconId,
+		Resolution: models.HEALTH_HISTORY_RAW,
+		Time:       t,
+		Count:      1,
+	}
+	if result.Status == models.HEALTH_STATUS_UP {
+		history.UpCount = 1
+		history.ResponseTime = result.ResponseTime
+		history.P50, history.P95, history.P99, history.Max = result.ResponseTime, result.ResponseTime, result.ResponseTime, result.ResponseTime
+	}
+	return db.Create(&history).Error
+}
+
+// 汇总过期的记录并清理
+func CompactHistory(db *gorm.DB, now time.Time) error {
+	raw, fiveMinutes, hour := getRetention()
+	if err := rollup(db, models.HEALTH_HISTORY_RAW, models.HEALTH_HISTORY_5MINUTES, now.Add(-raw)); err != nil {
+		return err
+	}
+	if err := rollup(db, models.HEALTH_HISTORY_5MINUTES, models.HEALTH_HISTORY_HOUR, now.Add(-fiveMinutes)); err != nil {
+		return err
+	}
+	if err := db.Delete(&models.ItemIconHealthHistory{}, "resolution=? AND time<?", models.HEALTH_HISTORY_HOUR, now.Add(-hour)).Error; err != nil {
+		return err
+	}
+	// 图标已删除
+	return db.Where("item_icon_id NOT IN (?)", db.Model(&models.ItemIcon{}).Select("id")).Delete(&models.ItemIconHealthHistory{}).Error
+}
+
+// 将早于 before 的 from 精度记录汇总为 to 精度，只汇总完整的区间
+func rollup(db *gorm.DB, from, to int, before time.Time) error {
+	step := time.Duration(to) * time.Second
+	before = before.Truncate(step)
+
+	itemIconIds := []uint{}
+	if err := db.Model(&models.ItemIconHealthHistory{}).Where("resolution=? AND time<?", from, before).Distinct().Pluck("item_icon_id", &itemIconIds).Error; err != nil {
+		return err
+	}
+	for _, itemIconId := range itemIconIds {
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			rows := []models.ItemIconHealthHistory{}
+			if err := tx.Order("time").Find(&rows, "item_icon_id=? AND resolution=? AND time<?", itemIconId, from, before).Error; err != nil {
+				return err
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			// 合并已存在的同一区间的汇总记录
+			existing := []models.ItemIconHealthHistory{}
+			if err := tx.Find(&existing, "item_icon_id=? AND resolution=? AND time>=? AND time<?", itemIconId, to, rows[0].Time.Truncate(step), before).Error; err != nil {
+				return err
+			}
+
+			// 先删除参与汇总的记录，删除数量不一致说明其他实例正在或已经汇总，回滚避免重复计数
+			ids := []uint{}
+			for _, v := range existing {
+				ids = append(ids, v.ID)
+			}
+			for _, v := range rows {
+				ids = append(ids, v.ID)
+			}
+			res := tx.Delete(&models.ItemIconHealthHistory{}, "id in ?", ids)
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected != int64(len(ids)) {
+				return errRollupConflict
+			}
+
+			buckets := groupByStep(append(existing, rows...), step)
+			for _, v := range buckets {
+				v.ItemIconId = itemIconId
+				v.Resolution = to
+				if err := tx.Create(&v).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil && err != errRollupConflict {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按 step 分组汇总，返回按时间排序的结果
+func groupByStep(rows []models.ItemIconHealthHistory, step time.Duration) []models.ItemIconHealthHistory {
+	groups := map[int64][]models.ItemIconHealthHistory{}
+	keys := []int64{}
+	for _, v := range rows {
+		key := v.Time.Truncate(step).Unix()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], v)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	res := []models.ItemIconHealthHistory{}
+	for _, key := range keys {
+		v := aggregate(groups[key])
+		v.Time = time.Unix(key, 0)
+		res = append(res, v)
+	}
+	return res
+}
+
+// 汇总多条记录
+func aggregate(rows []models.ItemIconHealthHistory) models.ItemIconHealthHistory {
+	res := models.ItemIconHealthHistory{}
+	var total int64
+	for _, v := range rows {
+		res.Count += v.Count
+		res.UpCount += v.UpCount
+		total += v.ResponseTime * int64(v.UpCount)
+		res.Max = max(res.Max, v.Max)
+	}
+	if res.UpCount > 0 {
+		res.ResponseTime = total / int64(res.UpCount)
+	}
+	res.P50 = weightedPercentile(rows, 0.5, func(v models.ItemIconHealthHistory) int64 { return v.P50 })
+	res.P95 = weightedPercentile(rows, 0.95, func(v models.ItemIconHealthHistory) int64 { return v.P95 })
+	res.P99 = weightedPercentile(rows, 0.99, func(v models.ItemIconHealthHistory) int64 { return v.P99 })
+	return res
+}
+
+// 按在线次数加权的百分位数（最近秩）
+func weightedPercentile(rows []models.ItemIconHealthHistory, p float64, value func(models.ItemIconHealthHistory) int64) int64 {
+	type sample struct {
+		value  int64
+		weight int
+	}
+	samples := []sample{}
+	total := 0
+	for _, v := range rows {
+		if v.UpCount > 0 {
+			samples = append(samples, sample{value(v), v.UpCount})
+			total += v.UpCount
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool { return samples[i].value < samples[j].value })
+	rank := int(math.Ceil(p * float64(total)))
+	cumulative := 0
+	for _, v := range samples {
+		cumulative += v.weight
+		if cumulative >= rank {
+			return v.value
+		}
+	}
+	return samples[len(samples)-1].value
+}
+
+// 数据库中时间的Unix时间戳表达式
+func unixTimeExpr(db *gorm.DB) string {
+	if db.Dialector.Name() == "mysql" {
+		return "UNIX_TIMESTAMP(time)"
+	}
+	return "CAST(strftime('%s', time) AS INTEGER)"
+}
+
+// 获取图标在时间范围内的统计和图表数据，step 为0时自动选择
+// 在数据库中按 step 汇总，每个图标最多返回 maxHistoryPoints 个点；区间内的百分位数为按在线次数加权的平均值，统计的百分位数由各区间近似计算
+func GetHistory(db *gorm.DB, itemIconIds []uint, start, end time.Time, step time.Duration) ([]HistorySummary, error) {
+	span := end.Sub(start)
+	if step <= 0 {
+		step = span / 200
+	}
+	step = max(step, span/maxHistoryPoints, time.Minute)
+	step = step.Round(time.Minute)
+	stepSeconds := int64(step / time.Second)
+
+	bucketExpr := "(" + unixTimeExpr(db) + ") / ?"
+	if db.Dialector.Name() == "mysql" {
+		bucketExpr = "(" + unixTimeExpr(db) + ") DIV ?"
+	}
+	type bucket struct {
+		ItemIconId   uint
+		Bucket       int64
+		Count        int
+		UpCount      int
+		ResponseTime int64 // 以下均为按在线次数加权的总和
+		P50          int64
+		P95          int64
+		P99          int64
+		Max          int64
+	}
+	buckets := []bucket{}
+	if len(itemIconIds) > 0 {
+		if err := db.Model(&models.ItemIconHealthHistory{}).
+			Select("item_icon_id, "+bucketExpr+" AS bucket, SUM(count) AS count, SUM(up_count) AS up_count, SUM(response_time*up_count) AS response_time, SUM(p50*up_count) AS p50, SUM(p95*up_count) AS p95, SUM(p99*up_count) AS p99, MAX(max) AS max", stepSeconds).
+			Where("item_icon_id in ? AND time>=? AND time<?", itemIconIds, start, end).
+			Group("item_icon_id, bucket").Order("bucket").
+			Scan(&buckets).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	points := map[uint][]models.ItemIconHealthHistory{}
+	for _, v := range buckets {
+		point := models.ItemIconHealthHistory{
+			ItemIconId: v.ItemIconId,
+			Resolution: int(stepSeconds),
+			Time:       time.Unix(v.Bucket*stepSeconds, 0),
+			Count:      v.Count,
+			UpCount:    v.UpCount,
+			Max:        v.Max,
+		}
+		if v.UpCount > 0 {
+			up := int64(v.UpCount)
+			point.ResponseTime, point.P50, point.P95, point.P99 = v.ResponseTime/up, v.P50/up, v.P95/up, v.P99/up
+		}
+		points[v.ItemIconId] = append(points[v.ItemIconId], point)
+	}
+
+	list := []HistorySummary{}
+	for _, itemIconId := range itemIconIds {
+		total := aggregate(points[itemIconId])
+		summary := HistorySummary{
+			ItemIconId:   itemIconId,
+			Uptime:       -1,
+			Count:        total.Count,
+			UpCount:      total.UpCount,
+			ResponseTime: total.ResponseTime,
+			P50:          total.P50,
+			P95:          total.P95,
+			P99:          total.P99,
+			Max:          total.Max,
+			Points:       points[itemIconId],
+		}
+		if summary.Points == nil {
+			summary.Points = []models.ItemIconHealthHistory{}
+		}
+		if total.Count > 0 {
+			summary.Uptime = math.Round(float64(total.UpCount)/float64(total.Count)*10000) / 100
+		}
+		list = append(list, summary)
+	}
+	return list, nil
+}
+
+// 定时汇总和清理历史记录
+func StartHistoryCompaction(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := CompactHistory(global.Db, time.Now()); err != nil {
+				global.Logger.Errorln("Failed to compact health check history:", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,216 @@
+package healthCheck
+
+import (
+	"sun-panel/models"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newHistoryTestDb(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接独立，只使用一个连接
+	sqlDb, _ := db.DB()
+	sqlDb.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDb.Close() })
+	if err := db.AutoMigrate(&models.ItemIconHealthHistory{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// 原始记录，responseTime 为0表示离线
+func rawHistory(itemIconId uint, t time.Time, responseTime int64) models.ItemIconHealthHistory {
+	v := models.ItemIconHealthHistory{ItemIconId: itemIconId, Resolution: models.HEALTH_HISTORY_RAW, Time: t, Count: 1}
+	if responseTime > 0 {
+		v.UpCount = 1
+		v.ResponseTime, v.P50, v.P95, v.P99, v.Max = responseTime, responseTime, responseTime, responseTime, responseTime
+	}
+	return v
+}
+
+func TestWeightedPercentile(t *testing.T) {
+	p50 := func(v models.ItemIconHealthHistory) int64 { return v.P50 }
+	tests := []struct {
+		name string
+		rows []models.ItemIconHealthHistory
+		p    float64
+		want int64
+	}{
+		{name: "empty", rows: nil, p: 0.5, want: 0},
+		{name: "all down", rows: []models.ItemIconHealthHistory{{Count: 3}}, p: 0.5, want: 0},
+		{name: "single", rows: []models.ItemIconHealthHistory{{UpCount: 1, P50: 10}}, p: 0.99, want: 10},
+		{
+			name: "unweighted",
+			rows: []models.ItemIconHealthHistory{{UpCount: 1, P50: 30}, {UpCount: 1, P50: 10}, {UpCount: 1, P50: 20}, {UpCount: 1, P50: 40}},
+			p:    0.5,
+			want: 20,
+		},
+		{
+			name: "weighted",
+			rows: []models.ItemIconHealthHistory{{UpCount: 1, P50: 100}, {UpCount: 9, P50: 10}},
+			p:    0.5,
+			want: 10,
+		},
+		{
+			name: "weighted tail",
+			rows: []models.ItemIconHealthHistory{{UpCount: 1, P50: 100}, {UpCount: 9, P50: 10}},
+			p:    0.95,
+			want: 100,
+		},
+		{
+			name: "down rows ignored",
+			rows: []models.ItemIconHealthHistory{{Count: 5}, {UpCount: 2, P50: 50}},
+			p:    0.5,
+			want: 50,
+		},
+	}
+	for _, tt := range tests {
+		if got := weightedPercentile(tt.rows, tt.p, p50); got != tt.want {
+			t.Errorf("%s: weightedPercentile() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGroupByStep(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []models.ItemIconHealthHistory{
+		rawHistory(1, base.Add(6*time.Minute), 30),
+		rawHistory(1, base.Add(time.Minute), 10),
+		rawHistory(1, base.Add(2*time.Minute), 0),
+		rawHistory(1, base.Add(3*time.Minute), 20),
+	}
+	got := groupByStep(rows, 5*time.Minute)
+
+	want := []struct {
+		time         time.Time
+		count        int
+		upCount      int
+		responseTime int64
+		max          int64
+	}{
+		{base, 3, 2, 15, 20},
+		{base.Add(5 * time.Minute), 1, 1, 30, 30},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("groupByStep() returned %d buckets, want %d", len(got), len(want))
+	}
+	for i, w := range want {
+		g := got[i]
+		if !g.Time.Equal(w.time) || g.Count != w.count || g.UpCount != w.upCount || g.ResponseTime != w.responseTime || g.Max != w.max {
+			t.Errorf("bucket %d = {time: %s, count: %d, upCount: %d, responseTime: %d, max: %d}, want %+v", i, g.Time, g.Count, g.UpCount, g.ResponseTime, g.Max, w)
+		}
+	}
+	if len(groupByStep(nil, time.Hour)) != 0 {
+		t.Error("groupByStep(nil) should return no buckets")
+	}
+}
+
+func TestRollup(t *testing.T) {
+	db := newHistoryTestDb(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []models.ItemIconHealthHistory{
+		rawHistory(1, base.Add(time.Minute), 10),
+		rawHistory(1, base.Add(2*time.Minute), 20),
+		rawHistory(1, base.Add(6*time.Minute), 0),
+		rawHistory(1, base.Add(11*time.Minute), 40), // 区间不完整，不汇总
+		rawHistory(2, base.Add(3*time.Minute), 50),
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	before := base.Add(12 * time.Minute)
+	if err := rollup(db, models.HEALTH_HISTORY_RAW, models.HEALTH_HISTORY_5MINUTES, before); err != nil {
+		t.Fatal(err)
+	}
+
+	var rawCount int64
+	db.Model(&models.ItemIconHealthHistory{}).Where("resolution=?", models.HEALTH_HISTORY_RAW).Count(&rawCount)
+	if rawCount != 1 {
+		t.Errorf("raw rows after rollup = %d, want 1", rawCount)
+	}
+
+	buckets := []models.ItemIconHealthHistory{}
+	db.Order("item_icon_id, time").Find(&buckets, "resolution=?", models.HEALTH_HISTORY_5MINUTES)
+	want := []struct {
+		itemIconId   uint
+		time         time.Time
+		count        int
+		upCount      int
+		responseTime int64
+	}{
+		{1, base, 2, 2, 15},
+		{1, base.Add(5 * time.Minute), 1, 0, 0},
+		{2, base, 1, 1, 50},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("rollup created %d buckets, want %d", len(buckets), len(want))
+	}
+	for i, w := range want {
+		g := buckets[i]
+		if g.ItemIconId != w.itemIconId || !g.Time.Equal(w.time) || g.Count != w.count || g.UpCount != w.upCount || g.ResponseTime != w.responseTime {
+			t.Errorf("bucket %d = {itemIconId: %d, time: %s, count: %d, upCount: %d, responseTime: %d}, want %+v", i, g.ItemIconId, g.Time, g.Count, g.UpCount, g.ResponseTime, w)
+		}
+	}
+
+	// 新的原始记录合并到已存在的汇总记录，重复执行不会重复计数
+	late := rawHistory(1, base.Add(4*time.Minute), 30)
+	if err := db.Create(&late).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := rollup(db, models.HEALTH_HISTORY_RAW, models.HEALTH_HISTORY_5MINUTES, before); err != nil {
+			t.Fatal(err)
+		}
+	}
+	merged := []models.ItemIconHealthHistory{}
+	db.Find(&merged, "item_icon_id=? AND resolution=? AND time=?", 1, models.HEALTH_HISTORY_5MINUTES, base)
+	if len(merged) != 1 || merged[0].Count != 3 || merged[0].UpCount != 3 || merged[0].ResponseTime != 20 {
+		t.Errorf("merged bucket = %+v, want one bucket with count 3, upCount 3, responseTime 20", merged)
+	}
+}
+
+func TestGetHistory(t *testing.T) {
+	db := newHistoryTestDb(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := []models.ItemIconHealthHistory{
+		rawHistory(1, base.Add(time.Minute), 10),
+		rawHistory(1, base.Add(2*time.Minute), 30),
+		rawHistory(1, base.Add(11*time.Minute), 0),
+		rawHistory(1, base.Add(time.Hour), 99), // 范围外
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := GetHistory(db, []uint{1, 2}, base, base.Add(20*time.Minute), 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("GetHistory() returned %d summaries, want 2", len(list))
+	}
+
+	summary := list[0]
+	if summary.Count != 3 || summary.UpCount != 2 || summary.ResponseTime != 20 || summary.Max != 30 {
+		t.Errorf("summary = %+v, want count 3, upCount 2, responseTime 20, max 30", summary)
+	}
+	if summary.Uptime != 66.67 {
+		t.Errorf("uptime = %v, want 66.67", summary.Uptime)
+	}
+	if len(summary.Points) != 2 || !summary.Points[0].Time.Equal(base) || !summary.Points[1].Time.Equal(base.Add(10*time.Minute)) {
+		t.Errorf("points = %+v, want buckets at 00:00 and 00:10", summary.Points)
+	}
+
+	if empty := list[1]; empty.Uptime != -1 || len(empty.Points) != 0 {
+		t.Errorf("summary without history = %+v, want uptime -1 and no points", empty)
+	}
+}
@@ -0,0 +1,152 @@
+package healthCheck
+
+import (
+	"sun-panel/global"
+	"sun-panel/lib/permission"
+	"sun-panel/lib/queue"
+	"sun-panel/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	scheduleInterval = 5 * time.Second
+	maxQueueLength   = 1000 // 队列积压达到该长度时暂停放入，避免检查堆积
+)
+
+var queuer queue.Queuer
+
+// 启动健康检查：定时将到期的检查放入队列，由 workers 个协程从队列中取出执行
+// 使用 Redis 队列时多个实例共享队列，到期的检查只会被一个实例放入队列
+func Start(workers int) {
+	queuer = global.NewQueuer("healthCheckQueue")
+
+	go func() {
+		ticker := time.NewTicker(scheduleInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := schedule(); err != nil {
+				global.Logger.Errorln("Failed to schedule health checks:", err)
+			}
+			<-ticker.C
+		}
+	}()
+
+	for i := 0; i < workers; i++ {
+		go worker()
+	}
+}
+
+// 将到期的检查放入队列，并更新下次检查时间
+// 队列中积压的检查执行完之前不放入新的检查，未放入的检查保持到期状态，下次调度时再放入
+func schedule() error {
+	length, err := queuer.Length()
+	if err != nil {
+		return err
+	}
+	if length >= maxQueueLength {
+		return nil
+	}
+
+	now := time.Now()
+	checks := []models.ItemIconHealthCheck{}
+	if err := global.Db.Select("id", "check_interval").
+		Where("enabled=1 AND (next_check_time IS NULL OR next_check_time<=?)", now).
+		Order("next_check_time").Limit(int(maxQueueLength - length)).
+		Find(&checks).Error; err != nil {
+		return err
+	}
+	for _, v := range checks {
+		next := now.Add(time.Duration(v.CheckInterval) * time.Second)
+		res := global.Db.Model(&models.ItemIconHealthCheck{}).
+			Where("id=? AND (next_check_time IS NULL OR next_check_time<=?)", v.ID, now).
+			Update("next_check_time", next)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// 已被其他实例放入队列
+			continue
+		}
+		if err := queuer.RPush(v.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func worker() {
+	for {
+		var id uint
+		if err := queuer.LPop(&id); err != nil || id == 0 {
+			// 队列为空
+			time.Sleep(time.Second)
+			continue
+		}
+		if err := run(id); err != nil {
+			global.Logger.Errorln("Failed to run health check:", id, err)
+		}
+	}
+}
+
+// 执行检查并保存结果和历史记录，图标已删除时同时删除检查和历史记录
+func run(id uint) error {
+	check := models.ItemIconHealthCheck{}
+	if err := global.Db.First(&check, "id=?", id).Error; err == gorm.ErrRecordNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if check.Enabled != 1 {
+		return nil
+	}
+
+	itemIcon := models.ItemIcon{}
+	if err := global.Db.First(&itemIcon, "id=?", check.ItemIconId).Error; err == gorm.ErrRecordNotFound {
+		mItemIconHealthCheck := models.ItemIconHealthCheck{}
+		mItemIconHealthHistory := models.ItemIconHealthHistory{}
+		if err := mItemIconHealthHistory.DeleteByItemIconIds(global.Db, []uint{check.ItemIconId}); err != nil {
+			return err
+		}
+		return mItemIconHealthCheck.DeleteByItemIconIds(global.Db, []uint{check.ItemIconId})
+	} else if err != nil {
+		return err
+	}
+
+	restricted, err := isRestricted(global.Db, check)
+	if err != nil {
+		return err
+	}
+	result := Check(check, itemIcon, restricted)
+	now := time.Now()
+	if err := recordHistory(global.Db, check.ItemIconId, result, now); err != nil {
+		return err
+	}
+	return global.Db.Model(&models.ItemIconHealthCheck{}).
+		Select("Status", "ResponseTime", "Message", "LastCheckTime").
+		Where("id=?", check.ID).
+		Updates(&models.ItemIconHealthCheck{
+			Status:        result.Status,
+			ResponseTime:  result.ResponseTime,
+			Message:       result.Message,
+			LastCheckTime: &now,
+		}).Error
+}
+
+// 最后配置检查或修改图标的用户不是系统管理员时限制可检查的地址
+// 共享分组中有写权限的用户也可修改，因此不按图标所有者判断
+func isRestricted(db *gorm.DB, check models.ItemIconHealthCheck) (bool, error) {
+	userId := check.ConfigUserId
+	if userId == 0 {
+		userId = check.UserId
+	}
+	user := models.User{}
+	if err := db.Select("id", "role").First(&user, "id=?", userId).Error; err == gorm.ErrRecordNotFound {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return !permission.Has(user.Role, permission.MANAGE_SYSTEM), nil
+}
@@ -0,0 +1,49 @@
+package healthCheck
+
+import (
+	"strconv"
+	"sun-panel/global"
+	"sun-panel/lib/cache"
+	"sun-panel/models"
+	"testing"
+	"time"
+)
+
+func TestIsRestricted(t *testing.T) {
+	db := newHistoryTestDb(t)
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatal(err)
+	}
+	global.RolePermission = cache.NewGoCache[[]string](time.Minute, time.Minute)
+	global.RolePermission.SetDefault(strconv.Itoa(models.ROLE_USER), []string{})
+
+	admin := models.User{Username: "admin", Role: models.ROLE_ADMIN}
+	user := models.User{Username: "user", Role: models.ROLE_USER}
+	if err := db.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		check models.ItemIconHealthCheck
+		want  bool
+	}{
+		{"configured by admin", models.ItemIconHealthCheck{UserId: user.ID, ConfigUserId: admin.ID}, false},
+		// 共享分组中普通用户修改了管理员的图标
+		{"configured by user in admin group", models.ItemIconHealthCheck{UserId: admin.ID, ConfigUserId: user.ID}, true},
+		{"owner fallback", models.ItemIconHealthCheck{UserId: admin.ID}, false},
+		{"unknown user", models.ItemIconHealthCheck{UserId: admin.ID, ConfigUserId: 999}, true},
+	}
+	for _, tt := range tests {
+		got, err := isRestricted(db, tt.check)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: isRestricted() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package ldapAuth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/secret"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAP / Active Directory 登录
+// 使用查询账号按 UserFilter 查找用户，再以用户DN和密码绑定验证
+
+const (
+	DIAL_TIMEOUT = 10 * time.Second
+
+	DEFAULT_USER_FILTER   = "(uid={username})"
+	DEFAULT_ATTR_USERNAME = "uid"
+	DEFAULT_ATTR_NAME     = "cn"
+	DEFAULT_ATTR_EMAIL    = "mail"
+)
+
+var (
+	ErrDisabled           = errors.New("ldap is disabled")
+	ErrInvalidCredentials = errors.New("invalid credentials") // 用户不存在、不唯一或密码错误
+)
+
+type User struct {
+	Dn       string
+	Username string
+	Name     string
+	Email    string
+	IsAdmin  bool // 未配置 AdminGroupFilter 时为false
+}
+
+// 填充默认值
+func withDefaults(cfg systemSetting.Ldap) systemSetting.Ldap {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = DEFAULT_USER_FILTER
+	}
+	if cfg.AttrUsername == "" {
+		cfg.AttrUsername = DEFAULT_ATTR_USERNAME
+	}
+	if cfg.AttrName == "" {
+		cfg.AttrName = DEFAULT_ATTR_NAME
+	}
+	if cfg.AttrEmail == "" {
+		cfg.AttrEmail = DEFAULT_ATTR_EMAIL
+	}
+	if cfg.GroupBaseDn == "" {
+		cfg.GroupBaseDn = cfg.BaseDn
+	}
+	return cfg
+}
+
+// 连接并使用查询账号绑定
+func dial(cfg systemSetting.Ldap) (*ldap.Conn, error) {
+	u, err := url.Parse(cfg.Url)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, errors.New("url must be ldap:// or ldaps://")
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	conn, err := ldap.DialURL(cfg.Url,
+		ldap.DialWithDialer(&net.Dialer{Timeout: DIAL_TIMEOUT}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(DIAL_TIMEOUT)
+
+	if cfg.StartTls && u.Scheme == "ldap" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("start tls: %v", err)
+		}
+	}
+
+	if err := bindService(conn, cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// 使用查询账号绑定，未配置时匿名
+func bindService(conn *ldap.Conn, cfg systemSetting.Ldap) error {
+	if cfg.BindDn == "" {
+		return conn.UnauthenticatedBind("")
+	}
+	bindPassword, err := secret.Decrypt(cfg.BindPassword)
+	if err != nil {
+		return fmt.Errorf("decrypt bind password: %v", err)
+	}
+	if err := conn.Bind(cfg.BindDn, bindPassword); err != nil {
+		return fmt.Errorf("service bind: %v", err)
+	}
+	return nil
+}
+
+// 替换过滤器中的占位符
+func buildFilter(filter string, username, dn string) string {
+	return strings.NewReplacer(
+		"{username}", ldap.EscapeFilter(username),
+		"{dn}", ldap.EscapeFilter(dn),
+	).Replace(filter)
+}
+
+// Authenticate 验证用户名和密码
+// 用户不存在、不唯一或密码错误返回 ErrInvalidCredentials，其他为连接或配置错误
+func Authenticate(cfg systemSetting.Ldap, username, password string) (User, error) {
+	user := User{}
+	if !cfg.Enabled {
+		return user, ErrDisabled
+	}
+	// 空密码会被服务器当作匿名绑定而成功
+	if username == "" || password == "" {
+		return user, ErrInvalidCredentials
+	}
+	cfg = withDefaults(cfg)
+
+	conn, err := dial(cfg)
+	if err != nil {
+		return user, err
+	}
+	defer conn.Close()
+
+	res, err := conn.Search(ldap.NewSearchRequest(
+		cfg.BaseDn, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(DIAL_TIMEOUT.Seconds()), false,
+		buildFilter(cfg.UserFilter, username, ""),
+		[]string{cfg.AttrUsername, cfg.AttrName, cfg.AttrEmail},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return user, fmt.Errorf("search user: %v", err)
+	}
+	if res == nil || len(res.Entries) != 1 {
+		return user, ErrInvalidCredentials
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return user, ErrInvalidCredentials
+		}
+		return user, fmt.Errorf("user bind: %v", err)
+	}
+
+	user.Dn = entry.DN
+	user.Username = entry.GetAttributeValue(cfg.AttrUsername)
+	if user.Username == "" {
+		user.Username = username
+	}
+	user.Name = entry.GetAttributeValue(cfg.AttrName)
+	user.Email = entry.GetAttributeValue(cfg.AttrEmail)
+
+	if cfg.AdminGroupFilter != "" {
+		// 使用查询账号查询组
+		if err := bindService(conn, cfg); err != nil {
+			return user, err
+		}
+		if user.IsAdmin, err = inGroup(conn, cfg, user); err != nil {
+			return user, err
+		}
+	}
+	return user, nil
+}
+
+func inGroup(conn *ldap.Conn, cfg systemSetting.Ldap, user User) (bool, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(
+		cfg.GroupBaseDn, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 1, int(DIAL_TIMEOUT.Seconds()), false,
+		buildFilter(cfg.AdminGroupFilter, user.Username, user.Dn),
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return false, fmt.Errorf("search group: %v", err)
+	}
+	return res != nil && len(res.Entries) > 0, nil
+}
+
+// Test 测试连接、查询账号绑定和BaseDn
+func Test(cfg systemSetting.Ldap) error {
+	cfg = withDefaults(cfg)
+	conn, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Search(ldap.NewSearchRequest(
+		cfg.BaseDn, ldap.ScopeBaseObject, ldap.NeverDerefAliases, 1, int(DIAL_TIMEOUT.Seconds()), false,
+		"(objectClass=*)", []string{"dn"}, nil,
+	))
+	if err != nil {
+		return fmt.Errorf("search base dn: %v", err)
+	}
+	return nil
+}
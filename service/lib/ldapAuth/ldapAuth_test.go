@@ -0,0 +1,298 @@
+package ldapAuth
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sun-panel/lib/cmn/systemSetting"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// 进程内的最小LDAP服务器：支持简单绑定、按 and/or/not/等于/存在 过滤的查询
+type testEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+type testServer struct {
+	listener net.Listener
+	entries  []testEntry
+}
+
+func newTestServer(t *testing.T, entries []testEntry) *testServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testServer{listener: listener, entries: entries}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) url() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageId := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			if dn == "" && password == "" {
+				code = ldap.LDAPResultSuccess
+			} else if entry := s.find(dn); entry != nil && entry.password != "" && entry.password == password {
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, messageId, s.result(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			baseDn := strings.ToLower(op.Children[0].Data.String())
+			scope := op.Children[1].Value.(int64)
+			for _, entry := range s.entries {
+				dn := strings.ToLower(entry.dn)
+				if scope == int64(ldap.ScopeBaseObject) && dn != baseDn {
+					continue
+				}
+				if dn != baseDn && !strings.HasSuffix(dn, ","+baseDn) {
+					continue
+				}
+				if !matchFilter(op.Children[6], entry) {
+					continue
+				}
+				s.write(conn, messageId, s.searchEntry(entry))
+			}
+			s.write(conn, messageId, s.result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (s *testServer) find(dn string) *testEntry {
+	for i, v := range s.entries {
+		if strings.EqualFold(v.dn, dn) {
+			return &s.entries[i]
+		}
+	}
+	return nil
+}
+
+func (s *testServer) write(conn net.Conn, messageId int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageId, "MessageID"))
+	packet.AppendChild(op)
+	conn.Write(packet.Bytes())
+}
+
+func (s *testServer) result(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+func (s *testServer) searchEntry(entry testEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "objectName"))
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, values := range entry.attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		vals := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range values {
+			vals.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(vals)
+		attrs.AppendChild(attr)
+	}
+	op.AppendChild(attrs)
+	return op
+}
+
+func matchFilter(filter *ber.Packet, entry testEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, v := range filter.Children {
+			if !matchFilter(v, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, v := range filter.Children {
+			if matchFilter(v, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchFilter(filter.Children[0], entry)
+	case ldap.FilterPresent:
+		_, ok := entryAttr(entry, filter.Data.String())
+		return ok
+	case ldap.FilterEqualityMatch:
+		values, _ := entryAttr(entry, filter.Children[0].Data.String())
+		for _, v := range values {
+			if strings.EqualFold(v, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func entryAttr(entry testEntry, name string) ([]string, bool) {
+	for k, v := range entry.attrs {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func testDirectory() []testEntry {
+	return []testEntry{
+		{dn: "dc=example,dc=org", attrs: map[string][]string{"objectClass": {"domain"}}},
+		{dn: "cn=reader,dc=example,dc=org", password: "reader-pass", attrs: map[string][]string{"objectClass": {"person"}, "cn": {"reader"}}},
+		{dn: "uid=alice,ou=people,dc=example,dc=org", password: "alice-pass", attrs: map[string][]string{
+			"objectClass": {"person"}, "uid": {"alice"}, "cn": {"Alice"}, "mail": {"alice@example.org"},
+		}},
+		{dn: "uid=bob,ou=people,dc=example,dc=org", password: "bob-pass", attrs: map[string][]string{
+			"objectClass": {"person"}, "uid": {"bob"}, "cn": {"Bob"}, "mail": {"bob@example.org"},
+		}},
+		// 同名用户，查询结果不唯一
+		{dn: "uid=twin,ou=people,dc=example,dc=org", password: "twin-pass", attrs: map[string][]string{"objectClass": {"person"}, "uid": {"twin"}}},
+		{dn: "uid=twin,ou=others,dc=example,dc=org", password: "twin-pass", attrs: map[string][]string{"objectClass": {"person"}, "uid": {"twin"}}},
+		{dn: "cn=admins,ou=groups,dc=example,dc=org", attrs: map[string][]string{
+			"objectClass": {"groupOfNames"}, "cn": {"admins"}, "member": {"uid=alice,ou=people,dc=example,dc=org"},
+		}},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	server := newTestServer(t, testDirectory())
+	cfg := systemSetting.Ldap{
+		Enabled:          true,
+		Url:              server.url(),
+		BindDn:           "cn=reader,dc=example,dc=org",
+		BindPassword:     "reader-pass",
+		BaseDn:           "dc=example,dc=org",
+		UserFilter:       "(&(objectClass=person)(uid={username}))",
+		AdminGroupFilter: "(&(cn=admins)(member={dn}))",
+		GroupBaseDn:      "ou=groups,dc=example,dc=org",
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     User
+		wantErr  error
+	}{
+		{
+			name: "admin", username: "alice", password: "alice-pass",
+			want: User{Dn: "uid=alice,ou=people,dc=example,dc=org", Username: "alice", Name: "Alice", Email: "alice@example.org", IsAdmin: true},
+		},
+		{
+			name: "user", username: "bob", password: "bob-pass",
+			want: User{Dn: "uid=bob,ou=people,dc=example,dc=org", Username: "bob", Name: "Bob", Email: "bob@example.org"},
+		},
+		{name: "wrong password", username: "alice", password: "bob-pass", wantErr: ErrInvalidCredentials},
+		{name: "empty password", username: "alice", password: "", wantErr: ErrInvalidCredentials},
+		{name: "unknown user", username: "carol", password: "carol-pass", wantErr: ErrInvalidCredentials},
+		{name: "not unique", username: "twin", password: "twin-pass", wantErr: ErrInvalidCredentials},
+		{name: "filter injection", username: "*", password: "alice-pass", wantErr: ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		got, err := Authenticate(cfg, tt.username, tt.password)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Authenticate() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && got != tt.want {
+			t.Errorf("%s: Authenticate() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthenticateConfig(t *testing.T) {
+	server := newTestServer(t, testDirectory())
+	cfg := systemSetting.Ldap{Enabled: true, Url: server.url(), BaseDn: "dc=example,dc=org"}
+
+	// 匿名查询，默认过滤器，不同步角色
+	got, err := Authenticate(cfg, "alice", "alice-pass")
+	if err != nil || got.Username != "alice" || got.IsAdmin {
+		t.Errorf("anonymous search: Authenticate() = %+v, %v", got, err)
+	}
+
+	disabled := cfg
+	disabled.Enabled = false
+	if _, err := Authenticate(disabled, "alice", "alice-pass"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("disabled: Authenticate() error = %v, want %v", err, ErrDisabled)
+	}
+
+	wrongBind := cfg
+	wrongBind.BindDn, wrongBind.BindPassword = "cn=reader,dc=example,dc=org", "wrong"
+	if _, err := Authenticate(wrongBind, "alice", "alice-pass"); err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong service password: Authenticate() error = %v, want a service bind error", err)
+	}
+
+	badUrl := cfg
+	badUrl.Url = "http://" + server.listener.Addr().String()
+	if _, err := Authenticate(badUrl, "alice", "alice-pass"); err == nil {
+		t.Error("http url: Authenticate() should fail")
+	}
+}
+
+func TestTest(t *testing.T) {
+	server := newTestServer(t, testDirectory())
+	cfg := systemSetting.Ldap{Url: server.url(), BindDn: "cn=reader,dc=example,dc=org", BindPassword: "reader-pass", BaseDn: "dc=example,dc=org"}
+	if err := Test(cfg); err != nil {
+		t.Errorf("Test() error = %v", err)
+	}
+	cfg.BindPassword = "wrong"
+	if err := Test(cfg); err == nil {
+		t.Error("Test() with a wrong bind password should fail")
+	}
+}
+
+func TestBuildFilter(t *testing.T) {
+	tests := []struct {
+		filter, username, dn, want string
+	}{
+		{"(uid={username})", "alice", "", "(uid=alice)"},
+		{"(uid={username})", "a*)(uid=*", "", `(uid=a\2a\29\28uid=\2a)`},
+		{"(member={dn})", "", "uid=a,dc=x", "(member=uid=a,dc=x)"},
+	}
+	for _, tt := range tests {
+		if got := buildFilter(tt.filter, tt.username, tt.dn); got != tt.want {
+			t.Errorf("buildFilter(%q, %q, %q) = %q, want %q", tt.filter, tt.username, tt.dn, got, tt.want)
+		}
+	}
+}
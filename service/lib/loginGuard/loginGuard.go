@@ -0,0 +1,233 @@
+package loginGuard
+
+import (
+	"strings"
+	"sun-panel/lib/cache"
+	"sun-panel/lib/cmn/systemSetting"
+	"sync"
+	"time"
+)
+
+// 登录防爆破
+// 按IP和账号分别记录失败次数，达到阈值后临时锁定
+// 数据保存在 cache.Cacher 中，内存和Redis驱动均可使用
+
+const (
+	KIND_IP       = "ip"
+	KIND_USERNAME = "username"
+
+	indexKey = "locked" // 已锁定记录的索引
+	maxDelay = 5 * time.Second
+)
+
+// 失败记录
+type Record struct {
+	Key         string `json:"key"`
+	Kind        string `json:"kind"`
+	Value       string `json:"value"`
+	Fails       int    `json:"fails"`
+	LockedUntil int64  `json:"lockedUntil"` // 锁定截止时间戳，0未锁定
+}
+
+// 锁定策略，阈值小于0表示不限制
+type Policy struct {
+	MaxFailsUsername int
+	MaxFailsIp       int
+	Window           time.Duration // 失败计数窗口
+	LockDuration     time.Duration // 锁定时长
+	DelayStep        time.Duration // 渐进延迟基数，每次失败翻倍
+}
+
+// 读取登录防爆破策略，未配置的使用默认值
+func GetPolicy(settings systemSetting.ApplicationSetting) Policy {
+	policy := Policy{
+		MaxFailsUsername: settings.LoginMaxFailUsername,
+		MaxFailsIp:       settings.LoginMaxFailIp,
+		Window:           time.Duration(settings.LoginFailWindow) * time.Minute,
+		LockDuration:     time.Duration(settings.LoginLockDuration) * time.Minute,
+		DelayStep:        500 * time.Millisecond,
+	}
+	if policy.MaxFailsUsername == 0 {
+		policy.MaxFailsUsername = 5
+	}
+	if policy.MaxFailsIp == 0 {
+		policy.MaxFailsIp = 20
+	}
+	if policy.Window <= 0 {
+		policy.Window = 15 * time.Minute
+	}
+	if policy.LockDuration <= 0 {
+		policy.LockDuration = 15 * time.Minute
+	}
+	return policy
+}
+
+type Guard struct {
+	records cache.Cacher[Record]
+	index   cache.Cacher[[]string]
+	mu      sync.Mutex
+}
+
+func New(records cache.Cacher[Record], index cache.Cacher[[]string]) *Guard {
+	return &Guard{records: records, index: index}
+}
+
+func buildKey(kind, value string) string {
+	return kind + "_" + value
+}
+
+// 账号统一小写，避免大小写绕过
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func (g *Guard) get(kind, value string) (Record, bool) {
+	return g.records.Get(buildKey(kind, value))
+}
+
+// 检查是否已锁定，返回剩余锁定时长
+func (g *Guard) Check(ip, username string) (bool, time.Duration) {
+	now := time.Now().Unix()
+	var remaining int64
+	for _, v := range [][2]string{{KIND_IP, ip}, {KIND_USERNAME, normalizeUsername(username)}} {
+		if v[1] == "" {
+			continue
+		}
+		if record, ok := g.get(v[0], v[1]); ok && record.LockedUntil > now && record.LockedUntil-now > remaining {
+			remaining = record.LockedUntil - now
+		}
+	}
+	return remaining > 0, time.Duration(remaining) * time.Second
+}
+
+// IP与账号中较大的失败次数
+func (g *Guard) Fails(ip, username string) int {
+	fails := 0
+	for _, v := range [][2]string{{KIND_IP, ip}, {KIND_USERNAME, normalizeUsername(username)}} {
+		if record, ok := g.get(v[0], v[1]); ok && record.Fails > fails {
+			fails = record.Fails
+		}
+	}
+	return fails
+}
+
+// 渐进延迟：根据已有的失败次数计算本次请求需要等待的时长
+func (g *Guard) Delay(ip, username string, policy Policy) time.Duration {
+	if policy.DelayStep <= 0 {
+		return 0
+	}
+	fails := g.Fails(ip, username)
+	if fails == 0 {
+		return 0
+	}
+	delay := policy.DelayStep
+	for i := 1; i < fails && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay
+}
+
+// 记录一次失败，返回是否因此被锁定
+func (g *Guard) Fail(ip, username string, policy Policy) bool {
+	lockedIp := g.fail(KIND_IP, ip, policy.MaxFailsIp, policy)
+	lockedUsername := g.fail(KIND_USERNAME, normalizeUsername(username), policy.MaxFailsUsername, policy)
+	return lockedIp || lockedUsername
+}
+
+func (g *Guard) fail(kind, value string, max int, policy Policy) bool {
+	if value == "" || max < 0 {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	key := buildKey(kind, value)
+	record, ok := g.records.Get(key)
+	if !ok {
+		record = Record{Key: key, Kind: kind, Value: value}
+	}
+	record.Fails++
+
+	if max > 0 && record.Fails >= max {
+		record.LockedUntil = time.Now().Add(policy.LockDuration).Unix()
+		g.records.Set(key, record, policy.LockDuration)
+		g.addIndex(key)
+		return true
+	}
+
+	if ok {
+		g.records.SetKeepExpiration(key, record)
+	} else {
+		g.records.Set(key, record, policy.Window)
+	}
+	return false
+}
+
+// 登录成功，清除账号的失败记录（IP记录保留，避免用有效账号重置计数）
+func (g *Guard) Success(username string) {
+	g.Clear(buildKey(KIND_USERNAME, normalizeUsername(username)))
+}
+
+// 当前锁定中的记录
+func (g *Guard) GetLockedList() []Record {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now().Unix()
+	list := []Record{}
+	keys := []string{}
+	index, _ := g.index.Get(indexKey)
+	for _, key := range index {
+		if record, ok := g.records.Get(key); ok && record.LockedUntil > now {
+			list = append(list, record)
+			keys = append(keys, key)
+		}
+	}
+	// 顺便清理已过期的索引
+	if len(keys) != len(index) {
+		g.index.Set(indexKey, keys, 0)
+	}
+	return list
+}
+
+// 解除锁定
+func (g *Guard) Clear(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	remove := map[string]bool{}
+	for _, key := range keys {
+		g.records.Delete(key)
+		remove[key] = true
+	}
+
+	index, _ := g.index.Get(indexKey)
+	newIndex := []string{}
+	for _, key := range index {
+		if !remove[key] {
+			newIndex = append(newIndex, key)
+		}
+	}
+	if len(newIndex) != len(index) {
+		g.index.Set(indexKey, newIndex, 0)
+	}
+}
+
+// 解除全部锁定
+func (g *Guard) ClearAll() {
+	index, _ := g.index.Get(indexKey)
+	g.Clear(index...)
+}
+
+func (g *Guard) addIndex(key string) {
+	index, _ := g.index.Get(indexKey)
+	for _, v := range index {
+		if v == key {
+			return
+		}
+	}
+	g.index.Set(indexKey, append(index, key), 0)
+}
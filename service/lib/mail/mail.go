@@ -1,7 +1,10 @@
 package mail
 
 import (
+	"errors"
 	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/secret"
 )
 
 // 发送注册验证码
@@ -70,3 +73,24 @@ func SendResetPasswordVCode(emailer *Emailer, mailTo, vcode string) error {
 // 	}
 // 	return err
 // }
+
+// 使用系统设置中的SMTP配置创建发件器
+func NewSystemEmailer() (*Emailer, error) {
+	emailSetting := systemSetting.Email{}
+	if err := global.SystemSetting.GetValueByInterface(systemSetting.SYSTEM_EMAIL, &emailSetting); err != nil || emailSetting.Host == "" {
+		return nil, errors.New("email is not configured")
+	}
+	if emailSetting.Port == 0 {
+		emailSetting.Port = 465
+	}
+	password, err := secret.Decrypt(emailSetting.Password)
+	if err != nil {
+		return nil, err
+	}
+	return NewEmailer(EmailInfo{
+		Username: emailSetting.Mail,
+		Password: password,
+		Host:     emailSetting.Host,
+		Port:     emailSetting.Port,
+	}), nil
+}
@@ -0,0 +1,494 @@
+package panelArchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sun-panel/lib/cmn"
+	"sun-panel/lib/panelData"
+	"sun-panel/models"
+	"sun-panel/models/datatype"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 面板导出导入归档：zip 包含 manifest.json 与 assets/ 下引用的上传文件
+
+const (
+	FORMAT         = "sun-panel-archive"
+	SCHEMA_VERSION = 1 // 当前归档结构版本，结构不兼容变化时递增
+	SCHEMA_MIN     = 1 // 支持导入的最低版本
+
+	MANIFEST_NAME = "manifest.json"
+	ASSETS_DIR    = "assets/"
+
+	MAX_MANIFEST_SIZE = 20 << 20 // manifest.json 最大20M
+	MAX_ASSET_SIZE    = 20 << 20 // 单个文件最大20M
+)
+
+var (
+	ErrFormat        = errors.New("not a sun-panel archive")
+	ErrSchemaVersion = errors.New("unsupported archive schema version")
+	errDryRun        = errors.New("dry run")
+)
+
+// 允许导入的文件扩展名
+var assetExts = []string{".png", ".jpg", ".gif", ".jpeg", ".webp", ".svg", ".ico"}
+
+var assetNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}\.[a-z0-9]{1,10}$`)
+
+type Manifest struct {
+	Format        string         `json:"format"`
+	SchemaVersion int            `json:"schemaVersion"`
+	AppVersion    string         `json:"appVersion"`
+	ExportedAt    time.Time      `json:"exportedAt"`
+	Groups        []Group        `json:"groups"`
+	UserConfig    *UserConfig    `json:"userConfig"`
+	ModuleConfigs []ModuleConfig `json:"moduleConfigs"`
+	Files         []File         `json:"files"`
+}
+
+type Group struct {
+	Icon        string `json:"icon"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Sort        int    `json:"sort"`
+	Items       []Item `json:"items"`
+}
+
+type Item struct {
+	Icon        datatype.ItemIconIconInfo `json:"icon"`
+	Title       string                    `json:"title"`
+	Url         string                    `json:"url"`
+	LanUrl      string                    `json:"lanUrl"`
+	Description string                    `json:"description"`
+	OpenMethod  int                       `json:"openMethod"`
+	Sort        int                       `json:"sort"`
+}
+
+type UserConfig struct {
+	Panel        map[string]interface{} `json:"panel"`
+	SearchEngine map[string]interface{} `json:"searchEngine"`
+}
+
+type ModuleConfig struct {
+	Name  string                 `json:"name"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// 引用的上传文件
+type File struct {
+	Name     string `json:"name"`     // 归档中 assets/ 下的文件名
+	Src      string `json:"src"`      // 导出时的访问地址，导入时替换为新地址
+	FileName string `json:"fileName"` // 原始文件名
+}
+
+// 导入结果
+type Report struct {
+	DryRun        bool     `json:"dryRun"`
+	Mode          string   `json:"mode"`
+	SchemaVersion int      `json:"schemaVersion"`
+	AppVersion    string   `json:"appVersion"`
+	Groups        int      `json:"groups"`        // 新建的分组
+	MergedGroups  int      `json:"mergedGroups"`  // 合并到同名分组
+	Items         int      `json:"items"`         // 新建的图标
+	SkippedItems  int      `json:"skippedItems"`  // 分组内已存在相同地址而跳过的图标
+	UserConfig    bool     `json:"userConfig"`    // 是否导入了UserConfig
+	ModuleConfigs int      `json:"moduleConfigs"` // 导入的ModuleConfig
+	Files         int      `json:"files"`         // 导入的文件
+	Warnings      []string `json:"warnings"`
+}
+
+// 导出用户的面板
+// sourcePath 为上传目录（配置 base.source_path，如 ./uploads）
+func Export(db *gorm.DB, userId uint, sourcePath string, w io.Writer) error {
+	manifest := Manifest{
+		Format:        FORMAT,
+		SchemaVersion: SCHEMA_VERSION,
+		AppVersion:    cmn.GetSysVersionInfo().Version,
+		ExportedAt:    time.Now(),
+		Groups:        []Group{},
+		ModuleConfigs: []ModuleConfig{},
+		Files:         []File{},
+	}
+
+	groups := []models.ItemIconGroup{}
+	if err := db.Order("sort ,created_at").Where("user_id=?", userId).Find(&groups).Error; err != nil {
+		return err
+	}
+	for _, g := range groups {
+		group := Group{Icon: g.Icon, Title: g.Title, Description: g.Description, Sort: g.Sort, Items: []Item{}}
+		items := []models.ItemIcon{}
+		if err := db.Order("sort ,created_at").Where("user_id=? AND item_icon_group_id=?", userId, g.ID).Find(&items).Error; err != nil {
+			return err
+		}
+		for _, v := range items {
+			item := Item{Title: v.Title, Url: v.Url, LanUrl: v.LanUrl, Description: v.Description, OpenMethod: v.OpenMethod, Sort: v.Sort}
+			json.Unmarshal([]byte(v.IconJson), &item.Icon)
+			group.Items = append(group.Items, item)
+		}
+		manifest.Groups = append(manifest.Groups, group)
+	}
+
+	userConfig := models.UserConfig{}
+	if err := db.First(&userConfig, "user_id=?", userId).Error; err == nil {
+		manifest.UserConfig = &UserConfig{}
+		json.Unmarshal([]byte(userConfig.PanelJson), &manifest.UserConfig.Panel)
+		json.Unmarshal([]byte(userConfig.SearchEngineJson), &manifest.UserConfig.SearchEngine)
+	} else if err != gorm.ErrRecordNotFound {
+		return err
+	}
+
+	moduleConfigs := []models.ModuleConfig{}
+	if err := db.Where("user_id=?", userId).Find(&moduleConfigs).Error; err != nil {
+		return err
+	}
+	for _, v := range moduleConfigs {
+		cfg := ModuleConfig{Name: v.Name}
+		json.Unmarshal([]byte(v.ValueJson), &cfg.Value)
+		manifest.ModuleConfigs = append(manifest.ModuleConfigs, cfg)
+	}
+
+	zw := zip.NewWriter(w)
+
+	// 收集引用的上传文件
+	urlPrefix := strings.TrimRight(strings.TrimPrefix(sourcePath, "."), "/") + "/"
+	added := map[string]bool{}
+	var walkErr error
+	manifest.walkStrings(func(s string) string {
+		if walkErr != nil || added[s] || !strings.HasPrefix(s, urlPrefix) || strings.Contains(s, "..") {
+			return s
+		}
+		localPath := "." + s
+		if info, err := os.Stat(localPath); err != nil || info.IsDir() || info.Size() > MAX_ASSET_SIZE {
+			return s
+		}
+		added[s] = true
+		ext := strings.ToLower(path.Ext(s))
+		file := File{
+			Name:     fmt.Sprintf("%d%s", len(manifest.Files)+1, ext),
+			Src:      s,
+			FileName: path.Base(s),
+		}
+		mFile := models.File{}
+		if db.First(&mFile, "src=?", localPath).Error == nil {
+			file.FileName = mFile.FileName
+		}
+		if walkErr = zipAddFile(zw, ASSETS_DIR+file.Name, localPath); walkErr == nil {
+			manifest.Files = append(manifest.Files, file)
+		}
+		return s
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+
+	manifestWriter, err := zw.Create(MANIFEST_NAME)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(manifestWriter)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func zipAddFile(zw *zip.Writer, name, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// 读取并校验归档
+func Read(data []byte) (Manifest, *zip.Reader, error) {
+	manifest := Manifest{}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return manifest, nil, ErrFormat
+	}
+	content, err := zipReadFile(zr, MANIFEST_NAME, MAX_MANIFEST_SIZE)
+	if err != nil {
+		return manifest, nil, ErrFormat
+	}
+	if err := json.Unmarshal(content, &manifest); err != nil || manifest.Format != FORMAT {
+		return manifest, nil, ErrFormat
+	}
+	if manifest.SchemaVersion < SCHEMA_MIN || manifest.SchemaVersion > SCHEMA_VERSION {
+		return manifest, nil, fmt.Errorf("%w: %d (supported %d-%d)", ErrSchemaVersion, manifest.SchemaVersion, SCHEMA_MIN, SCHEMA_VERSION)
+	}
+	return manifest, zr, nil
+}
+
+func zipReadFile(zr *zip.Reader, name string, maxSize int64) ([]byte, error) {
+	for _, f := range zr.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		content, err := io.ReadAll(io.LimitReader(rc, maxSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(content)) > maxSize {
+			return nil, fmt.Errorf("%s is too large", name)
+		}
+		return content, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// 导入归档到用户的面板，dryRun 时只返回结果不保存
+// 合并模式：同名分组合并，分组内已存在相同地址的图标跳过，已有的UserConfig、同名ModuleConfig保留
+// 替换模式：先清空用户的面板数据
+// saveFiles 为 false（没有上传文件的权限）时不保存归档中的文件，引用保持原样
+func Import(db *gorm.DB, userId uint, data []byte, mode string, dryRun bool, sourcePath string, saveFiles bool) (Report, error) {
+	report := Report{DryRun: dryRun, Mode: mode, Warnings: []string{}}
+	manifest, zr, err := Read(data)
+	if err != nil {
+		return report, err
+	}
+	report.SchemaVersion = manifest.SchemaVersion
+	report.AppVersion = manifest.AppVersion
+
+	// 保存文件并替换引用地址，dryRun 时不保存
+	savedFiles := []string{}
+	srcMap := map[string]string{}
+	for _, f := range manifest.Files {
+		if !saveFiles {
+			report.Warnings = append(report.Warnings, "skipped file: "+f.Name+": no permission to upload files")
+			continue
+		}
+		ext := strings.ToLower(path.Ext(f.Name))
+		if !assetNameRegexp.MatchString(f.Name) || !cmn.InArray(assetExts, ext) {
+			report.Warnings = append(report.Warnings, "skipped file: "+f.Name)
+			continue
+		}
+		content, err := zipReadFile(zr, ASSETS_DIR+f.Name, MAX_ASSET_SIZE)
+		if err != nil {
+			report.Warnings = append(report.Warnings, "skipped file: "+f.Name+": "+err.Error())
+			continue
+		}
+		report.Files++
+		if dryRun {
+			continue
+		}
+		dir := fmt.Sprintf("%s/%d/%d/%d/", sourcePath, time.Now().Year(), time.Now().Month(), time.Now().Day())
+		os.MkdirAll(dir, os.ModePerm)
+		filepath := dir + cmn.Md5(fmt.Sprintf("%s%s%d", f.Name, time.Now().String(), userId)) + ext
+		if err := os.WriteFile(filepath, content, 0644); err != nil {
+			removeFiles(savedFiles)
+			return report, err
+		}
+		savedFiles = append(savedFiles, filepath)
+		srcMap[f.Src] = filepath[1:]
+	}
+	if len(srcMap) > 0 {
+		manifest.walkStrings(func(s string) string {
+			if v, ok := srcMap[s]; ok {
+				return v
+			}
+			return s
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if mode == panelData.MODE_REPLACE {
+			if err := panelData.Clear(tx, userId); err != nil {
+				return err
+			}
+		}
+		if err := importGroups(tx, userId, manifest.Groups, &report); err != nil {
+			return err
+		}
+		if err := importConfigs(tx, userId, manifest, &report); err != nil {
+			return err
+		}
+		for _, f := range manifest.Files {
+			if src, ok := srcMap[f.Src]; ok {
+				mFile := models.File{UserId: userId, FileName: f.FileName, Src: "." + src, Ext: path.Ext(src)}
+				if err := tx.Create(&mFile).Error; err != nil {
+					return err
+				}
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err == errDryRun {
+		return report, nil
+	}
+	if err != nil {
+		removeFiles(savedFiles)
+	}
+	return report, err
+}
+
+func removeFiles(files []string) {
+	for _, v := range files {
+		os.Remove(v)
+	}
+}
+
+// 导入分组和图标，分组ID重新分配
+func importGroups(tx *gorm.DB, userId uint, groups []Group, report *Report) error {
+	existGroups := []models.ItemIconGroup{}
+	if err := tx.Where("user_id=?", userId).Find(&existGroups).Error; err != nil {
+		return err
+	}
+	existGroupIds := map[string]uint{} // 标题 => 分组ID
+	for _, v := range existGroups {
+		existGroupIds[v.Title] = v.ID
+	}
+
+	for _, g := range groups {
+		groupId, exist := existGroupIds[g.Title]
+		existUrls := map[string]bool{}
+		if exist {
+			report.MergedGroups++
+			urls := []string{}
+			if err := tx.Model(&models.ItemIcon{}).Where("user_id=? AND item_icon_group_id=?", userId, groupId).Pluck("url", &urls).Error; err != nil {
+				return err
+			}
+			for _, v := range urls {
+				existUrls[v] = true
+			}
+		} else {
+			group := models.ItemIconGroup{
+				Icon:        g.Icon,
+				Title:       cmn.SubRuneStr(g.Title, 0, 50),
+				Description: cmn.SubRuneStr(g.Description, 0, 1000),
+				Sort:        g.Sort,
+				UserId:      userId,
+			}
+			if err := tx.Create(&group).Error; err != nil {
+				return err
+			}
+			groupId = group.ID
+			existGroupIds[g.Title] = groupId
+			report.Groups++
+		}
+
+		for _, v := range g.Items {
+			if existUrls[v.Url] {
+				report.SkippedItems++
+				continue
+			}
+			existUrls[v.Url] = true
+			item := models.ItemIcon{
+				Title:           cmn.SubRuneStr(v.Title, 0, 50),
+				Url:             cmn.SubRuneStr(v.Url, 0, 1000),
+				LanUrl:          cmn.SubRuneStr(v.LanUrl, 0, 1000),
+				Description:     cmn.SubRuneStr(v.Description, 0, 1000),
+				OpenMethod:      v.OpenMethod,
+				Sort:            v.Sort,
+				ItemIconGroupId: int(groupId),
+				UserId:          userId,
+			}
+			if j, err := json.Marshal(v.Icon); err == nil {
+				item.IconJson = string(j)
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			report.Items++
+		}
+	}
+	return nil
+}
+
+// 导入UserConfig和ModuleConfig，已存在的保留
+func importConfigs(tx *gorm.DB, userId uint, manifest Manifest, report *Report) error {
+	if manifest.UserConfig != nil {
+		if err := tx.First(&models.UserConfig{}, "user_id=?", userId).Error; err == gorm.ErrRecordNotFound {
+			panelJson, _ := json.Marshal(manifest.UserConfig.Panel)
+			searchEngineJson, _ := json.Marshal(manifest.UserConfig.SearchEngine)
+			if err := tx.Create(&models.UserConfig{
+				UserId:           userId,
+				PanelJson:        string(panelJson),
+				SearchEngineJson: string(searchEngineJson),
+			}).Error; err != nil {
+				return err
+			}
+			report.UserConfig = true
+		} else if err != nil {
+			return err
+		} else {
+			report.Warnings = append(report.Warnings, "userConfig already exists, skipped")
+		}
+	}
+
+	for _, v := range manifest.ModuleConfigs {
+		if v.Name == "" {
+			continue
+		}
+		var count int64
+		if err := tx.Model(&models.ModuleConfig{}).Where("user_id=? AND name=?", userId, v.Name).Count(&count).Error; err != nil {
+			return err
+		} else if count > 0 {
+			report.Warnings = append(report.Warnings, "moduleConfig already exists, skipped: "+v.Name)
+			continue
+		}
+		valueJson, _ := json.Marshal(v.Value)
+		if err := tx.Create(&models.ModuleConfig{UserId: userId, Name: v.Name, ValueJson: string(valueJson)}).Error; err != nil {
+			return err
+		}
+		report.ModuleConfigs++
+	}
+	return nil
+}
+
+// 遍历（并替换）归档中可能引用上传文件的字符串：图标地址、UserConfig、ModuleConfig
+func (m *Manifest) walkStrings(fn func(string) string) {
+	for i := range m.Groups {
+		for j := range m.Groups[i].Items {
+			m.Groups[i].Items[j].Icon.Src = fn(m.Groups[i].Items[j].Icon.Src)
+		}
+	}
+	if m.UserConfig != nil {
+		walkValue(m.UserConfig.Panel, fn)
+		walkValue(m.UserConfig.SearchEngine, fn)
+	}
+	for i := range m.ModuleConfigs {
+		walkValue(m.ModuleConfigs[i].Value, fn)
+	}
+}
+
+func walkValue(v interface{}, fn func(string) string) interface{} {
+	switch value := v.(type) {
+	case string:
+		return fn(value)
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = walkValue(item, fn)
+		}
+	case []interface{}:
+		for k, item := range value {
+			value[k] = walkValue(item, fn)
+		}
+	}
+	return v
+}
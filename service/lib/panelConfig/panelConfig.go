@@ -0,0 +1,484 @@
+package panelConfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sun-panel/lib/bookmark"
+	"sun-panel/models"
+	"sun-panel/models/datatype"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// 声明式面板配置（YAML）：声明用户的分组、图标和 UserConfig
+// 由配置文件创建的分组和图标记录 ConfigKey，应用配置时只创建、修改、删除这些数据，手动创建的数据保持不变
+// 未在配置文件中声明的用户不做任何修改
+
+type Config struct {
+	Users []User `yaml:"users"`
+}
+
+type User struct {
+	Username   string      `yaml:"username"`
+	UserConfig *UserConfig `yaml:"userConfig,omitempty"`
+	Groups     []Group     `yaml:"groups"`
+}
+
+// 只覆盖声明的部分
+type UserConfig struct {
+	Panel        map[string]interface{} `yaml:"panel,omitempty"`
+	SearchEngine map[string]interface{} `yaml:"searchEngine,omitempty"`
+}
+
+// 排序按配置文件中的顺序
+type Group struct {
+	Key         string `yaml:"key,omitempty"` // 为空时使用标题
+	Title       string `yaml:"title"`
+	Icon        string `yaml:"icon,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	Items       []Item `yaml:"items"`
+}
+
+type Item struct {
+	Key         string `yaml:"key,omitempty"` // 为空时使用地址
+	Title       string `yaml:"title"`
+	Url         string `yaml:"url"`
+	LanUrl      string `yaml:"lanUrl,omitempty"`
+	Description string `yaml:"description,omitempty"`
+	OpenMethod  int    `yaml:"openMethod,omitempty"` // 1.当前窗口 2.新窗口（默认） 3.小窗口
+	Icon        *Icon  `yaml:"icon,omitempty"`       // 为空时使用标题首字
+}
+
+type Icon struct {
+	ItemType        int    `yaml:"itemType"` // 1.文字 2.图片 3.图标
+	Src             string `yaml:"src,omitempty"`
+	Text            string `yaml:"text,omitempty"`
+	BackgroundColor string `yaml:"backgroundColor,omitempty"`
+}
+
+const (
+	maxKeyLength  = 255  // ConfigKey 字段长度
+	maxTextLength = 1000 // 地址、描述、图标字段长度
+)
+
+func (i *Icon) info() datatype.ItemIconIconInfo {
+	return datatype.ItemIconIconInfo{ItemType: i.ItemType, Src: i.Src, Text: i.Text, BackgroundColor: i.BackgroundColor}
+}
+
+type Report struct {
+	GroupsCreated int      `json:"groupsCreated"`
+	GroupsUpdated int      `json:"groupsUpdated"`
+	GroupsDeleted int      `json:"groupsDeleted"`
+	ItemsCreated  int      `json:"itemsCreated"`
+	ItemsUpdated  int      `json:"itemsUpdated"`
+	ItemsDeleted  int      `json:"itemsDeleted"`
+	UnknownUsers  []string `json:"unknownUsers"` // 不存在的用户，已跳过
+}
+
+func (r Report) String() string {
+	s := fmt.Sprintf("groups +%d ~%d -%d, items +%d ~%d -%d", r.GroupsCreated, r.GroupsUpdated, r.GroupsDeleted, r.ItemsCreated, r.ItemsUpdated, r.ItemsDeleted)
+	if len(r.UnknownUsers) > 0 {
+		s += ", unknown users: " + strings.Join(r.UnknownUsers, ", ")
+	}
+	return s
+}
+
+// 读取并校验配置文件
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func Parse(data []byte) (*Config, error) {
+	config := Config{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// 校验配置，并补全默认的标识
+func (c *Config) Validate() error {
+	errs := []error{}
+	usernames := map[string]bool{}
+	for ui := range c.Users {
+		user := &c.Users[ui]
+		user.Username = strings.TrimSpace(user.Username)
+		if user.Username == "" {
+			errs = append(errs, fmt.Errorf("users[%d]: username is required", ui))
+			continue
+		}
+		if usernames[user.Username] {
+			errs = append(errs, fmt.Errorf("users[%d]: duplicate username %q", ui, user.Username))
+		}
+		usernames[user.Username] = true
+
+		groupKeys := map[string]bool{}
+		for gi := range user.Groups {
+			group := &user.Groups[gi]
+			at := fmt.Sprintf("%s.groups[%d]", user.Username, gi)
+			if group.Title == "" || utf8.RuneCountInString(group.Title) > 50 {
+				errs = append(errs, fmt.Errorf("%s: title is required and at most 50 characters", at))
+			}
+			if utf8.RuneCountInString(group.Description) > maxTextLength {
+				errs = append(errs, fmt.Errorf("%s: description must be at most %d characters", at, maxTextLength))
+			}
+			if group.Key == "" {
+				group.Key = group.Title
+			}
+			if utf8.RuneCountInString(group.Key) > maxKeyLength {
+				errs = append(errs, fmt.Errorf("%s: key must be at most %d characters", at, maxKeyLength))
+			}
+			if groupKeys[group.Key] {
+				errs = append(errs, fmt.Errorf("%s: duplicate key %q", at, group.Key))
+			}
+			groupKeys[group.Key] = true
+
+			itemKeys := map[string]bool{}
+			for ii := range group.Items {
+				item := &group.Items[ii]
+				at := fmt.Sprintf("%s.items[%d]", at, ii)
+				if item.Title == "" || utf8.RuneCountInString(item.Title) > 50 {
+					errs = append(errs, fmt.Errorf("%s: title is required and at most 50 characters", at))
+				}
+				if !bookmark.IsHttpUrl(item.Url) || utf8.RuneCountInString(item.Url) > maxTextLength {
+					errs = append(errs, fmt.Errorf("%s: url is required, must be a http(s) url and at most %d characters", at, maxTextLength))
+				}
+				if item.LanUrl != "" && (!bookmark.IsHttpUrl(item.LanUrl) || utf8.RuneCountInString(item.LanUrl) > maxTextLength) {
+					errs = append(errs, fmt.Errorf("%s: lanUrl must be a http(s) url and at most %d characters", at, maxTextLength))
+				}
+				if utf8.RuneCountInString(item.Description) > maxTextLength {
+					errs = append(errs, fmt.Errorf("%s: description must be at most %d characters", at, maxTextLength))
+				}
+				if item.OpenMethod < 0 || item.OpenMethod > 3 {
+					errs = append(errs, fmt.Errorf("%s: openMethod must be 1, 2 or 3", at))
+				}
+				if item.Icon != nil && (item.Icon.ItemType < 1 || item.Icon.ItemType > 3) {
+					errs = append(errs, fmt.Errorf("%s: icon.itemType must be 1, 2 or 3", at))
+				}
+				if item.Icon != nil {
+					if j, _ := json.Marshal(item.Icon.info()); utf8.RuneCount(j) > maxTextLength {
+						errs = append(errs, fmt.Errorf("%s: icon is too long", at))
+					}
+				}
+				if item.Key == "" {
+					item.Key = item.Url
+				}
+				if utf8.RuneCountInString(item.Key) > maxKeyLength {
+					errs = append(errs, fmt.Errorf("%s: key must be at most %d characters, set a shorter key", at, maxKeyLength))
+				}
+				if itemKeys[item.Key] {
+					errs = append(errs, fmt.Errorf("%s: duplicate key %q", at, item.Key))
+				}
+				itemKeys[item.Key] = true
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 应用配置，每个用户在一个事务中完成
+func Apply(db *gorm.DB, config *Config) (Report, error) {
+	report := Report{}
+	for _, user := range config.Users {
+		userInfo := models.User{}
+		if err := db.First(&userInfo, "username=?", user.Username).Error; err == gorm.ErrRecordNotFound {
+			report.UnknownUsers = append(report.UnknownUsers, user.Username)
+			continue
+		} else if err != nil {
+			return report, err
+		}
+
+		userReport := Report{}
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			if err := applyGroups(tx, userInfo.ID, user.Groups, &userReport); err != nil {
+				return err
+			}
+			return applyUserConfig(tx, userInfo.ID, user.UserConfig)
+		}); err != nil {
+			return report, fmt.Errorf("%s: %w", user.Username, err)
+		}
+		report.GroupsCreated += userReport.GroupsCreated
+		report.GroupsUpdated += userReport.GroupsUpdated
+		report.GroupsDeleted += userReport.GroupsDeleted
+		report.ItemsCreated += userReport.ItemsCreated
+		report.ItemsUpdated += userReport.ItemsUpdated
+		report.ItemsDeleted += userReport.ItemsDeleted
+	}
+	return report, nil
+}
+
+func applyGroups(tx *gorm.DB, userId uint, groups []Group, report *Report) error {
+	managedGroups := []models.ItemIconGroup{}
+	if err := tx.Where("user_id=? AND config_key<>''", userId).Find(&managedGroups).Error; err != nil {
+		return err
+	}
+	managedGroupMap := map[string]models.ItemIconGroup{}
+	for _, v := range managedGroups {
+		managedGroupMap[v.ConfigKey] = v
+	}
+
+	keep := map[uint]bool{}
+	for i, v := range groups {
+		group, ok := managedGroupMap[v.Key]
+		if !ok {
+			group = models.ItemIconGroup{
+				Title:       v.Title,
+				Icon:        v.Icon,
+				Description: v.Description,
+				Sort:        i + 1,
+				UserId:      userId,
+				ConfigKey:   v.Key,
+			}
+			if err := tx.Create(&group).Error; err != nil {
+				return err
+			}
+			report.GroupsCreated++
+		} else if group.Title != v.Title || group.Icon != v.Icon || group.Description != v.Description || group.Sort != i+1 {
+			group.Title, group.Icon, group.Description, group.Sort = v.Title, v.Icon, v.Description, i+1
+			if err := tx.Model(&models.ItemIconGroup{}).Select("Title", "Icon", "Description", "Sort").Where("id=?", group.ID).Updates(&group).Error; err != nil {
+				return err
+			}
+			report.GroupsUpdated++
+		}
+		keep[group.ID] = true
+
+		if err := applyItems(tx, userId, group.ID, v.Items, report); err != nil {
+			return err
+		}
+	}
+
+	// 删除已从配置文件移除的分组；分组内还有手动创建的图标时只解除管理
+	mItemIconGroupShare := models.ItemIconGroupShare{}
+	for _, group := range managedGroups {
+		if keep[group.ID] {
+			continue
+		}
+		if err := applyItems(tx, userId, group.ID, nil, report); err != nil {
+			return err
+		}
+		var count int64
+		if err := tx.Model(&models.ItemIcon{}).Where("user_id=? AND item_icon_group_id=?", userId, group.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			if err := tx.Model(&models.ItemIconGroup{}).Where("id=?", group.ID).Update("config_key", "").Error; err != nil {
+				return err
+			}
+			continue
+		}
+		if err := mItemIconGroupShare.DeleteByGroupIds(tx, []uint{group.ID}); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.ItemIconGroup{}, "id=?", group.ID).Error; err != nil {
+			return err
+		}
+		report.GroupsDeleted++
+	}
+	return nil
+}
+
+func applyItems(tx *gorm.DB, userId, groupId uint, items []Item, report *Report) error {
+	managedItems := []models.ItemIcon{}
+	if err := tx.Where("user_id=? AND item_icon_group_id=? AND config_key<>''", userId, groupId).Find(&managedItems).Error; err != nil {
+		return err
+	}
+	managedItemMap := map[string]models.ItemIcon{}
+	for _, v := range managedItems {
+		managedItemMap[v.ConfigKey] = v
+	}
+
+	keep := map[uint]bool{}
+	for i, v := range items {
+		item := models.ItemIcon{
+			Title:           v.Title,
+			Url:             v.Url,
+			LanUrl:          v.LanUrl,
+			Description:     v.Description,
+			OpenMethod:      v.OpenMethod,
+			Sort:            i + 1,
+			ItemIconGroupId: int(groupId),
+			UserId:          userId,
+			ConfigKey:       v.Key,
+		}
+		if item.OpenMethod == 0 {
+			item.OpenMethod = 2
+		}
+		if v.Icon != nil {
+			item.Icon = v.Icon.info()
+		} else {
+			r, _ := utf8.DecodeRuneInString(v.Title)
+			item.Icon = datatype.ItemIconIconInfo{ItemType: 1, Text: string(r)}
+		}
+		if j, err := json.Marshal(item.Icon); err == nil {
+			item.IconJson = string(j)
+		}
+
+		old, ok := managedItemMap[v.Key]
+		if !ok {
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+			report.ItemsCreated++
+			continue
+		}
+		keep[old.ID] = true
+		if old.Title == item.Title && old.Url == item.Url && old.LanUrl == item.LanUrl && old.Description == item.Description &&
+			old.OpenMethod == item.OpenMethod && old.Sort == item.Sort && old.IconJson == item.IconJson {
+			continue
+		}
+		if err := tx.Model(&models.ItemIcon{}).Select("Title", "Url", "LanUrl", "Description", "OpenMethod", "Sort", "IconJson").Where("id=?", old.ID).Updates(&item).Error; err != nil {
+			return err
+		}
+		report.ItemsUpdated++
+	}
+
+	for _, v := range managedItems {
+		if keep[v.ID] {
+			continue
+		}
+		if err := tx.Delete(&models.ItemIcon{}, "id=?", v.ID).Error; err != nil {
+			return err
+		}
+		report.ItemsDeleted++
+	}
+	return nil
+}
+
+func applyUserConfig(tx *gorm.DB, userId uint, config *UserConfig) error {
+	if config == nil || (config.Panel == nil && config.SearchEngine == nil) {
+		return nil
+	}
+	userConfig := models.UserConfig{}
+	exist := true
+	if err := tx.First(&userConfig, "user_id=?", userId).Error; err == gorm.ErrRecordNotFound {
+		exist = false
+	} else if err != nil {
+		return err
+	}
+
+	fields := []string{}
+	if config.Panel != nil {
+		jb, err := json.Marshal(config.Panel)
+		if err != nil {
+			return err
+		}
+		userConfig.PanelJson = string(jb)
+		fields = append(fields, "PanelJson")
+	}
+	if config.SearchEngine != nil {
+		jb, err := json.Marshal(config.SearchEngine)
+		if err != nil {
+			return err
+		}
+		userConfig.SearchEngineJson = string(jb)
+		fields = append(fields, "SearchEngineJson")
+	}
+
+	if !exist {
+		userConfig.UserId = userId
+		return tx.Create(&userConfig).Error
+	}
+	return tx.Model(&models.UserConfig{}).Select(fields).Where("user_id=?", userId).Updates(&userConfig).Error
+}
+
+// 导出当前的面板数据为配置，usernames 为空时导出全部用户
+// 手动创建的分组和图标同样导出，但应用时不会接管它们；标识重复或过长时生成唯一的标识
+func Dump(db *gorm.DB, usernames []string) (*Config, error) {
+	users := []models.User{}
+	query := db.Order("id")
+	if len(usernames) > 0 {
+		query = query.Where("username in ?", usernames)
+	}
+	if err := query.Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	config := Config{Users: []User{}}
+	for _, userInfo := range users {
+		user := User{Username: userInfo.Username, Groups: []Group{}}
+
+		userConfig := models.UserConfig{}
+		if err := db.First(&userConfig, "user_id=?", userInfo.ID).Error; err == nil {
+			user.UserConfig = &UserConfig{}
+			json.Unmarshal([]byte(userConfig.PanelJson), &user.UserConfig.Panel)
+			json.Unmarshal([]byte(userConfig.SearchEngineJson), &user.UserConfig.SearchEngine)
+		} else if err != gorm.ErrRecordNotFound {
+			return nil, err
+		}
+
+		groups := []models.ItemIconGroup{}
+		if err := db.Order("sort ,created_at").Where("user_id=?", userInfo.ID).Find(&groups).Error; err != nil {
+			return nil, err
+		}
+		groupKeys := map[string]bool{}
+		for _, v := range groups {
+			group := Group{Title: v.Title, Icon: v.Icon, Description: v.Description, Items: []Item{}}
+			if group.Key = dumpKey(v.ConfigKey, v.Title, groupKeys); group.Key == v.Title {
+				group.Key = ""
+			}
+
+			itemIcons := []models.ItemIcon{}
+			if err := db.Order("sort ,created_at").Find(&itemIcons, "item_icon_group_id=? AND user_id=?", v.ID, userInfo.ID).Error; err != nil {
+				return nil, err
+			}
+			itemKeys := map[string]bool{}
+			for _, itemIcon := range itemIcons {
+				item := Item{
+					Title:       itemIcon.Title,
+					Url:         itemIcon.Url,
+					LanUrl:      itemIcon.LanUrl,
+					Description: itemIcon.Description,
+					OpenMethod:  itemIcon.OpenMethod,
+				}
+				if item.Key = dumpKey(itemIcon.ConfigKey, itemIcon.Url, itemKeys); item.Key == itemIcon.Url {
+					item.Key = ""
+				}
+				icon := datatype.ItemIconIconInfo{}
+				if err := json.Unmarshal([]byte(itemIcon.IconJson), &icon); err == nil && icon.ItemType != 0 {
+					item.Icon = &Icon{ItemType: icon.ItemType, Src: icon.Src, Text: icon.Text, BackgroundColor: icon.BackgroundColor}
+				}
+				group.Items = append(group.Items, item)
+			}
+			user.Groups = append(user.Groups, group)
+		}
+		config.Users = append(config.Users, user)
+	}
+	return &config, nil
+}
+
+// 导出的标识：已有标识优先，否则使用默认标识（标题或地址），重复时追加序号，并限制长度
+func dumpKey(configKey, defaultKey string, used map[string]bool) string {
+	key := configKey
+	if key == "" {
+		key = defaultKey
+	}
+	if utf8.RuneCountInString(key) > maxKeyLength {
+		key = string([]rune(key)[:maxKeyLength-10])
+	}
+	for i := 2; used[key]; i++ {
+		key = strings.TrimSuffix(key, fmt.Sprintf("#%d", i-1)) + fmt.Sprintf("#%d", i)
+	}
+	used[key] = true
+	return key
+}
+
+// 输出为YAML
+func (c *Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
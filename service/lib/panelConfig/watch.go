@@ -0,0 +1,49 @@
+package panelConfig
+
+import (
+	"os"
+	"sun-panel/global"
+	"time"
+)
+
+// 启动时应用配置文件，之后定时检查文件变化并重新应用
+func StartWatch(path string, interval time.Duration) {
+	var lastModTime time.Time
+	var lastSize int64 = -1
+	check := func() {
+		info, err := os.Stat(path)
+		if err != nil {
+			global.Logger.Errorln("Failed to read the panel configuration file:", path, err)
+			return
+		}
+		if info.ModTime().Equal(lastModTime) && info.Size() == lastSize {
+			return
+		}
+		lastModTime, lastSize = info.ModTime(), info.Size()
+		applyFile(path)
+	}
+
+	check()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			check()
+		}
+	}()
+}
+
+func applyFile(path string) {
+	config, err := Load(path)
+	if err != nil {
+		global.Logger.Errorln("Invalid panel configuration file, not applied:", path, err)
+		return
+	}
+	report, err := Apply(global.Db, config)
+	if err != nil {
+		global.Logger.Errorln("Failed to apply the panel configuration file:", path, err)
+		return
+	}
+	global.Logger.Infoln("Panel configuration file applied:", path, report.String())
+}
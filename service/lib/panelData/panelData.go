@@ -0,0 +1,37 @@
+package panelData
+
+import (
+	"sun-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// 用户面板数据的公共操作，供面板模板、面板归档等使用
+
+const (
+	MODE_MERGE   = "merge"   // 合并：追加不存在的分组（按标题）和图标（按地址），已有的配置保留
+	MODE_REPLACE = "replace" // 替换：清空用户原有的面板数据后写入
+)
+
+// 清空用户的面板数据：分组（及共享）、图标、UserConfig、ModuleConfig
+func Clear(tx *gorm.DB, userId uint) error {
+	mItemIconGroup := models.ItemIconGroup{}
+	mItemIconGroupShare := models.ItemIconGroupShare{}
+	groupIds := []uint{}
+	if err := tx.Model(&models.ItemIconGroup{}).Where("user_id=?", userId).Pluck("id", &groupIds).Error; err != nil {
+		return err
+	}
+	if err := mItemIconGroupShare.DeleteByGroupIds(tx, groupIds); err != nil {
+		return err
+	}
+	if err := tx.Delete(&models.ItemIcon{}, "user_id=?", userId).Error; err != nil {
+		return err
+	}
+	if err := mItemIconGroup.DeleteByUserId(tx, userId); err != nil {
+		return err
+	}
+	if err := tx.Delete(&models.UserConfig{}, "user_id=?", userId).Error; err != nil {
+		return err
+	}
+	return tx.Delete(&models.ModuleConfig{}, "user_id=?", userId).Error
+}
@@ -0,0 +1,171 @@
+package panelTemplate
+
+import (
+	"errors"
+	"sun-panel/global"
+	"sun-panel/lib/cmn/systemSetting"
+	"sun-panel/lib/panelData"
+	"sun-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// 默认面板模板：将模板用户的分组、图标、UserConfig、ModuleConfig 复制到其他用户
+
+var ErrNoTemplate = errors.New("no template user is set")
+
+// 获取模板用户ID，未设置时返回0
+func GetTemplateUserId() uint {
+	var userId *uint
+	if err := global.SystemSetting.GetValueByInterface(systemSetting.PANEL_TEMPLATE_USER_ID, &userId); err != nil || userId == nil {
+		return 0
+	}
+	return *userId
+}
+
+// 新用户应用默认模板，未设置模板时忽略
+func ApplyDefault(userId uint) error {
+	templateUserId := GetTemplateUserId()
+	if templateUserId == 0 || templateUserId == userId {
+		return nil
+	}
+	return global.Db.Transaction(func(tx *gorm.DB) error {
+		return Apply(tx, templateUserId, userId, panelData.MODE_MERGE)
+	})
+}
+
+// 将模板用户的面板复制到目标用户
+func Apply(tx *gorm.DB, templateUserId, userId uint, mode string) error {
+	if templateUserId == 0 {
+		return ErrNoTemplate
+	}
+	if templateUserId == userId {
+		return nil
+	}
+
+	if mode == panelData.MODE_REPLACE {
+		if err := panelData.Clear(tx, userId); err != nil {
+			return err
+		}
+	}
+
+	if err := copyGroups(tx, templateUserId, userId); err != nil {
+		return err
+	}
+	if err := copyUserConfig(tx, templateUserId, userId); err != nil {
+		return err
+	}
+	return copyModuleConfig(tx, templateUserId, userId)
+}
+
+// 复制分组及图标，同名分组合并，分组内已存在相同地址的图标跳过
+func copyGroups(tx *gorm.DB, templateUserId, userId uint) error {
+	templateGroups := []models.ItemIconGroup{}
+	if err := tx.Order("sort ,created_at").Where("user_id=?", templateUserId).Find(&templateGroups).Error; err != nil {
+		return err
+	}
+	existGroups := []models.ItemIconGroup{}
+	if err := tx.Where("user_id=?", userId).Find(&existGroups).Error; err != nil {
+		return err
+	}
+	existGroupIds := map[string]uint{} // 标题 => 分组ID
+	for _, v := range existGroups {
+		existGroupIds[v.Title] = v.ID
+	}
+
+	for _, templateGroup := range templateGroups {
+		groupId, exist := existGroupIds[templateGroup.Title]
+		if !exist {
+			group := models.ItemIconGroup{
+				Icon:        templateGroup.Icon,
+				Title:       templateGroup.Title,
+				Description: templateGroup.Description,
+				Sort:        templateGroup.Sort,
+				UserId:      userId,
+			}
+			if err := tx.Create(&group).Error; err != nil {
+				return err
+			}
+			groupId = group.ID
+		}
+
+		templateItems := []models.ItemIcon{}
+		if err := tx.Order("sort ,created_at").Where("user_id=? AND item_icon_group_id=?", templateUserId, templateGroup.ID).Find(&templateItems).Error; err != nil {
+			return err
+		}
+		existUrls := map[string]bool{}
+		if exist {
+			urls := []string{}
+			if err := tx.Model(&models.ItemIcon{}).Where("user_id=? AND item_icon_group_id=?", userId, groupId).Pluck("url", &urls).Error; err != nil {
+				return err
+			}
+			for _, v := range urls {
+				existUrls[v] = true
+			}
+		}
+		for _, templateItem := range templateItems {
+			if existUrls[templateItem.Url] {
+				continue
+			}
+			item := models.ItemIcon{
+				IconJson:        templateItem.IconJson,
+				Title:           templateItem.Title,
+				Url:             templateItem.Url,
+				LanUrl:          templateItem.LanUrl,
+				Description:     templateItem.Description,
+				OpenMethod:      templateItem.OpenMethod,
+				Sort:            templateItem.Sort,
+				ItemIconGroupId: int(groupId),
+				UserId:          userId,
+			}
+			if err := tx.Create(&item).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 复制UserConfig，用户已有配置时保留
+func copyUserConfig(tx *gorm.DB, templateUserId, userId uint) error {
+	templateConfig := models.UserConfig{}
+	if err := tx.First(&templateConfig, "user_id=?", templateUserId).Error; err == gorm.ErrRecordNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := tx.First(&models.UserConfig{}, "user_id=?", userId).Error; err == nil {
+		return nil
+	} else if err != gorm.ErrRecordNotFound {
+		return err
+	}
+	return tx.Create(&models.UserConfig{
+		UserId:           userId,
+		PanelJson:        templateConfig.PanelJson,
+		SearchEngineJson: templateConfig.SearchEngineJson,
+	}).Error
+}
+
+// 复制ModuleConfig，用户已有的同名配置保留
+func copyModuleConfig(tx *gorm.DB, templateUserId, userId uint) error {
+	templateConfigs := []models.ModuleConfig{}
+	if err := tx.Where("user_id=?", templateUserId).Find(&templateConfigs).Error; err != nil {
+		return err
+	}
+	for _, v := range templateConfigs {
+		var count int64
+		if err := tx.Model(&models.ModuleConfig{}).Where("user_id=? AND name=?", userId, v.Name).Count(&count).Error; err != nil {
+			return err
+		} else if count > 0 {
+			continue
+		}
+		if err := tx.Create(&models.ModuleConfig{
+			UserId:    userId,
+			Name:      v.Name,
+			ValueJson: v.ValueJson,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
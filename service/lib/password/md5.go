@@ -0,0 +1,42 @@
+package password
+
+import (
+	"crypto/md5"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+)
+
+// 旧版密码：Md5(Md5(Md5(password)))
+// 只用于校验存量数据，登录成功后会被重新哈希为默认算法
+type legacyMd5 struct{}
+
+func (h *legacyMd5) Id() string {
+	return HASHER_MD5
+}
+
+func (h *legacyMd5) Hash(password string) (string, error) {
+	return "", errors.New("md5 hasher is verify only")
+}
+
+func (h *legacyMd5) Verify(password, encoded string) (bool, error) {
+	sum := md5Hex(md5Hex(md5Hex(password)))
+	return subtle.ConstantTimeCompare([]byte(sum), []byte(encoded)) == 1, nil
+}
+
+func (h *legacyMd5) Match(encoded string) bool {
+	if len(encoded) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(encoded)
+	return err == nil
+}
+
+func (h *legacyMd5) NeedsRehash(encoded string) bool {
+	return true
+}
+
+func md5Hex(str string) string {
+	b := md5.Sum([]byte(str))
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,117 @@
+package password
+
+import (
+	"errors"
+	"sync"
+)
+
+// 密码哈希器
+// 编码后的哈希需自描述（包含算法标识与参数），以便后续切换算法时仍能校验旧数据
+type Hasher interface {
+	// 算法标识，如 bcrypt、argon2id
+	Id() string
+
+	// 生成编码后的哈希
+	Hash(password string) (string, error)
+
+	// 校验明文与编码后的哈希是否匹配
+	Verify(password, encoded string) (bool, error)
+
+	// 判断编码后的哈希是否属于本算法
+	Match(encoded string) bool
+
+	// 哈希参数是否已过时（如 cost 低于当前配置），需要重新生成
+	NeedsRehash(encoded string) bool
+}
+
+const (
+	HASHER_BCRYPT   = "bcrypt"
+	HASHER_ARGON2ID = "argon2id"
+	HASHER_MD5      = "md5" // 旧版三次MD5，仅用于校验
+)
+
+var (
+	ErrUnknownHasher = errors.New("unknown password hasher")
+	ErrUnknownFormat = errors.New("unknown password hash format")
+)
+
+var (
+	mu            sync.RWMutex
+	hashers       = map[string]Hasher{}
+	defaultHasher Hasher
+)
+
+func init() {
+	Register(NewBcrypt(0))
+	Register(NewArgon2id(Argon2idParams{}))
+	Register(&legacyMd5{})
+	defaultHasher = hashers[HASHER_BCRYPT]
+}
+
+// 注册一个哈希器，已存在同名的将被替换
+func Register(h Hasher) {
+	mu.Lock()
+	defer mu.Unlock()
+	hashers[h.Id()] = h
+	if defaultHasher != nil && defaultHasher.Id() == h.Id() {
+		defaultHasher = h
+	}
+}
+
+// 设置生成新密码时使用的哈希器，为空时保持默认(bcrypt)
+func SetDefault(id string) error {
+	if id == "" {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	h, ok := hashers[id]
+	if !ok || id == HASHER_MD5 {
+		return ErrUnknownHasher
+	}
+	defaultHasher = h
+	return nil
+}
+
+// 获取当前默认的哈希器
+func Default() Hasher {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultHasher
+}
+
+// 使用默认哈希器生成密码哈希
+func Hash(password string) (string, error) {
+	return Default().Hash(password)
+}
+
+// 校验密码
+// ok：密码是否正确
+// needsRehash：密码正确但哈希算法或参数已过时，调用方应使用 Hash 重新生成并保存
+func Verify(password, encoded string) (ok bool, needsRehash bool) {
+	h := identify(encoded)
+	if h == nil {
+		return false, false
+	}
+	if match, err := h.Verify(password, encoded); err != nil || !match {
+		return false, false
+	}
+
+	def := Default()
+	if h.Id() != def.Id() {
+		return true, true
+	}
+	return true, h.NeedsRehash(encoded)
+}
+
+// 根据编码后的哈希识别算法
+func identify(encoded string) Hasher {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, h := range hashers {
+		if h.Match(encoded) {
+			return h
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package permission
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sun-panel/global"
+	"sun-panel/models"
+
+	"gorm.io/gorm"
+)
+
+// 角色权限，系统管理员角色始终拥有全部权限
+
+const (
+	MANAGE_SYSTEM = "manage_system" // 系统设置、角色、LDAP、反向代理认证
+	MANAGE_USERS  = "manage_users"  // 用户管理
+	MANAGE_SSO    = "manage_sso"    // SSO配置
+	UPLOAD_FILES  = "upload_files"  // 上传文件
+	EDIT_PANEL    = "edit_panel"    // 编辑自己的面板
+	VIEW_MONITOR  = "view_monitor"  // 查看系统监控
+)
+
+var Permissions = []string{MANAGE_SYSTEM, MANAGE_USERS, MANAGE_SSO, UPLOAD_FILES, EDIT_PANEL, VIEW_MONITOR}
+
+// 普通用户角色的默认权限
+var DefaultUserPermissions = []string{UPLOAD_FILES, EDIT_PANEL, VIEW_MONITOR}
+
+// 校验并整理权限，去重
+func Normalize(permissions []string) ([]string, error) {
+	res := []string{}
+	for _, v := range permissions {
+		v = strings.TrimSpace(v)
+		if !slices.Contains(Permissions, v) {
+			return nil, errors.New("invalid permission: " + v)
+		}
+		if !slices.Contains(res, v) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// 获取角色的权限列表
+func GetByRoleId(roleId int) []string {
+	if roleId == models.ROLE_ADMIN {
+		return Permissions
+	}
+	cacheKey := strconv.Itoa(roleId)
+	if v, ok := global.RolePermission.Get(cacheKey); ok {
+		return v
+	}
+
+	mRole := models.Role{}
+	permissions := []string{}
+	if role, err := mRole.GetInfo(uint(roleId)); err == nil {
+		// 忽略已移除的权限
+		for _, v := range role.GetPermissionList() {
+			if slices.Contains(Permissions, v) {
+				permissions = append(permissions, v)
+			}
+		}
+	}
+	global.RolePermission.SetDefault(cacheKey, permissions)
+	return permissions
+}
+
+// 角色是否拥有权限
+func Has(roleId int, permission string) bool {
+	return slices.Contains(GetByRoleId(roleId), permission)
+}
+
+// 角色是否可以管理目标角色（分配角色、修改或删除该角色的用户）
+// 需要系统管理权限，或拥有目标角色的全部权限
+func CanManageRole(roleId, targetRoleId int) bool {
+	if Has(roleId, MANAGE_SYSTEM) {
+		return true
+	}
+	own := GetByRoleId(roleId)
+	for _, v := range GetByRoleId(targetRoleId) {
+		if !slices.Contains(own, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// 角色修改或删除后清除缓存
+func ClearCache() {
+	global.RolePermission.Flush()
+}
+
+// 初始化内置角色（不存在时创建）
+func InitRoles() error {
+	roles := []models.Role{
+		{Name: "Administrator", Description: "All permissions", IsSystem: 1},
+		{Name: "User", Description: "Default role for new users", IsSystem: 1, Permissions: strings.Join(DefaultUserPermissions, ",")},
+	}
+	roles[0].ID = models.ROLE_ADMIN
+	roles[1].ID = models.ROLE_USER
+
+	for _, role := range roles {
+		exist := models.Role{}
+		err := global.Db.Unscoped().First(&exist, "id=?", role.ID).Error
+		if err == nil {
+			continue
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+		if err := global.Db.Create(&role).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
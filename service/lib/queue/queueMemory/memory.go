@@ -39,13 +39,11 @@ func (k *Pool) RPush(value ...interface{}) error {
 func (k *Pool) Delete(value interface{}) error {
 	k.Lock.Lock()
 	defer k.Lock.Unlock()
-	var index int64
 	v, _ := json.Marshal(value)
 
 	for i, item := range k.Values {
 		if reflect.DeepEqual(item, v) {
-			index = int64(i)
-			k.removeIndex(index)
+			k.removeIndex(int64(i))
 			return nil
 		}
 	}
@@ -57,7 +55,11 @@ func (k *Pool) Delete(value interface{}) error {
 func (k *Pool) GetByIndex(index int64, v interface{}) error {
 	k.Lock.RLock()
 	defer k.Lock.RUnlock()
-	if int64(len(k.Values)) >= index {
+	return k.getByIndex(index, v)
+}
+
+func (k *Pool) getByIndex(index int64, v interface{}) error {
+	if index >= 0 && index < int64(len(k.Values)) {
 		json.Unmarshal(k.Values[index], v)
 		return nil
 	} else {
@@ -67,7 +69,9 @@ func (k *Pool) GetByIndex(index int64, v interface{}) error {
 
 // 左-取出并删除
 func (k *Pool) LPop(v interface{}) error {
-	if err := k.GetByIndex(0, v); err != nil {
+	k.Lock.Lock()
+	defer k.Lock.Unlock()
+	if err := k.getByIndex(0, v); err != nil {
 		return err
 	} else {
 		k.removeIndex(0)
@@ -77,8 +81,10 @@ func (k *Pool) LPop(v interface{}) error {
 
 // 右-取出并删除
 func (k *Pool) RPop(v interface{}) error {
+	k.Lock.Lock()
+	defer k.Lock.Unlock()
 	index := int64(len(k.Values) - 1)
-	if err := k.GetByIndex(index, v); err != nil {
+	if err := k.getByIndex(index, v); err != nil {
 		return err
 	} else {
 		k.removeIndex(index)
@@ -86,14 +92,15 @@ func (k *Pool) RPop(v interface{}) error {
 	return nil
 }
 
+// 调用前需要持有写锁
 func (k *Pool) removeIndex(index int64) error {
-	k.Lock.Lock()
-	defer k.Lock.Unlock()
 	k.Values = append(k.Values[:index], k.Values[index+1:]...)
 	return nil
 }
 
 func (k *Pool) Length() (int64, error) {
+	k.Lock.RLock()
+	defer k.Lock.RUnlock()
 	return int64(len(k.Values)), nil
 }
 
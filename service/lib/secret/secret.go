@@ -0,0 +1,82 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// 敏感配置加密存储（AES-256-GCM）
+// 密文格式: enc:v1:base64(nonce+ciphertext)
+// 密钥来自 conf.ini [base] secret_key
+
+const prefix = "enc:v1:"
+
+var (
+	aead cipher.AEAD
+
+	ErrNoKey      = errors.New("secret key is not set")
+	ErrCiphertext = errors.New("invalid ciphertext")
+)
+
+// 设置密钥，任意长度，内部使用sha256派生
+func SetKey(key string) error {
+	if key == "" {
+		return ErrNoKey
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	aead = gcm
+	return nil
+}
+
+// 是否为加密后的内容
+func IsEncrypted(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// 加密，空字符串不加密
+func Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	if aead == nil {
+		return "", ErrNoKey
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return prefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// 解密，未加密的内容（旧数据）原样返回
+func Decrypt(s string) (string, error) {
+	if !IsEncrypted(s) {
+		return s, nil
+	}
+	if aead == nil {
+		return "", ErrNoKey
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, prefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", ErrCiphertext
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrCiphertext
+	}
+	return string(plain), nil
+}
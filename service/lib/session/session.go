@@ -0,0 +1,177 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sun-panel/global"
+	"sun-panel/lib/cmn"
+	"sun-panel/models"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// 登录会话
+// cToken 仅下发给客户端，缓存与数据库中只保存其sha256
+// 缓存 CUserToken: sha256(cToken) => 用户token(bToken)
+
+const (
+	SESSION_EXPIRATION = 72 * time.Hour  // 会话无活动的过期时长
+	LAST_SEEN_INTERVAL = 5 * time.Minute // 最后活跃时间的更新间隔
+
+	lastSeenCachePrefix = "session_last_seen_"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// 计算cToken的哈希
+func HashToken(cToken string) string {
+	sum := sha256.Sum256([]byte(cToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// 用户没有token(bToken)时生成并保存
+func EnsureUserToken(userInfo *models.User) error {
+	if userInfo.Token != "" {
+		return nil
+	}
+	mUser := models.User{}
+	for {
+		bToken := cmn.BuildSecureRandCode(32, cmn.RAND_CODE_MODE2)
+		if _, err := mUser.GetUserInfoByToken(bToken); err == nil {
+			continue
+		}
+		if err := mUser.UpdateUserInfoByUserId(userInfo.ID, map[string]interface{}{"token": bToken}); err != nil {
+			return err
+		}
+		userInfo.Token = bToken
+		return nil
+	}
+}
+
+// 创建会话，返回cToken
+// userInfo.Token 不能为空
+func Create(userInfo models.User, userAgent, ip string) (string, error) {
+	if userInfo.Token == "" {
+		return "", errors.New("user token is empty")
+	}
+	cToken := uuid.NewString() + "-" + cmn.Md5(cmn.Md5("userId"+strconv.Itoa(int(userInfo.ID))))
+	hash := HashToken(cToken)
+
+	record := models.UserSession{
+		UserId:     userInfo.ID,
+		TokenHash:  hash,
+		UserAgent:  cmn.SubRuneStr(userAgent, 0, 500),
+		Ip:         ip,
+		LastSeenAt: time.Now(),
+	}
+	if err := global.Db.Create(&record).Error; err != nil {
+		return "", err
+	}
+	global.CUserToken.SetDefault(hash, userInfo.Token)
+	global.VerifyCodeCachePool.Set(lastSeenCachePrefix+hash, "1", LAST_SEEN_INTERVAL)
+	return cToken, nil
+}
+
+// 根据cToken获取用户token
+// 缓存中不存在时从数据库恢复，会话已吊销或过期返回false
+func Get(cToken string) (string, bool) {
+	if cToken == "" {
+		return "", false
+	}
+	hash := HashToken(cToken)
+	if bToken, ok := global.CUserToken.Get(hash); ok && bToken != "" {
+		touch(hash)
+		return bToken, true
+	}
+
+	mSession := models.UserSession{}
+	record, err := mSession.GetByTokenHash(hash)
+	if err != nil {
+		return "", false
+	}
+	if time.Since(record.LastSeenAt) > SESSION_EXPIRATION {
+		global.Db.Unscoped().Delete(&record)
+		return "", false
+	}
+
+	mUser := models.User{}
+	userInfo, err := mUser.GetUserInfoByUid(record.UserId)
+	if err != nil || userInfo.Token == "" {
+		global.Db.Unscoped().Delete(&record)
+		return "", false
+	}
+
+	global.CUserToken.SetDefault(hash, userInfo.Token)
+	touch(hash)
+	return userInfo.Token, true
+}
+
+// 当前cToken对应的会话ID
+func GetSessionId(cToken string) uint {
+	mSession := models.UserSession{}
+	if record, err := mSession.GetByTokenHash(HashToken(cToken)); err == nil {
+		return record.ID
+	}
+	return 0
+}
+
+// 退出当前会话
+func Delete(cToken string) {
+	hash := HashToken(cToken)
+	global.CUserToken.Delete(hash)
+	global.Db.Unscoped().Delete(&models.UserSession{}, "token_hash=?", hash)
+}
+
+// 吊销用户的某个会话
+func Revoke(userId, sessionId uint) error {
+	record := models.UserSession{}
+	if err := global.Db.First(&record, "id=? AND user_id=?", sessionId, userId).Error; err != nil {
+		return ErrSessionNotFound
+	}
+	global.CUserToken.Delete(record.TokenHash)
+	return global.Db.Unscoped().Delete(&record).Error
+}
+
+// 吊销用户的全部会话
+func RevokeAll(userId uint) error {
+	mSession := models.UserSession{}
+	list, err := mSession.GetListByUserId(userId)
+	if err != nil {
+		return err
+	}
+	for _, v := range list {
+		global.CUserToken.Delete(v.TokenHash)
+	}
+	return mSession.DeleteByUserId(global.Db, userId)
+}
+
+// 退出全部设备：吊销全部会话并更换用户token，使遗留的凭证全部失效
+func RevokeAllAndRotate(userId uint) error {
+	mUser := models.User{}
+	userInfo, err := mUser.GetUserInfoByUid(userId)
+	if err != nil {
+		return err
+	}
+
+	newToken := cmn.BuildSecureRandCode(32, cmn.RAND_CODE_MODE2)
+	if err := mUser.UpdateUserInfoByUserId(userId, map[string]interface{}{"token": newToken}); err != nil {
+		return err
+	}
+	if userInfo.Token != "" {
+		global.UserToken.Delete(userInfo.Token)
+	}
+	return RevokeAll(userId)
+}
+
+// 间隔更新最后活跃时间，避免每次请求都写库
+func touch(hash string) {
+	if _, ok := global.VerifyCodeCachePool.Get(lastSeenCachePrefix + hash); ok {
+		return
+	}
+	global.VerifyCodeCachePool.Set(lastSeenCachePrefix+hash, "1", LAST_SEEN_INTERVAL)
+	mSession := models.UserSession{}
+	mSession.UpdateLastSeen(hash, time.Now())
+}
@@ -0,0 +1,190 @@
+package ssoSaml
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sun-panel/lib/secret"
+	"time"
+
+	"github.com/crewjam/saml"
+	xrv "github.com/mattermost/xml-roundtrip-validator"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+// SAML 2.0 服务提供方(SP)的辅助方法：密钥证书、IdP元数据解析
+
+// AuthnRequest 签名算法
+const SIGNATURE_METHOD = dsig.RSASHA256SignatureMethod
+
+// SP签名密钥与证书，私钥加密保存
+type KeyPair struct {
+	Key  string `json:"key"`  // 加密后的PKCS#1私钥PEM
+	Cert string `json:"cert"` // 证书PEM
+}
+
+// 生成新的SP密钥与自签名证书（有效期10年）
+func GenerateKeyPair(commonName string) (KeyPair, error) {
+	keyPair := KeyPair{}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return keyPair, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return keyPair, err
+	}
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return keyPair, err
+	}
+
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if keyPair.Key, err = secret.Encrypt(string(keyPem)); err != nil {
+		return keyPair, err
+	}
+	keyPair.Cert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	return keyPair, nil
+}
+
+// 解析密钥与证书
+func (k KeyPair) Parse() (*rsa.PrivateKey, *x509.Certificate, error) {
+	keyPem, err := secret.Decrypt(k.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBlock, _ := pem.Decode([]byte(keyPem))
+	certBlock, _ := pem.Decode([]byte(k.Cert))
+	if keyBlock == nil || certBlock == nil {
+		return nil, nil, errors.New("invalid saml key pair")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, cert, nil
+}
+
+// 创建SP实例（不含IdP元数据），siteUrl 为对外访问地址，entityId 为空时使用SP元数据地址
+func NewServiceProvider(keyPair KeyPair, siteUrl, provider, entityId string) (*saml.ServiceProvider, error) {
+	key, cert, err := keyPair.Parse()
+	if err != nil {
+		return nil, err
+	}
+	metadataUrl, err := url.Parse(siteUrl + "/api/system/sso/saml/metadata/" + provider)
+	if err != nil {
+		return nil, err
+	}
+	acsUrl, err := url.Parse(siteUrl + "/api/system/sso/saml/acs/" + provider)
+	if err != nil {
+		return nil, err
+	}
+	return &saml.ServiceProvider{
+		EntityID:          entityId,
+		Key:               key,
+		Certificate:       cert,
+		MetadataURL:       *metadataUrl,
+		AcsURL:            *acsUrl,
+		AuthnNameIDFormat: saml.UnspecifiedNameIDFormat,
+		SignatureMethod:   SIGNATURE_METHOD,
+	}, nil
+}
+
+// 是否为元数据地址
+func IsMetadataUrl(metadata string) bool {
+	metadata = strings.TrimSpace(metadata)
+	return strings.HasPrefix(metadata, "http://") || strings.HasPrefix(metadata, "https://")
+}
+
+// 下载IdP元数据
+func FetchMetadata(ctx context.Context, metadataUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(metadataUrl), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("fetch metadata failed: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 5<<20))
+}
+
+// 解析IdP元数据，兼容 EntitiesDescriptor 包裹的情况
+func ParseMetadata(data []byte) (*saml.EntityDescriptor, error) {
+	if err := xrv.Validate(bytes.NewBuffer(data)); err != nil {
+		return nil, err
+	}
+
+	entity := &saml.EntityDescriptor{}
+	err := xml.Unmarshal(data, entity)
+	if err != nil && strings.Contains(err.Error(), "EntitiesDescriptor") {
+		entities := &saml.EntitiesDescriptor{}
+		if err := xml.Unmarshal(data, entities); err != nil {
+			return nil, err
+		}
+		for i, e := range entities.EntityDescriptors {
+			if len(e.IDPSSODescriptors) > 0 {
+				return &entities.EntityDescriptors[i], nil
+			}
+		}
+		return nil, errors.New("no entity found with IDPSSODescriptor")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entity.IDPSSODescriptors) == 0 {
+		return nil, errors.New("metadata has no IDPSSODescriptor")
+	}
+	return entity, nil
+}
+
+// 断言中的全部属性，Name 与 FriendlyName 均作为键，值为字符串列表
+func GetAttributes(assertion *saml.Assertion) map[string]interface{} {
+	res := map[string]interface{}{}
+	for _, statement := range assertion.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			values := []interface{}{}
+			for _, v := range attr.Values {
+				values = append(values, v.Value)
+			}
+			for _, key := range []string{attr.Name, attr.FriendlyName} {
+				if key == "" {
+					continue
+				}
+				if exist, ok := res[key].([]interface{}); ok {
+					res[key] = append(exist, values...)
+				} else {
+					res[key] = values
+				}
+			}
+		}
+	}
+	return res
+}
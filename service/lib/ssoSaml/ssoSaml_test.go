@@ -0,0 +1,263 @@
+package ssoSaml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sun-panel/lib/secret"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+)
+
+// 本地测试IdP，只认识一个SP
+type testIdp struct {
+	idp *saml.IdentityProvider
+	sp  *saml.ServiceProvider
+}
+
+func (t *testIdp) GetServiceProvider(r *http.Request, serviceProviderID string) (*saml.EntityDescriptor, error) {
+	if serviceProviderID != t.sp.EntityID && serviceProviderID != t.sp.MetadataURL.String() {
+		return nil, os.ErrNotExist
+	}
+	return t.sp.Metadata(), nil
+}
+
+func newTestIdp(t *testing.T, sp *saml.ServiceProvider) *testIdp {
+	t.Helper()
+	keyPair, err := GenerateKeyPair("test-idp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, cert, err := keyPair.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataUrl, _ := url.Parse("https://idp.example.org/metadata")
+	ssoUrl, _ := url.Parse("https://idp.example.org/sso")
+	res := &testIdp{sp: sp}
+	res.idp = &saml.IdentityProvider{
+		Key:                     key,
+		Certificate:             cert,
+		MetadataURL:             *metadataUrl,
+		SSOURL:                  *ssoUrl,
+		ServiceProviderProvider: res,
+	}
+	return res
+}
+
+// IdP元数据XML
+func (t *testIdp) metadata(tb testing.TB) []byte {
+	tb.Helper()
+	data, err := xml.Marshal(t.idp.Metadata())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// 处理SP重定向过来的登录请求，返回以HTTP-POST方式提交到ACS的请求
+func (t *testIdp) login(tb testing.TB, redirectUrl *url.URL, session *saml.Session) *http.Request {
+	tb.Helper()
+	req, err := saml.NewIdpAuthnRequest(t.idp, httptest.NewRequest(http.MethodGet, redirectUrl.String(), nil))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if err := req.Validate(); err != nil {
+		tb.Fatal(err)
+	}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		tb.Fatal(err)
+	}
+	if err := req.MakeResponse(); err != nil {
+		tb.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	values := url.Values{"SAMLResponse": {form.SAMLResponse}, "RelayState": {form.RelayState}}
+	acs := httptest.NewRequest(http.MethodPost, form.URL, strings.NewReader(values.Encode()))
+	acs.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// 与 ACS 接口一致，解析表单后再校验
+	acs.ParseForm()
+	return acs
+}
+
+func newTestServiceProvider(t *testing.T) *saml.ServiceProvider {
+	t.Helper()
+	if err := secret.SetKey("saml-test"); err != nil {
+		t.Fatal(err)
+	}
+	keyPair, err := GenerateKeyPair("sun-panel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !secret.IsEncrypted(keyPair.Key) {
+		t.Fatal("the SP private key should be stored encrypted")
+	}
+	sp, err := NewServiceProvider(keyPair, "https://panel.example.org", "saml", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sp
+}
+
+// 发起SP登录，返回请求ID和重定向到IdP的地址
+func startLogin(t *testing.T, sp *saml.ServiceProvider) (string, *url.URL) {
+	t.Helper()
+	authnRequest, err := sp.MakeAuthenticationRequest(sp.GetSSOBindingLocation(saml.HTTPRedirectBinding), saml.HTTPRedirectBinding, saml.HTTPPostBinding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectUrl, err := authnRequest.Redirect("relay-state", sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authnRequest.ID, redirectUrl
+}
+
+func testSession() *saml.Session {
+	return &saml.Session{
+		ID:             "session-1",
+		CreateTime:     saml.TimeNow(),
+		ExpireTime:     saml.TimeNow().Add(time.Hour),
+		NameID:         "alice",
+		UserName:       "alice",
+		UserEmail:      "alice@example.org",
+		UserCommonName: "Alice",
+		Groups:         []string{"admins", "users"},
+	}
+}
+
+func TestLogin(t *testing.T) {
+	sp := newTestServiceProvider(t)
+	idp := newTestIdp(t, sp)
+	var err error
+	if sp.IDPMetadata, err = ParseMetadata(idp.metadata(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	requestId, redirectUrl := startLogin(t, sp)
+	if !strings.HasPrefix(redirectUrl.String(), "https://idp.example.org/sso?") {
+		t.Errorf("redirect url = %s, want the IdP SSO url", redirectUrl)
+	}
+	query := redirectUrl.Query()
+	if query.Get("Signature") == "" || query.Get("SigAlg") != SIGNATURE_METHOD {
+		t.Errorf("AuthnRequest should be signed with %s, got SigAlg %q", SIGNATURE_METHOD, query.Get("SigAlg"))
+	}
+	if query.Get("RelayState") != "relay-state" {
+		t.Errorf("RelayState = %q, want relay-state", query.Get("RelayState"))
+	}
+
+	acs := idp.login(t, redirectUrl, testSession())
+	assertion, err := sp.ParseResponse(acs, []string{requestId})
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	if assertion.Subject == nil || assertion.Subject.NameID == nil || assertion.Subject.NameID.Value != "alice" {
+		t.Errorf("NameID = %+v, want alice", assertion.Subject)
+	}
+
+	// Name 与 FriendlyName 均可作为键
+	attrs := GetAttributes(assertion)
+	if v, _ := attrs["eduPersonPrincipalName"].([]interface{}); len(v) != 1 || v[0] != "alice@example.org" {
+		t.Errorf("eduPersonPrincipalName attribute = %v, want [alice@example.org]", attrs["eduPersonPrincipalName"])
+	}
+	if v, _ := attrs["urn:oid:2.5.4.3"].([]interface{}); len(v) != 1 || v[0] != "Alice" {
+		t.Errorf("cn attribute = %v, want [Alice]", attrs["urn:oid:2.5.4.3"])
+	}
+	if v, _ := attrs["eduPersonAffiliation"].([]interface{}); len(v) != 2 {
+		t.Errorf("groups attribute = %v, want two groups", attrs["eduPersonAffiliation"])
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	sp := newTestServiceProvider(t)
+	idp := newTestIdp(t, sp)
+	var err error
+	if sp.IDPMetadata, err = ParseMetadata(idp.metadata(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	// 响应不属于本次登录请求（重放或伪造的IdP发起登录）
+	_, redirectUrl := startLogin(t, sp)
+	if _, err := sp.ParseResponse(idp.login(t, redirectUrl, testSession()), []string{"other-request"}); err == nil {
+		t.Error("ParseResponse() should reject a response for another request")
+	}
+
+	// 使用其他密钥签名的响应
+	otherIdp := newTestIdp(t, sp)
+	requestId, redirectUrl := startLogin(t, sp)
+	if _, err := sp.ParseResponse(otherIdp.login(t, redirectUrl, testSession()), []string{requestId}); err == nil {
+		t.Error("ParseResponse() should reject a response signed by an unknown key")
+	}
+
+	// 篡改的响应
+	requestId, redirectUrl = startLogin(t, sp)
+	acs := idp.login(t, redirectUrl, testSession())
+	response, _ := base64.StdEncoding.DecodeString(acs.PostForm.Get("SAMLResponse"))
+	// 断言已加密，修改密文
+	i := bytes.Index(response, []byte("CipherValue>"))
+	if i < 0 {
+		t.Fatal("assertion should be encrypted")
+	}
+	i += len("CipherValue>") + 10
+	if response[i] == 'A' {
+		response[i] = 'B'
+	} else {
+		response[i] = 'A'
+	}
+	acs.PostForm.Set("SAMLResponse", base64.StdEncoding.EncodeToString(response))
+	if _, err := sp.ParseResponse(acs, []string{requestId}); err == nil {
+		t.Error("ParseResponse() should reject a tampered response")
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	sp := newTestServiceProvider(t)
+	idp := newTestIdp(t, sp)
+	metadata := idp.metadata(t)
+
+	entity, err := ParseMetadata(metadata)
+	if err != nil || entity.EntityID != "https://idp.example.org/metadata" {
+		t.Fatalf("ParseMetadata() = %v, %v", entity, err)
+	}
+
+	wrapped := []byte(`<EntitiesDescriptor xmlns="urn:oasis:names:tc:SAML:2.0:metadata">` + string(metadata) + `</EntitiesDescriptor>`)
+	if entity, err := ParseMetadata(wrapped); err != nil || entity.EntityID != "https://idp.example.org/metadata" {
+		t.Errorf("ParseMetadata(EntitiesDescriptor) = %v, %v", entity, err)
+	}
+
+	spMetadata, _ := xml.Marshal(sp.Metadata())
+	if _, err := ParseMetadata(spMetadata); err == nil {
+		t.Error("ParseMetadata() should reject metadata without IDPSSODescriptor")
+	}
+	if _, err := ParseMetadata([]byte("not xml")); err == nil {
+		t.Error("ParseMetadata() should reject invalid xml")
+	}
+}
+
+func TestIsMetadataUrl(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"https://idp.example.org/metadata", true},
+		{" http://idp/metadata", true},
+		{"<EntityDescriptor/>", false},
+		{"ftp://idp/metadata", false},
+	}
+	for _, tt := range tests {
+		if got := IsMetadataUrl(tt.in); got != tt.want {
+			t.Errorf("IsMetadataUrl(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"image/png"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+	pTotp "github.com/pquerna/otp/totp"
+)
+
+const (
+	RECOVERY_CODE_COUNT  = 10 // 恢复码数量
+	RECOVERY_CODE_LENGTH = 10 // 恢复码长度
+
+	recoveryCodeChars = "abcdefghjkmnpqrstuvwxyz23456789" // 去除易混淆字符
+)
+
+type Key struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`    // otpauth:// 配置链接
+	QrCode string `json:"qrCode"` // 二维码 data:image/png;base64
+}
+
+// 生成一个新的密钥
+func GenerateKey(issuer, accountName string) (Key, error) {
+	k, err := pTotp.Generate(pTotp.GenerateOpts{
+		Issuer:      issuer,
+		AccountName: accountName,
+	})
+	if err != nil {
+		return Key{}, err
+	}
+
+	key := Key{
+		Secret: k.Secret(),
+		Uri:    k.URL(),
+	}
+	if img, err := k.Image(200, 200); err == nil {
+		buf := bytes.Buffer{}
+		if png.Encode(&buf, img) == nil {
+			key.QrCode = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+		}
+	}
+	return key, nil
+}
+
+// 验证动态码，允许前后各一个周期的时间偏差
+func Validate(code, secret string) bool {
+	ok, _ := pTotp.ValidateCustom(strings.TrimSpace(code), secret, time.Now(), pTotp.ValidateOpts{
+		Period:    30,
+		Skew:      1,
+		Digits:    otp.DigitsSix,
+		Algorithm: otp.AlgorithmSHA1,
+	})
+	return ok
+}
+
+// 生成一组恢复码，返回明文（仅展示一次）和用于保存的哈希
+func GenerateRecoveryCodes() (codes []string, hashes []string, err error) {
+	for i := 0; i < RECOVERY_CODE_COUNT; i++ {
+		b := make([]byte, RECOVERY_CODE_LENGTH)
+		if _, err = rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		for k := range b {
+			b[k] = recoveryCodeChars[int(b[k])%len(recoveryCodeChars)]
+		}
+		code := string(b[:5]) + "-" + string(b[5:])
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return
+}
+
+// 使用恢复码，成功返回剩余的恢复码哈希
+func UseRecoveryCode(code string, hashes []string) (remaining []string, ok bool) {
+	h := hashRecoveryCode(code)
+	remaining = make([]string, 0, len(hashes))
+	for i, v := range hashes {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(h)) == 1 {
+			remaining = append(remaining, hashes[:i]...)
+			remaining = append(remaining, hashes[i+1:]...)
+			return remaining, true
+		}
+	}
+	return hashes, false
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
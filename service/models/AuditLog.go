@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// AuditLog 审计日志，只追加，仅按保留期限清理
+type AuditLog struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"createTime"`
+	ActorId    uint      `gorm:"index;type:int(11)" json:"actorId"`  // 操作人，0为未登录
+	ActorName  string    `gorm:"type:varchar(255)" json:"actorName"` // 操作人账号，登录失败时为尝试的账号
+	Action     string    `gorm:"index;type:varchar(50)" json:"action"`
+	TargetType string    `gorm:"type:varchar(50)" json:"targetType"`
+	TargetId   string    `gorm:"type:varchar(100)" json:"targetId"`
+	Ip         string    `gorm:"type:varchar(50)" json:"ip"`
+	UserAgent  string    `gorm:"type:varchar(255)" json:"userAgent"`
+	Diff       string    `gorm:"type:text" json:"diff"` // 变更内容JSON：{"字段":{"old":..,"new":..}}
+}
+
+// Create 写入日志
+func (m *AuditLog) Create() error {
+	return Db.Create(m).Error
+}
+
+// DeleteBefore 清理指定时间之前的日志
+func (m *AuditLog) DeleteBefore(t time.Time) (int64, error) {
+	res := Db.Where("created_at < ?", t).Delete(&AuditLog{})
+	return res.RowsAffected, res.Error
+}
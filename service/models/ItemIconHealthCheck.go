@@ -0,0 +1,67 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 健康检查类型
+const (
+	HEALTH_CHECK_TYPE_HTTP    = "http"    // HTTP 状态码
+	HEALTH_CHECK_TYPE_KEYWORD = "keyword" // HTTP 状态码且响应内容包含关键字
+	HEALTH_CHECK_TYPE_TCP     = "tcp"     // TCP 连接
+	HEALTH_CHECK_TYPE_PING    = "ping"    // 无 ICMP 权限时的替代：依次尝试连接地址的端口、443、80
+)
+
+// 健康状态
+const (
+	HEALTH_STATUS_UNKNOWN = iota
+	HEALTH_STATUS_UP
+	HEALTH_STATUS_DOWN
+)
+
+// 图标的健康检查配置及最近一次结果
+type ItemIconHealthCheck struct {
+	BaseModel
+	ItemIconId     uint   `gorm:"uniqueIndex" json:"itemIconId"`
+	UserId         uint   `gorm:"index" json:"userId"` // 图标所有者
+	ConfigUserId   uint   `json:"-"`                   // 最后配置检查或修改图标的用户，按其角色决定是否限制可检查的地址
+	Enabled        int    `gorm:"type:tinyint(1);default:0" json:"enabled"`
+	Type           string `gorm:"type:varchar(20)" json:"type"`
+	UseLanUrl      int    `gorm:"type:tinyint(1);default:0" json:"useLanUrl"` // 检查内网地址
+	Target         string `gorm:"type:varchar(1000)" json:"target"`           // 为空时使用图标地址，TCP 可填写 host:port
+	Keyword        string `gorm:"type:varchar(255)" json:"keyword"`
+	ExpectedStatus string `gorm:"type:varchar(255)" json:"expectedStatus"` // 如 200,301-399，为空时为 200-399
+	CheckInterval  int    `json:"checkInterval"`                           // 检查间隔（秒）
+	Timeout        int    `json:"timeout"`                                 // 超时（秒）
+
+	Status        int        `gorm:"type:tinyint(1);default:0" json:"status"` // 见 HEALTH_STATUS_*
+	ResponseTime  int64      `json:"responseTime"`                            // 响应时间（毫秒）
+	Message       string     `gorm:"type:varchar(255)" json:"message"`
+	LastCheckTime *time.Time `json:"lastCheckTime"`
+	NextCheckTime *time.Time `gorm:"index" json:"-"`
+}
+
+// 获取图标的健康检查，图标ID => 健康检查
+func (m *ItemIconHealthCheck) GetMapByItemIconIds(db *gorm.DB, itemIconIds []uint) (map[uint]ItemIconHealthCheck, error) {
+	list := []ItemIconHealthCheck{}
+	res := map[uint]ItemIconHealthCheck{}
+	if len(itemIconIds) == 0 {
+		return res, nil
+	}
+	if err := db.Find(&list, "item_icon_id in ?", itemIconIds).Error; err != nil {
+		return nil, err
+	}
+	for _, v := range list {
+		res[v.ItemIconId] = v
+	}
+	return res, nil
+}
+
+func (m *ItemIconHealthCheck) DeleteByItemIconIds(db *gorm.DB, itemIconIds []uint) error {
+	if len(itemIconIds) == 0 {
+		return nil
+	}
+	return db.Unscoped().Delete(&ItemIconHealthCheck{}, "item_icon_id in ?", itemIconIds).Error
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 健康检查历史的精度（秒），0为原始记录
+const (
+	HEALTH_HISTORY_RAW      = 0
+	HEALTH_HISTORY_5MINUTES = 300
+	HEALTH_HISTORY_HOUR     = 3600
+)
+
+// 健康检查历史，原始记录定期汇总为5分钟、1小时的记录
+// 响应时间只统计在线的检查，原始记录的百分位数等于响应时间
+type ItemIconHealthHistory struct {
+	ID           uint      `gorm:"primarykey" json:"-"`
+	ItemIconId   uint      `gorm:"index:idx_health_history_item" json:"itemIconId"`
+	Resolution   int       `gorm:"index:idx_health_history_item" json:"resolution"` // 见 HEALTH_HISTORY_*
+	Time         time.Time `gorm:"index:idx_health_history_item;index" json:"time"` // 检查时间或汇总区间的开始时间
+	Count        int       `json:"count"`
+	UpCount      int       `json:"upCount"`
+	ResponseTime int64     `json:"responseTime"` // 平均响应时间（毫秒）
+	P50          int64     `json:"p50"`
+	P95          int64     `json:"p95"`
+	P99          int64     `json:"p99"`
+	Max          int64     `json:"max"`
+}
+
+func (m *ItemIconHealthHistory) DeleteByItemIconIds(db *gorm.DB, itemIconIds []uint) error {
+	if len(itemIconIds) == 0 {
+		return nil
+	}
+	return db.Delete(&ItemIconHealthHistory{}, "item_icon_id in ?", itemIconIds).Error
+}
@@ -0,0 +1,40 @@
+package models
+
+import "strings"
+
+// 内置角色，用户表的Role字段为角色ID
+const (
+	ROLE_ADMIN = 1 // 系统管理员，拥有全部权限
+	ROLE_USER  = 2 // 普通用户
+)
+
+// Role 角色表
+type Role struct {
+	BaseModel
+	Name        string `gorm:"type:varchar(50)" json:"name"`
+	Description string `gorm:"type:varchar(255)" json:"description"`
+	Permissions string `gorm:"type:text" json:"-"`              // 权限，以逗号分隔，见 lib/permission
+	IsSystem    int    `gorm:"type:tinyint(1)" json:"isSystem"` // 1.内置角色，不可删除
+}
+
+// GetPermissionList 权限列表
+func (m *Role) GetPermissionList() []string {
+	if m.Permissions == "" {
+		return []string{}
+	}
+	return strings.Split(m.Permissions, ",")
+}
+
+// GetInfo 根据ID查询角色
+func (m *Role) GetInfo(id uint) (Role, error) {
+	info := Role{}
+	err := Db.First(&info, "id=?", id).Error
+	return info, err
+}
+
+// CountUsers 使用该角色的用户数量
+func (m *Role) CountUsers(id uint) (int64, error) {
+	var count int64
+	err := Db.Model(&User{}).Where("role=?", id).Count(&count).Error
+	return count, err
+}
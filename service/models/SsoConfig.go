@@ -1,5 +1,11 @@
 package models
 
+import (
+	"encoding/json"
+	"strings"
+	"sun-panel/lib/secret"
+)
+
 // SsoConfig SSO配置表
 type SsoConfig struct {
 	BaseModel
@@ -7,10 +13,27 @@ type SsoConfig struct {
 	Enabled      int    `gorm:"type:tinyint(1);default:0" json:"enabled"`                         // 1.启用 0.停用
 	Name         string `gorm:"type:varchar(50)" json:"name"`                                     // Display name
 	ClientId     string `gorm:"type:varchar(255)" json:"clientId"`
-	ClientSecret string `gorm:"type:varchar(255)" json:"clientSecret"`
-	IssuerUrl    string `gorm:"type:varchar(255)" json:"issuerUrl"` // For OIDC
-	SamlMetadata string `gorm:"type:text" json:"samlMetadata"`      // For SAML metadata URL or XML
-	Ext          string `gorm:"type:text" json:"ext"`               // Extended config JSON
+	ClientSecret string `gorm:"type:varchar(512)" json:"clientSecret"` // 加密存储，见 lib/secret
+	IssuerUrl    string `gorm:"type:varchar(255)" json:"issuerUrl"`    // For OIDC
+	SamlMetadata string `gorm:"type:text" json:"samlMetadata"`         // For SAML metadata URL or XML
+	Ext          string `gorm:"type:text" json:"ext"`                  // Extended config JSON, see SsoConfigExt
+}
+
+// SsoConfigExt 扩展配置：用户属性映射与自动创建策略
+// Claim* 为claim路径，多级使用"."分隔，如 realm_access.roles；为空时使用各提供商的默认值
+type SsoConfigExt struct {
+	BaseUrl        string   `json:"baseUrl"`        // 对外访问地址，用于生成回调地址，为空时使用系统设置的站点地址
+	AutoRegister   bool     `json:"autoRegister"`   // 允许自动创建未绑定的用户
+	AllowedDomains []string `json:"allowedDomains"` // 允许的邮箱域名，为空不限制
+	LinkByEmail    bool     `json:"linkByEmail"`    // 通过已验证的邮箱关联已存在的本地用户
+	TrustEmail     bool     `json:"trustEmail"`     // SAML：信任IdP提供的邮箱（视为已验证），IdP允许用户自行修改邮箱时不要开启
+	ClaimUsername  string   `json:"claimUsername"`
+	ClaimName      string   `json:"claimName"`
+	ClaimEmail     string   `json:"claimEmail"`
+	ClaimAvatar    string   `json:"claimAvatar"`
+	ClaimGroups    string   `json:"claimGroups"`
+	AdminGroups    []string `json:"adminGroups"` // 属于其中任一组为管理员
+	UserGroups     []string `json:"userGroups"`  // 属于其中任一组为普通用户；配置后不属于任何映射组的用户将被拒绝登录
 }
 
 // GetEnabledProviders 获取所有启用的SSO提供商配置
@@ -26,3 +49,55 @@ func (m *SsoConfig) GetByProvider(provider string) (*SsoConfig, error) {
 	err := Db.Where("provider = ?", provider).First(&config).Error
 	return &config, err
 }
+
+// IsSaml 是否为SAML提供商
+func (m *SsoConfig) IsSaml() bool {
+	return m.Provider == "saml" || m.SamlMetadata != ""
+}
+
+// GetExt 解析扩展配置，Ext为空时返回默认配置（允许自动创建用户）
+func (m *SsoConfig) GetExt() (SsoConfigExt, error) {
+	ext := SsoConfigExt{
+		AutoRegister: true,
+	}
+	if strings.TrimSpace(m.Ext) == "" {
+		return ext, nil
+	}
+	err := json.Unmarshal([]byte(m.Ext), &ext)
+	return ext, err
+}
+
+// GetClientSecret 获取解密后的ClientSecret
+func (m *SsoConfig) GetClientSecret() (string, error) {
+	return secret.Decrypt(m.ClientSecret)
+}
+
+// SetClientSecret 加密后设置ClientSecret
+func (m *SsoConfig) SetClientSecret(plain string) error {
+	encrypted, err := secret.Encrypt(plain)
+	if err != nil {
+		return err
+	}
+	m.ClientSecret = encrypted
+	return nil
+}
+
+// EncryptPlainSecrets 将旧的明文ClientSecret加密保存
+func (m *SsoConfig) EncryptPlainSecrets() error {
+	var configs []SsoConfig
+	if err := Db.Find(&configs).Error; err != nil {
+		return err
+	}
+	for _, v := range configs {
+		if v.ClientSecret == "" || secret.IsEncrypted(v.ClientSecret) {
+			continue
+		}
+		if err := v.SetClientSecret(v.ClientSecret); err != nil {
+			return err
+		}
+		if err := Db.Model(&SsoConfig{}).Where("id=?", v.ID).Update("client_secret", v.ClientSecret).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
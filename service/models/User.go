@@ -2,19 +2,22 @@ package models
 
 import (
 	"errors"
+	"sun-panel/lib/password"
+
+	"gorm.io/gorm"
 )
 
 // 用户表
 type User struct {
 	BaseModel
-	Username     string `gorm:"index:;index:idx_username_password,priority:1;type:varchar(50)" json:"username" validate:"required"` // 账号
-	Password     string `gorm:"index:idx_username_password;type:varchar(32)" json:"password" validate:"required"`                   // 密码
-	Name         string `gorm:"type:varchar(20)" json:"name"`                                                                       // 名称
-	HeadImage    string `gorm:"type:varchar(200)" json:"headImage"`                                                                 // 头像地址
-	Status       int    `gorm:"type:tinyint(1)" json:"status"`                                                                      // 状态 1.启用 2.停用 3.未激活
-	Role         int    `gorm:"type:int(11)" json:"role"`                                                                           // 角色 1.管理员 2.普通用户
-	Mail         string `gorm:"type:varchar(50)" json:"mail"`                                                                       // 邮箱
-	ReferralCode string `gorm:"type:varchar(10)" json:"referralCode"`                                                               // 推荐码
+	Username     string `gorm:"index:;type:varchar(50)" json:"username" validate:"required"` // 账号
+	Password     string `gorm:"type:varchar(255)" json:"password" validate:"required"`       // 密码（自描述的哈希，见 lib/password）
+	Name         string `gorm:"type:varchar(20)" json:"name"`                                // 名称
+	HeadImage    string `gorm:"type:varchar(200)" json:"headImage"`                          // 头像地址
+	Status       int    `gorm:"type:tinyint(1)" json:"status"`                               // 状态 1.启用 2.停用 3.未激活
+	Role         int    `gorm:"type:int(11)" json:"role"`                                    // 角色ID，见 models.Role
+	Mail         string `gorm:"type:varchar(50)" json:"mail"`                                // 邮箱
+	ReferralCode string `gorm:"type:varchar(10)" json:"referralCode"`                        // 推荐码
 	Token        string `gorm:"type:varchar(32)" json:"token"`
 
 	UserId uint `gorm:"-"  json:"userId"`
@@ -28,10 +31,27 @@ func (m *User) GetUserInfoByUid(uid uint) (User, error) {
 }
 
 // 根据用户名和密码查询用户
-func (m *User) GetUserInfoByUsernameAndPassword(username, password string) (User, error) {
+// password 为明文，密码错误时返回 gorm.ErrRecordNotFound
+// 旧算法（如三次MD5）的密码校验通过后会自动重新哈希保存
+func (m *User) GetUserInfoByUsernameAndPassword(username, plainPassword string) (User, error) {
 	userInfo := User{}
-	err := Db.Where("username=?", username).Where("password=?", password).First(&userInfo).Error
-	return userInfo, err
+	if err := Db.Where("username=?", username).First(&userInfo).Error; err != nil {
+		return userInfo, err
+	}
+
+	ok, needsRehash := password.Verify(plainPassword, userInfo.Password)
+	if !ok {
+		return User{}, gorm.ErrRecordNotFound
+	}
+
+	if needsRehash {
+		if encoded, err := password.Hash(plainPassword); err == nil {
+			if err := Db.Model(&User{}).Where("id=?", userInfo.ID).Update("password", encoded).Error; err == nil {
+				userInfo.Password = encoded
+			}
+		}
+	}
+	return userInfo, nil
 }
 
 // 根据用户名查询用户
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserApiToken 用户的API令牌
+type UserApiToken struct {
+	BaseModel
+	UserId     uint       `gorm:"index;type:int(11)" json:"userId"`
+	Name       string     `gorm:"type:varchar(50)" json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex;type:varchar(64)" json:"-"` // 令牌的sha256，不保存明文
+	TokenTail  string     `gorm:"type:varchar(10)" json:"tokenTail"`     // 令牌末尾几位，用于识别
+	Scopes     string     `gorm:"type:varchar(255)" json:"-"`            // 以逗号分隔
+	ExpiresAt  *time.Time `json:"expiresAt"`                             // 为空不过期
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+}
+
+// GetByTokenHash 根据令牌哈希查询
+func (m *UserApiToken) GetByTokenHash(tokenHash string) (UserApiToken, error) {
+	info := UserApiToken{}
+	err := Db.Where("token_hash=?", tokenHash).First(&info).Error
+	return info, err
+}
+
+// GetListByUserId 获取用户的令牌列表，最新的在前
+func (m *UserApiToken) GetListByUserId(userId uint) ([]UserApiToken, error) {
+	list := []UserApiToken{}
+	err := Db.Order("id desc").Where("user_id=?", userId).Find(&list).Error
+	return list, err
+}
+
+// UpdateLastUsed 更新最后使用时间
+func (m *UserApiToken) UpdateLastUsed(id uint, t time.Time) error {
+	return Db.Model(&UserApiToken{}).Where("id=?", id).Update("last_used_at", t).Error
+}
+
+// DeleteByUserId 删除用户的全部令牌
+func (m *UserApiToken) DeleteByUserId(db *gorm.DB, userId uint) error {
+	return db.Unscoped().Delete(&UserApiToken{}, "user_id=?", userId).Error
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserPasskey 用户通行密钥(WebAuthn)表
+type UserPasskey struct {
+	BaseModel
+	UserId         uint       `gorm:"index;type:int(11)" json:"userId"`
+	Name           string     `gorm:"type:varchar(50)" json:"name"`           // 用户自定义的名称
+	CredentialId   string     `gorm:"uniqueIndex;type:varchar(255)" json:"-"` // base64url编码的凭证ID
+	CredentialJson string     `gorm:"type:text" json:"-"`                     // 序列化后的凭证（公钥、签名计数等）
+	LastUsedAt     *time.Time `json:"lastUsedAt"`                             // 最后使用时间
+}
+
+// GetListByUserId 获取用户的通行密钥列表
+func (m *UserPasskey) GetListByUserId(userId uint) ([]UserPasskey, error) {
+	list := []UserPasskey{}
+	err := Db.Order("created_at").Where("user_id=?", userId).Find(&list).Error
+	return list, err
+}
+
+// GetByCredentialId 根据凭证ID查询
+func (m *UserPasskey) GetByCredentialId(credentialId string) (UserPasskey, error) {
+	info := UserPasskey{}
+	err := Db.Where("credential_id=?", credentialId).First(&info).Error
+	return info, err
+}
+
+// UpdateCredential 登录成功后更新凭证（签名计数）与最后使用时间
+func (m *UserPasskey) UpdateCredential(id uint, credentialJson string) error {
+	now := time.Now()
+	return Db.Model(&UserPasskey{}).Where("id=?", id).Updates(map[string]interface{}{
+		"credential_json": credentialJson,
+		"last_used_at":    &now,
+	}).Error
+}
+
+// DeleteByUserId 删除用户的全部通行密钥
+func (m *UserPasskey) DeleteByUserId(db *gorm.DB, userId uint) error {
+	return db.Unscoped().Delete(&UserPasskey{}, "user_id=?", userId).Error
+}
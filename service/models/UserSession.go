@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// UserSession 用户登录会话表
+type UserSession struct {
+	BaseModel
+	UserId     uint      `gorm:"index;type:int(11)" json:"userId"`
+	TokenHash  string    `gorm:"uniqueIndex;type:varchar(64)" json:"-"` // cToken的sha256，不保存明文
+	UserAgent  string    `gorm:"type:varchar(500)" json:"userAgent"`
+	Ip         string    `gorm:"type:varchar(64)" json:"ip"`
+	LastSeenAt time.Time `json:"lastSeenAt"` // 最后活跃时间
+}
+
+// GetByTokenHash 根据token哈希查询会话
+func (m *UserSession) GetByTokenHash(tokenHash string) (UserSession, error) {
+	info := UserSession{}
+	err := Db.Where("token_hash=?", tokenHash).First(&info).Error
+	return info, err
+}
+
+// GetListByUserId 获取用户的会话列表，最近活跃的在前
+func (m *UserSession) GetListByUserId(userId uint) ([]UserSession, error) {
+	list := []UserSession{}
+	err := Db.Order("last_seen_at desc").Where("user_id=?", userId).Find(&list).Error
+	return list, err
+}
+
+// UpdateLastSeen 更新最后活跃时间
+func (m *UserSession) UpdateLastSeen(tokenHash string, t time.Time) error {
+	return Db.Model(&UserSession{}).Where("token_hash=?", tokenHash).Update("last_seen_at", t).Error
+}
+
+// DeleteByUserId 删除用户的全部会话
+func (m *UserSession) DeleteByUserId(db *gorm.DB, userId uint) error {
+	return db.Unscoped().Delete(&UserSession{}, "user_id=?", userId).Error
+}
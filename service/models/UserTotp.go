@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// UserTotp 用户两步验证(TOTP)表
+type UserTotp struct {
+	BaseModel
+	UserId            uint   `gorm:"uniqueIndex;type:int(11)" json:"userId"`
+	Secret            string `gorm:"type:varchar(64)" json:"-"`
+	Enabled           int    `gorm:"type:tinyint(1);default:0" json:"enabled"` // 1.已启用 0.待验证
+	RecoveryCodesJson string `gorm:"type:text" json:"-"`                       // 恢复码哈希列表 JSON
+}
+
+// GetByUserId 获取用户的两步验证记录
+func (m *UserTotp) GetByUserId(userId uint) (UserTotp, error) {
+	info := UserTotp{}
+	err := Db.Where("user_id=?", userId).First(&info).Error
+	return info, err
+}
+
+// IsEnabled 用户是否已启用两步验证
+func (m *UserTotp) IsEnabled(userId uint) bool {
+	var count int64
+	Db.Model(&UserTotp{}).Where("user_id=? AND enabled=?", userId, 1).Count(&count)
+	return count > 0
+}
+
+// SavePending 保存一个待验证的密钥，覆盖之前未启用的记录
+func (m *UserTotp) SavePending(userId uint, secret string) error {
+	return Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(&UserTotp{}, "user_id=?", userId).Error; err != nil {
+			return err
+		}
+		return tx.Create(&UserTotp{UserId: userId, Secret: secret}).Error
+	})
+}
+
+// Enable 启用并保存恢复码哈希
+func (m *UserTotp) Enable(userId uint, recoveryCodeHashes []string) error {
+	return Db.Model(&UserTotp{}).Where("user_id=?", userId).Updates(map[string]interface{}{
+		"enabled":             1,
+		"recovery_codes_json": m.encodeRecoveryCodes(recoveryCodeHashes),
+	}).Error
+}
+
+// DeleteByUserId 删除用户的两步验证
+func (m *UserTotp) DeleteByUserId(db *gorm.DB, userId uint) error {
+	return db.Unscoped().Delete(&UserTotp{}, "user_id=?", userId).Error
+}
+
+// GetRecoveryCodes 获取恢复码哈希列表
+func (m *UserTotp) GetRecoveryCodes() []string {
+	codes := []string{}
+	json.Unmarshal([]byte(m.RecoveryCodesJson), &codes)
+	return codes
+}
+
+// SetRecoveryCodes 更新恢复码哈希列表
+func (m *UserTotp) SetRecoveryCodes(userId uint, recoveryCodeHashes []string) error {
+	return Db.Model(&UserTotp{}).Where("user_id=?", userId).Update("recovery_codes_json", m.encodeRecoveryCodes(recoveryCodeHashes)).Error
+}
+
+func (m *UserTotp) encodeRecoveryCodes(recoveryCodeHashes []string) string {
+	b, _ := json.Marshal(recoveryCodeHashes)
+	return string(b)
+}
@@ -19,6 +19,9 @@ type ItemIcon struct {
 	ItemIconGroupId int                       `json:"itemIconGroupId"`
 	UserId          uint                      `json:"userId"`
 	User            User                      `json:"user"`
+	ConfigKey       string                    `gorm:"type:varchar(255)" json:"configKey"` // 声明式配置中的标识，为空表示手动创建
+
+	HealthCheck *ItemIconHealthCheck `gorm:"-" json:"healthCheck"` // 健康检查，未配置时为空
 }
 
 func (m *ItemIcon) DeleteByItemIconGroupIds(db *gorm.DB, userId uint, itemIconGroupIds []uint) (err error) {
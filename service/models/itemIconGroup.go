@@ -12,6 +12,11 @@ type ItemIconGroup struct {
 	Sort        int    `gorm:"type:int(11)" json:"sort"`
 	UserId      uint   `json:"userId"`
 	User        User   `json:"user"`
+	ConfigKey   string `gorm:"type:varchar(255)" json:"configKey"` // 声明式配置中的标识，为空表示手动创建
+
+	Shared          bool   `gorm:"-" json:"shared"`          // 是否为其他用户共享的分组
+	SharePermission int    `gorm:"-" json:"sharePermission"` // 共享的权限，见 SHARE_PERMISSION_*
+	OwnerName       string `gorm:"-" json:"ownerName"`       // 共享分组的所有者名称
 }
 
 func (m *ItemIconGroup) DeleteByUserId(db *gorm.DB, userId uint) (err error) {
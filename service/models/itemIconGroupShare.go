@@ -0,0 +1,75 @@
+package models
+
+import (
+	"gorm.io/gorm"
+)
+
+// 分组共享对象类型
+const (
+	SHARE_TYPE_USER = "user"
+	SHARE_TYPE_ROLE = "role"
+)
+
+// 分组访问权限，数值越大权限越高
+const (
+	SHARE_PERMISSION_NONE  = 0
+	SHARE_PERMISSION_READ  = 1 // 只读
+	SHARE_PERMISSION_WRITE = 2 // 读写：可添加、修改、删除、排序组内图标
+	SHARE_PERMISSION_OWNER = 3 // 分组所有者，仅用于权限判断，不保存
+)
+
+// ItemIconGroupShare 分组共享给指定用户或角色
+type ItemIconGroupShare struct {
+	BaseModel
+	ItemIconGroupId uint   `gorm:"index" json:"itemIconGroupId"`
+	ShareType       string `gorm:"type:varchar(10)" json:"shareType"` // user 或 role
+	TargetId        uint   `gorm:"index" json:"targetId"`             // 用户ID或角色ID
+	Permission      int    `gorm:"type:tinyint(1)" json:"permission"` // 1.只读 2.读写
+}
+
+// GetListByGroupId 获取分组的共享列表
+func (m *ItemIconGroupShare) GetListByGroupId(groupId uint) ([]ItemIconGroupShare, error) {
+	list := []ItemIconGroupShare{}
+	err := Db.Order("id").Where("item_icon_group_id=?", groupId).Find(&list).Error
+	return list, err
+}
+
+// GetPermissionMap 共享给用户（直接共享或通过角色）的分组及权限，分组ID => 最高权限
+func (m *ItemIconGroupShare) GetPermissionMap(userId uint, roleId int) (map[uint]int, error) {
+	list := []ItemIconGroupShare{}
+	err := Db.Where("(share_type=? AND target_id=?) OR (share_type=? AND target_id=?)", SHARE_TYPE_USER, userId, SHARE_TYPE_ROLE, roleId).Find(&list).Error
+	res := map[uint]int{}
+	for _, v := range list {
+		if v.Permission > res[v.ItemIconGroupId] {
+			res[v.ItemIconGroupId] = v.Permission
+		}
+	}
+	return res, err
+}
+
+// GetPermission 用户对共享分组的最高权限（不判断所有者）
+func (m *ItemIconGroupShare) GetPermission(groupId uint, userId uint, roleId int) int {
+	permission := SHARE_PERMISSION_NONE
+	Db.Model(&ItemIconGroupShare{}).Select("COALESCE(MAX(permission), 0)").
+		Where("item_icon_group_id=? AND ((share_type=? AND target_id=?) OR (share_type=? AND target_id=?))", groupId, SHARE_TYPE_USER, userId, SHARE_TYPE_ROLE, roleId).
+		Scan(&permission)
+	return permission
+}
+
+// DeleteByGroupIds 删除分组的全部共享
+func (m *ItemIconGroupShare) DeleteByGroupIds(db *gorm.DB, groupIds []uint) error {
+	return db.Delete(&ItemIconGroupShare{}, "item_icon_group_id in ?", groupIds).Error
+}
+
+// DeleteByTarget 删除共享给指定用户或角色的记录
+func (m *ItemIconGroupShare) DeleteByTarget(db *gorm.DB, shareType string, targetId uint) error {
+	return db.Delete(&ItemIconGroupShare{}, "share_type=? AND target_id=?", shareType, targetId).Error
+}
+
+// DeleteByUserId 删除用户相关的共享：用户分组的共享和共享给该用户的记录
+func (m *ItemIconGroupShare) DeleteByUserId(db *gorm.DB, userId uint) error {
+	if err := db.Where("item_icon_group_id in (?)", db.Model(&ItemIconGroup{}).Select("id").Where("user_id=?", userId)).Delete(&ItemIconGroupShare{}).Error; err != nil {
+		return err
+	}
+	return m.DeleteByTarget(db, SHARE_TYPE_USER, userId)
+}
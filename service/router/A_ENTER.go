@@ -1,8 +1,9 @@
 package router
 
 import (
+	"strings"
 	"sun-panel/global"
-	// "sun-panel/router/admin"
+	"sun-panel/router/admin"
 	"sun-panel/router/openness"
 	"sun-panel/router/panel"
 	"sun-panel/router/system"
@@ -13,6 +14,18 @@ import (
 // 初始化总路由
 func InitRouters(addr string) error {
 	router := gin.Default()
+
+	// 只信任配置的反向代理传递的客户端IP（X-Forwarded-For等），未配置时使用连接的IP
+	var trustedProxies []string
+	for _, v := range strings.Split(global.Config.GetValueString("base", "trusted_proxies"), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			trustedProxies = append(trustedProxies, v)
+		}
+	}
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		return err
+	}
+
 	rootRouter := router.Group("/")
 	routerGroup := rootRouter.Group("api")
 
@@ -20,6 +33,7 @@ func InitRouters(addr string) error {
 	system.Init(routerGroup)
 	panel.Init(routerGroup)
 	openness.Init(routerGroup)
+	admin.Init(routerGroup)
 
 	// WEB文件服务
 	{
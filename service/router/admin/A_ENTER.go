@@ -0,0 +1,12 @@
+package admin
+
+import "github.com/gin-gonic/gin"
+
+func Init(routerGroup *gin.RouterGroup) {
+	adminGroup := routerGroup.Group("admin")
+	InitSystemSetting(adminGroup)
+	InitLdap(adminGroup)
+	InitForwardAuth(adminGroup)
+	InitRoleManage(adminGroup)
+	InitAuditLog(adminGroup)
+}
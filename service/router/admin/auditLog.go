@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"sun-panel/api/api_v1"
+	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitAuditLog(router *gin.RouterGroup) {
+	api := api_v1.ApiGroupApp.ApiAdmin.AuditLogApi
+	r := router.Group("auditLog", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.MANAGE_SYSTEM))
+	{
+		r.POST("getList", api.GetList)
+		r.POST("export", api.Export)
+	}
+}
@@ -0,0 +1,18 @@
+package admin
+
+import (
+	"sun-panel/api/api_v1"
+	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitForwardAuth(router *gin.RouterGroup) {
+	api := api_v1.ApiGroupApp.ApiAdmin.ForwardAuthApi
+	r := router.Group("forwardAuth", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.MANAGE_SYSTEM))
+	{
+		r.POST("getConfig", api.GetConfig)
+		r.POST("setConfig", api.SetConfig)
+	}
+}
@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"sun-panel/api/api_v1"
+	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitLdap(router *gin.RouterGroup) {
+	api := api_v1.ApiGroupApp.ApiAdmin.LdapApi
+	r := router.Group("ldap", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.MANAGE_SYSTEM))
+	{
+		r.POST("getConfig", api.GetConfig)
+		r.POST("setConfig", api.SetConfig)
+		r.POST("test", api.Test)
+	}
+}
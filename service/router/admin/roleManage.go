@@ -0,0 +1,21 @@
+package admin
+
+import (
+	"sun-panel/api/api_v1"
+	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitRoleManage(router *gin.RouterGroup) {
+	api := api_v1.ApiGroupApp.ApiAdmin.RoleManageApi
+	r := router.Group("roleManage", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.MANAGE_SYSTEM))
+	{
+		r.POST("getSystemList", api.GetSystemList)
+		r.POST("getInfo", api.GetInfo)
+		r.POST("edit", api.Edit)
+		r.POST("deletes", api.Deletes)
+		r.POST("getPermissionList", api.GetPermissionList)
+	}
+}
@@ -0,0 +1,25 @@
+package admin
+
+import (
+	"sun-panel/api/api_v1"
+	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitSystemSetting(router *gin.RouterGroup) {
+	api := api_v1.ApiGroupApp.ApiAdmin.SystemSettingApi
+	r := router.Group("systemSetting", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.MANAGE_SYSTEM))
+	{
+		r.POST("getApplicationSetting", api.GetApplicationSetting)
+		r.POST("setApplicationSetting", api.SetApplicationSetting)
+		r.POST("getEmail", api.GetEmail)
+		r.POST("setEmail", api.SetEmail)
+		r.POST("sendTestEmail", api.SendTestEmail)
+		r.POST("getDisclaimer", api.GetDisclaimer)
+		r.POST("setDisclaimer", api.SetDisclaimer)
+		r.POST("getAboutDescription", api.GetAboutDescription)
+		r.POST("setAboutDescription", api.SetAboutDescription)
+	}
+}
@@ -0,0 +1,23 @@
+package panel
+
+import (
+	"sun-panel/api/api_v1"
+	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/apiToken"
+	"sun-panel/lib/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitArchive(router *gin.RouterGroup) {
+	archive := api_v1.ApiGroupApp.ApiPanel.ArchiveApi
+	r := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_ITEMS_WRITE), middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.EDIT_PANEL))
+	{
+		r.POST("/panel/archive/import", archive.Import)
+	}
+
+	rRead := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_ITEMS_READ), middleware.LoginInterceptor)
+	{
+		rRead.POST("/panel/archive/export", archive.Export)
+	}
+}
@@ -0,0 +1,23 @@
+package panel
+
+import (
+	"sun-panel/api/api_v1"
+	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/apiToken"
+	"sun-panel/lib/permission"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitBookmark(router *gin.RouterGroup) {
+	bookmark := api_v1.ApiGroupApp.ApiPanel.BookmarkApi
+	r := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_ITEMS_WRITE), middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.EDIT_PANEL))
+	{
+		r.POST("/panel/bookmark/import", bookmark.Import)
+	}
+
+	rRead := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_ITEMS_READ), middleware.LoginInterceptor)
+	{
+		rRead.POST("/panel/bookmark/export", bookmark.Export)
+	}
+}
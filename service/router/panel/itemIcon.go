@@ -3,24 +3,29 @@ package panel
 import (
 	"sun-panel/api/api_v1"
 	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/apiToken"
+	"sun-panel/lib/permission"
 
 	"github.com/gin-gonic/gin"
 )
 
 func InitItemIcon(router *gin.RouterGroup) {
 	itemIcon := api_v1.ApiGroupApp.ApiPanel.ItemIcon
-	r := router.Group("", middleware.LoginInterceptor)
+	r := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_ITEMS_WRITE), middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.EDIT_PANEL))
 	{
 		r.POST("/panel/itemIcon/edit", itemIcon.Edit)
 		r.POST("/panel/itemIcon/deletes", itemIcon.Deletes)
 		r.POST("/panel/itemIcon/saveSort", itemIcon.SaveSort)
 		r.POST("/panel/itemIcon/addMultiple", itemIcon.AddMultiple)
 		r.POST("/panel/itemIcon/getSiteFavicon", itemIcon.GetSiteFavicon)
+		r.POST("/panel/itemIcon/saveHealthCheck", itemIcon.SaveHealthCheck)
 	}
 
 	// 公开模式
-	rPublic := router.Group("", middleware.PublicModeInterceptor)
+	rPublic := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_ITEMS_READ), middleware.PublicModeInterceptor)
 	{
 		rPublic.POST("/panel/itemIcon/getListByGroupId", itemIcon.GetListByGroupId)
+		rPublic.POST("/panel/itemIcon/getHealthStatus", itemIcon.GetHealthStatus)
+		rPublic.POST("/panel/itemIcon/getHealthHistory", itemIcon.GetHealthHistory)
 	}
 }
@@ -3,21 +3,25 @@ package panel
 import (
 	"sun-panel/api/api_v1"
 	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/apiToken"
+	"sun-panel/lib/permission"
 
 	"github.com/gin-gonic/gin"
 )
 
 func InitItemIconGroup(router *gin.RouterGroup) {
 	itemIconGroup := api_v1.ApiGroupApp.ApiPanel.ItemIconGroup
-	r := router.Group("", middleware.LoginInterceptor)
+	r := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_ITEMS_WRITE), middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.EDIT_PANEL))
 	{
 		r.POST("/panel/itemIconGroup/edit", itemIconGroup.Edit)
 		r.POST("/panel/itemIconGroup/deletes", itemIconGroup.Deletes)
 		r.POST("/panel/itemIconGroup/saveSort", itemIconGroup.SaveSort)
+		r.POST("/panel/itemIconGroup/getShareList", itemIconGroup.GetShareList)
+		r.POST("/panel/itemIconGroup/saveShare", itemIconGroup.SaveShare)
 	}
 
 	// 公开模式
-	rPublic := router.Group("", middleware.PublicModeInterceptor)
+	rPublic := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_ITEMS_READ), middleware.PublicModeInterceptor)
 	{
 		rPublic.POST("/panel/itemIconGroup/getList", itemIconGroup.GetList)
 	}
@@ -3,13 +3,14 @@ package panel
 import (
 	"sun-panel/api/api_v1"
 	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
 
 	"github.com/gin-gonic/gin"
 )
 
 func InitUserConfig(router *gin.RouterGroup) {
 	api := api_v1.ApiGroupApp.ApiPanel.UserConfig
-	r := router.Group("", middleware.LoginInterceptor)
+	r := router.Group("", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.EDIT_PANEL))
 	{
 		r.POST("/panel/userConfig/set", api.Set)
 	}
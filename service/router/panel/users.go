@@ -3,6 +3,7 @@ package panel
 import (
 	"sun-panel/api/api_v1"
 	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
 
 	"github.com/gin-gonic/gin"
 )
@@ -10,7 +11,7 @@ import (
 func InitUsersRouter(router *gin.RouterGroup) {
 	userApi := api_v1.ApiGroupApp.ApiPanel.UsersApi
 
-	rAdmin := router.Group("", middleware.LoginInterceptor, middleware.AdminInterceptor)
+	rAdmin := router.Group("", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.MANAGE_USERS))
 	{
 		rAdmin.POST("panel/users/create", userApi.Create)
 		rAdmin.POST("panel/users/update", userApi.Update)
@@ -18,5 +19,23 @@ func InitUsersRouter(router *gin.RouterGroup) {
 		rAdmin.POST("panel/users/deletes", userApi.Deletes)
 		rAdmin.POST("panel/users/getPublicVisitUser", userApi.GetPublicVisitUser)
 		rAdmin.POST("panel/users/setPublicVisitUser", userApi.SetPublicVisitUser)
+		rAdmin.POST("panel/users/getTemplateUser", userApi.GetTemplateUser)
+		rAdmin.POST("panel/users/setTemplateUser", userApi.SetTemplateUser)
+		rAdmin.POST("panel/users/applyTemplate", userApi.ApplyTemplate)
+		rAdmin.POST("panel/users/resetTotp", userApi.ResetTotp)
+		rAdmin.POST("panel/users/getSessions", userApi.GetSessions)
+		rAdmin.POST("panel/users/revokeSession", userApi.RevokeSession)
+		rAdmin.POST("panel/users/revokeAllSessions", userApi.RevokeAllSessions)
+		rAdmin.POST("panel/users/getLoginLocks", userApi.GetLoginLocks)
+		rAdmin.POST("panel/users/clearLoginLocks", userApi.ClearLoginLocks)
+	}
+
+	// 两步验证和登录锁定策略属于系统设置
+	rSystem := router.Group("", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.MANAGE_SYSTEM))
+	{
+		rSystem.POST("panel/users/getTotpPolicy", userApi.GetTotpPolicy)
+		rSystem.POST("panel/users/setTotpPolicy", userApi.SetTotpPolicy)
+		rSystem.POST("panel/users/getLoginLockPolicy", userApi.GetLoginLockPolicy)
+		rSystem.POST("panel/users/setLoginLockPolicy", userApi.SetLoginLockPolicy)
 	}
 }
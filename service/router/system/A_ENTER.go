@@ -5,6 +5,8 @@ import "github.com/gin-gonic/gin"
 func Init(routerGroup *gin.RouterGroup) {
 	InitAbout(routerGroup)
 	InitLogin(routerGroup)
+	InitRegister(routerGroup)
+	InitCaptcha(routerGroup)
 	InitUserRouter(routerGroup)
 	InitFileRouter(routerGroup)
 	InitNoticeRouter(routerGroup)
@@ -0,0 +1,13 @@
+package system
+
+import (
+	"sun-panel/api/api_v1"
+
+	"github.com/gin-gonic/gin"
+)
+
+func InitCaptcha(router *gin.RouterGroup) {
+	captchaApi := api_v1.ApiGroupApp.ApiSystem.CaptchaApi
+
+	router.GET("/captcha/getImageByCaptchaId/:captchaId/:width/:height", captchaApi.GetImageByCaptchaId)
+}
@@ -3,6 +3,8 @@ package system
 import (
 	"sun-panel/api/api_v1"
 	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/apiToken"
+	"sun-panel/lib/permission"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,14 +13,18 @@ func InitFileRouter(router *gin.RouterGroup) {
 	FileApi := api_v1.ApiGroupApp.ApiSystem.FileApi
 
 	// 验证项目的权限(有访问密码的需要验证访问token)
-	private := router.Group("", middleware.LoginInterceptor)
+	private := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_FILES_WRITE), middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.UPLOAD_FILES))
 	{
 		private.POST("/file/uploadImg", FileApi.UploadImg)
 		private.POST("/file/uploadFiles", FileApi.UploadFiles)
 
-		private.POST("/file/getList", FileApi.GetList)
 		private.POST("/file/deletes", FileApi.Deletes)
 
 	}
 
+	privateRead := router.Group("", middleware.ApiTokenScope(apiToken.SCOPE_FILES_READ), middleware.LoginInterceptor)
+	{
+		privateRead.POST("/file/getList", FileApi.GetList)
+	}
+
 }
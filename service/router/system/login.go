@@ -11,6 +11,16 @@ func InitLogin(router *gin.RouterGroup) {
 	loginApi := api_v1.ApiGroupApp.ApiSystem.LoginApi
 
 	router.POST("/login", loginApi.Login)
+	router.POST("/login/sendResetPasswordVCode", loginApi.SendResetPasswordVCode)
+	router.POST("/login/resetPasswordByVCode", loginApi.ResetPasswordByVCode)
+	router.POST("/login/totp", loginApi.LoginTotp)
+	router.POST("/login/totpSetup", loginApi.LoginTotpSetup)
+	router.POST("/login/forwardAuth", loginApi.ForwardAuth)
+
+	// 通行密钥登录
+	passkeyApi := api_v1.ApiGroupApp.ApiSystem.PasskeyApi
+	router.POST("/login/passkey/begin", passkeyApi.LoginBegin)
+	router.POST("/login/passkey/finish", passkeyApi.LoginFinish)
 	router.POST("/logout", middleware.LoginInterceptor, loginApi.Logout)
 
 }
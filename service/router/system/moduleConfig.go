@@ -3,13 +3,14 @@ package system
 import (
 	"sun-panel/api/api_v1"
 	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
 
 	"github.com/gin-gonic/gin"
 )
 
 func InitModuleConfigRouter(router *gin.RouterGroup) {
 	api := api_v1.ApiGroupApp.ApiSystem.ModuleConfigApi
-	r := router.Group("", middleware.LoginInterceptor)
+	r := router.Group("", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.EDIT_PANEL))
 	r.POST("/system/moduleConfig/save", api.Save)
 
 	// 公开模式
@@ -3,17 +3,18 @@ package system
 import (
 	"sun-panel/api/api_v1"
 	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
 
 	"github.com/gin-gonic/gin"
 )
 
 func InitMonitorRouter(router *gin.RouterGroup) {
 	api := api_v1.ApiGroupApp.ApiSystem.MonitorApi
-	r := router.Group("", middleware.LoginInterceptor)
+	r := router.Group("", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.VIEW_MONITOR))
 	r.POST("/system/monitor/getDiskMountpoints", api.GetDiskMountpoints)
 
 	// 公开模式
-	rPublic := router.Group("", middleware.PublicModeInterceptor)
+	rPublic := router.Group("", middleware.PublicModeInterceptor, middleware.PermissionInterceptor(permission.VIEW_MONITOR))
 	{
 		rPublic.POST("/system/monitor/getAll", api.GetAll)
 		rPublic.POST("/system/monitor/getCpuState", api.GetCpuState)
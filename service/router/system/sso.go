@@ -15,6 +15,8 @@ func InitSsoRouter(router *gin.RouterGroup) {
 	routerPublic.GET("/providers", api.GetProviders)
 	routerPublic.GET("/login/:provider", api.Login)
 	routerPublic.GET("/callback/:provider", api.Callback)
+	routerPublic.GET("/saml/metadata/:provider", api.SamlMetadata)
+	routerPublic.POST("/saml/acs/:provider", api.SamlAcs)
 
 	// 需要登录后操作
 	r := router.Group("/system/sso", middleware.LoginInterceptor)
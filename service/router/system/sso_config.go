@@ -3,6 +3,7 @@ package system
 import (
 	"sun-panel/api/api_v1"
 	"sun-panel/api/api_v1/middleware"
+	"sun-panel/lib/permission"
 
 	"github.com/gin-gonic/gin"
 )
@@ -11,8 +12,8 @@ import (
 func InitSsoConfigRouter(router *gin.RouterGroup) {
 	api := api_v1.ApiGroupApp.ApiSystem.SsoConfigApi
 
-	// TODO: verify admin role using middleware, keeping it within LoginInterceptor for now as it's the standard
-	r := router.Group("/system/ssoConfig", middleware.LoginInterceptor)
+	r := router.Group("/system/ssoConfig", middleware.LoginInterceptor, middleware.PermissionInterceptor(permission.MANAGE_SSO))
 	r.POST("/getList", api.GetList)
 	r.POST("/save", api.Save)
+	r.POST("/test", api.Test)
 }
@@ -15,6 +15,33 @@ func InitUserRouter(router *gin.RouterGroup) {
 	r.POST("/user/updateInfo", api.UpdateInfo)
 	r.POST("/user/getReferralCode", api.GetReferralCode)
 
+	// 两步验证
+	totpApi := api_v1.ApiGroupApp.ApiSystem.TotpApi
+	r.POST("/user/totp/getStatus", totpApi.GetStatus)
+	r.POST("/user/totp/setup", totpApi.Setup)
+	r.POST("/user/totp/enable", totpApi.Enable)
+	r.POST("/user/totp/disable", totpApi.Disable)
+	r.POST("/user/totp/regenerateRecoveryCodes", totpApi.RegenerateRecoveryCodes)
+
+	// 通行密钥
+	passkeyApi := api_v1.ApiGroupApp.ApiSystem.PasskeyApi
+	r.POST("/user/passkey/registerBegin", passkeyApi.RegisterBegin)
+	r.POST("/user/passkey/registerFinish", passkeyApi.RegisterFinish)
+	r.POST("/user/passkey/getList", passkeyApi.GetList)
+	r.POST("/user/passkey/deletes", passkeyApi.Deletes)
+
+	// 登录会话
+	sessionApi := api_v1.ApiGroupApp.ApiSystem.SessionApi
+	r.POST("/user/session/getList", sessionApi.GetList)
+	r.POST("/user/session/revoke", sessionApi.Revoke)
+	r.POST("/user/session/revokeAll", sessionApi.RevokeAll)
+
+	// API令牌
+	apiTokenApi := api_v1.ApiGroupApp.ApiSystem.ApiTokenApi
+	r.POST("/user/apiToken/getList", apiTokenApi.GetList)
+	r.POST("/user/apiToken/create", apiTokenApi.Create)
+	r.POST("/user/apiToken/revoke", apiTokenApi.Revoke)
+
 	// 公开模式
 	rPublic := router.Group("", middleware.PublicModeInterceptor)
 	{
@@ -4,6 +4,13 @@ declare namespace Login{
         username:string 
         password:string
         vcode?:string
+        captchaId?:string
+    }
+
+    // 需要图形验证码时返回
+    interface LoginCaptchaResponse{
+        captchaRequired?:boolean
+        verification?:Common.VerificationResponse
     }
 
 	interface LoginResponse extends User.Info{